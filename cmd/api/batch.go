@@ -0,0 +1,114 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+
+	"moviego.madhav.net/internal/data"
+	"moviego.madhav.net/internal/validator"
+)
+
+// batchMoviesHandler for the "POST /v1/movies/batch" endpoint
+// Each operation gets a status, along with either the movie or an error in the shape of errorResponse()
+func (app *application) batchMoviesHandler(w http.ResponseWriter, r *http.Request) {
+	// Declare an input struct to hold the expected data from the client (Resquest DTO)
+	var input struct {
+		Atomic     *bool `json:"atomic"`
+		Operations []struct {
+			Op              string   `json:"op"`
+			ID              int64    `json:"id"`
+			ExpectedVersion *int32   `json:"expected_version"`
+			Title           *string  `json:"title"`
+			Year            *int32   `json:"year"`
+			Runtime         *int32   `json:"runtime"`
+			Genres          []string `json:"genres"`
+		} `json:"operations"`
+	}
+
+	// Decode the request body into the input struct
+	err := app.readJson(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	// Operations run in a single all or nothing transaction unless the client opts out
+	atomic := true
+	if input.Atomic != nil {
+		atomic = *input.Atomic
+	}
+
+	ops := make([]data.MovieOperation, len(input.Operations))
+	for i, op := range input.Operations {
+		ops[i] = data.MovieOperation{
+			Op:              op.Op,
+			ID:              op.ID,
+			ExpectedVersion: op.ExpectedVersion,
+			Title:           op.Title,
+			Year:            op.Year,
+			Runtime:         op.Runtime,
+			Genres:          op.Genres,
+		}
+	}
+
+	// Validate the input
+	v := validator.New()
+	if data.ValidateMovieOperations(v, ops); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	// Applying the operations to the database
+	results, err := app.models.Movies.ApplyOperations(ops, atomic)
+	if err != nil && !errors.Is(err, data.ErrBatchAborted) {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	aborted := errors.Is(err, data.ErrBatchAborted)
+
+	// Building the status of each operation
+	statuses := make([]envelope, len(ops))
+	for i, result := range results {
+		status := envelope{"op": ops[i].Op}
+
+		switch {
+		// Operations after the failing one never ran, and the ones before it were rolled back
+		case aborted && result.Err == nil:
+			status["status"] = http.StatusFailedDependency
+			status["error"] = "The operation was rolled back because another operation in the batch failed"
+		case result.Err == nil && ops[i].Op == data.OpCreate:
+			status["status"] = http.StatusCreated
+			status["movie"] = result.Movie
+		case result.Err == nil && ops[i].Op == data.OpDelete:
+			status["status"] = http.StatusOK
+			status["message"] = "movie successfully deleted"
+		case result.Err == nil:
+			status["status"] = http.StatusOK
+			status["movie"] = result.Movie
+		case errors.Is(result.Err, data.ErrFailedValidation):
+			status["status"] = http.StatusUnprocessableEntity
+			status["error"] = result.Errors
+		case errors.Is(result.Err, data.ErrRecordNotFound):
+			status["status"] = http.StatusNotFound
+			status["error"] = "The requested resource could not be found"
+		case errors.Is(result.Err, data.ErrEditConflict):
+			status["status"] = http.StatusConflict
+			status["error"] = "Unable to update the record due to an edit conflict, please try again"
+		default:
+			app.logError(r, result.Err)
+			status["status"] = http.StatusInternalServerError
+			status["error"] = "The server encountered a problem and could not process your request"
+		}
+
+		if ops[i].ID != 0 {
+			status["id"] = ops[i].ID
+		}
+		statuses[i] = status
+	}
+
+	// Return a 200 OK status code along with the status of each operation
+	err = app.writeJson(w, http.StatusOK, envelope{"committed": !aborted, "results": statuses}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
@@ -0,0 +1,391 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"moviego.madhav.net/internal/data"
+	"moviego.madhav.net/internal/validator"
+)
+
+// listMovieCommentsHandler for the "GET /v1/movies/:id/comments" endpoint
+// The threads are paginated by their top level comment, and come with all of their replies
+func (app *application) listMovieCommentsHandler(w http.ResponseWriter, r *http.Request) {
+	// Extract the id from the URL
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	// Declare an input struct to hold the expected data from the client (Resquest DTO)
+	var input struct {
+		data.Filters
+	}
+
+	// Validating the query string parameters
+	v := validator.New()
+	qs := r.URL.Query()
+
+	input.Filters.Page = app.readInt(qs, "page", 1, v)
+	input.Filters.PageSize = app.readInt(qs, "page_size", 20, v)
+
+	// Threads are always ordered from the oldest
+	input.Filters.Sort = "id"
+	input.Filters.SortSafelist = []string{"id"}
+
+	if data.ValidateFilters(v, input.Filters); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	// Checking that the movie exists and isn't in the trash
+	_, err = app.models.Movies.Get(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	// Retriving the comments from the database
+	comments, metadata, err := app.models.Comments.GetForMovie(id, input.Filters)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	// Return a 200 OK status code along with the comments
+	err = app.writeJson(w, http.StatusOK, envelope{"comments": comments, "metadata": metadata}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// createMovieCommentHandler for the "POST /v1/movies/:id/comments" endpoint
+// A comment with a parent_id is a reply to that comment
+func (app *application) createMovieCommentHandler(w http.ResponseWriter, r *http.Request) {
+	// Extract the id from the URL
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	// Declare an input struct to hold the expected data from the client (Resquest DTO)
+	var input struct {
+		ParentID *int64 `json:"parent_id"`
+		Body     string `json:"body"`
+	}
+
+	// Decode the request body into the input struct
+	err = app.readJson(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	user := app.contextGetUser(r)
+	comment := &data.Comment{
+		MovieID:  id,
+		UserID:   user.ID,
+		UserName: user.Name,
+		ParentID: input.ParentID,
+		Body:     input.Body,
+	}
+
+	// Validate the input
+	v := validator.New()
+	if data.ValidateComment(v, comment); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	// Inserting the comment, which fails when the movie doesn't exist
+	err = app.models.Comments.Insert(comment)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrInvalidParent):
+			v.AddError("parent_id", "must be the id of a visible comment on the same movie")
+			app.failedValidationResponse(w, r, v.Errors)
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	// Telling the author of the parent comment about the reply, unless they replied to themselves
+	if comment.ParentID != nil {
+		parent, err := app.models.Comments.Get(*comment.ParentID)
+		if err != nil && !errors.Is(err, data.ErrRecordNotFound) {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+
+		if parent != nil && parent.UserID != user.ID {
+			app.notify(parent.UserID, data.NotificationCommentReplied, map[string]any{
+				"comment_id":   comment.ID,
+				"movie_id":     comment.MovieID,
+				"replier_name": user.Name,
+			})
+		}
+	}
+
+	// Return a 201 Created status code along with the comment
+	err = app.writeJson(w, http.StatusCreated, envelope{"comment": comment}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// updateCommentHandler for the "PATCH /v1/comments/:id" endpoint
+// Only the author can edit a comment, and only for a while after posting it
+func (app *application) updateCommentHandler(w http.ResponseWriter, r *http.Request) {
+	comment, ok := app.readOwnComment(w, r)
+	if !ok {
+		return
+	}
+
+	// Checking that the comment is still within its edit window
+	v := validator.New()
+	if time.Since(comment.CreatedAt) > app.config.comments.editWindow {
+		v.AddError("comment", "can no longer be edited")
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	// Declare an input struct to hold the expected data from the client (Resquest DTO)
+	var input struct {
+		Body string `json:"body"`
+	}
+
+	// Decode the request body into the input struct
+	err := app.readJson(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	comment.Body = input.Body
+
+	// Validate the input
+	if data.ValidateComment(v, comment); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	// Updating the comment, which fails when it changed or was hidden in the meantime
+	err = app.models.Comments.Update(comment)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrEditConflict):
+			app.editConflictResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	// Return a 200 OK status code along with the comment
+	err = app.writeJson(w, http.StatusOK, envelope{"comment": comment}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// deleteCommentHandler for the "DELETE /v1/comments/:id" endpoint
+// The comment stays in its thread as a placeholder, so that the replies to it aren't lost
+func (app *application) deleteCommentHandler(w http.ResponseWriter, r *http.Request) {
+	comment, ok := app.readOwnComment(w, r)
+	if !ok {
+		return
+	}
+
+	// Deleting the comment
+	err := app.models.Comments.Delete(comment.ID, comment.UserID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	// Return a 200 OK status code along with a success message
+	err = app.writeJson(w, http.StatusOK, envelope{"message": "comment successfully deleted"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// reportCommentHandler for the "POST /v1/comments/:id/report" endpoint
+func (app *application) reportCommentHandler(w http.ResponseWriter, r *http.Request) {
+	// Extract the id from the URL
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	// Declare an input struct to hold the expected data from the client (Resquest DTO)
+	var input struct {
+		Reason string `json:"reason"`
+	}
+
+	// Decode the request body into the input struct
+	err = app.readJson(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	// Validate the input
+	v := validator.New()
+	if data.ValidateReviewReason(v, input.Reason, true); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	// Reporting the comment, which fails when it is no longer visible
+	err = app.models.Comments.Report(id, app.contextGetUser(r).ID, input.Reason)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrDuplicateReport):
+			v.AddError("comment", "has already been reported by you")
+			app.failedValidationResponse(w, r, v.Errors)
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	// Return a 202 Accepted status code, since the report is only acted upon by a moderator
+	err = app.writeJson(w, http.StatusAccepted, envelope{"message": "comment successfully reported"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// listReportedCommentsHandler for the "GET /v1/moderation/comments" endpoint
+func (app *application) listReportedCommentsHandler(w http.ResponseWriter, r *http.Request) {
+	// Declare an input struct to hold the expected data from the client (Resquest DTO)
+	var input struct {
+		data.Filters
+	}
+
+	// Validating the query string parameters
+	v := validator.New()
+	qs := r.URL.Query()
+
+	input.Filters.Page = app.readInt(qs, "page", 1, v)
+	input.Filters.PageSize = app.readInt(qs, "page_size", 20, v)
+
+	// Reported comments are always ordered by the number of reports
+	input.Filters.Sort = "id"
+	input.Filters.SortSafelist = []string{"id"}
+
+	if data.ValidateFilters(v, input.Filters); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	// Retriving the reported comments from the database
+	comments, metadata, err := app.models.Comments.GetReported(input.Filters)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	// Return a 200 OK status code along with the comments
+	err = app.writeJson(w, http.StatusOK, envelope{"comments": comments, "metadata": metadata}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// hideCommentHandler for the "POST /v1/moderation/comments/:id/hide" endpoint
+func (app *application) hideCommentHandler(w http.ResponseWriter, r *http.Request) {
+	// Extract the id from the URL
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	// Declare an input struct to hold the expected data from the client (Resquest DTO)
+	var input struct {
+		Reason string `json:"reason"`
+	}
+
+	// Decode the request body into the input struct
+	err = app.readJson(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	// Validate the input
+	v := validator.New()
+	if data.ValidateReviewReason(v, input.Reason, true); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	// Hiding the comment
+	err = app.models.Comments.Hide(id, app.contextGetUser(r).ID, input.Reason)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	// Return a 200 OK status code along with a success message
+	err = app.writeJson(w, http.StatusOK, envelope{"message": "comment successfully hidden"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// Read the comment named in the URL, which must have been written by the authenticated user
+// A response has already been sent when ok is false
+func (app *application) readOwnComment(w http.ResponseWriter, r *http.Request) (*data.Comment, bool) {
+	// Extract the id from the URL
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return nil, false
+	}
+
+	// Retriving the comment from the database
+	comment, err := app.models.Comments.Get(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return nil, false
+	}
+
+	// Only the author can change their comment
+	if comment.UserID != app.contextGetUser(r).ID {
+		app.notPermittedResponse(w, r)
+		return nil, false
+	}
+
+	return comment, true
+}
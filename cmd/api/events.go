@@ -0,0 +1,280 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/lib/pq"
+	"moviego.madhav.net/internal/data"
+	"moviego.madhav.net/internal/validator"
+)
+
+// Number of events read from the event log at once
+const movieEventBatchSize = 100
+
+// Wait before reading the log again when events were held back behind a running transaction
+const movieEventHeldRetry = 200 * time.Millisecond
+
+// Interval between the comments sent to keep idle streams open through proxies
+const movieEventHeartbeat = 15 * time.Second
+
+// movieEventsHandler for the "GET /v1/events/movies" endpoint
+// Changes to movies are streamed as Server-Sent Events, starting after the id given in the Last-Event-ID header
+// or the last_event_id query string parameter, or from now on when neither is given
+// When the event to resume from was already pruned, a "reset" event is sent first and the stream starts from now,
+// so that the client knows it missed events and reloads what it shows
+func (app *application) movieEventsHandler(w http.ResponseWriter, r *http.Request) {
+	// Reading the id to resume from, browsers send the header when they reconnect on their own
+	v := validator.New()
+	resume := r.Header.Get("Last-Event-ID")
+	if resume == "" {
+		resume = r.URL.Query().Get("last_event_id")
+	}
+
+	lastID := int64(-1)
+	if resume != "" {
+		id, err := strconv.ParseInt(resume, 10, 64)
+		v.Check(err == nil && id >= 0, "last_event_id", "must be a non-negative integer")
+		lastID = id
+	}
+
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		app.serverErrorResponse(w, r, errors.New("streaming is not supported by the response writer"))
+		return
+	}
+
+	// Subscribing before reading the log, so that no event falls between the replay and the live events
+	events, unsubscribe := app.movieEvents.Subscribe()
+	defer unsubscribe()
+
+	// Finding where to resume from in the log
+	var cursor data.MovieEventCursor
+	var err error
+	reset := false
+	if lastID >= 0 {
+		cursor, err = app.models.MovieEvents.CursorFor(lastID)
+		if errors.Is(err, data.ErrRecordNotFound) {
+			reset = true
+		} else if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+	}
+	if lastID < 0 || reset {
+		cursor, err = app.models.MovieEvents.LatestCursor()
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+	}
+
+	// Lifting the server write timeout, since the stream stays open
+	// When the response writer doesn't support it, the stream is ended before the timeout
+	// and the client reconnects, resuming from the last event it received
+	var end <-chan time.Time
+	if http.NewResponseController(w).SetWriteDeadline(time.Time{}) != nil {
+		timer := time.NewTimer(serverWriteTimeout - 5*time.Second)
+		defer timer.Stop()
+		end = timer.C
+	}
+
+	// Setting the headers for an event stream
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+
+	// Asking the client to reconnect quickly once the stream ends
+	_, err = fmt.Fprint(w, "retry: 1000\n\n")
+	if err != nil {
+		return
+	}
+
+	// Telling the client that the events since the id it gave are gone, the id of the reset is where it resumes from
+	if reset {
+		_, err = fmt.Fprintf(w, "id: %d\nevent: reset\ndata: {\"error\":\"the events after id %d are no longer available\"}\n\n", cursor.ID, lastID)
+		if err != nil {
+			return
+		}
+	}
+
+	// Replaying the events the client missed
+	for {
+		missed, _, err := app.models.MovieEvents.GetSince(cursor, movieEventBatchSize)
+		if err != nil {
+			app.logError(r, err)
+			return
+		}
+
+		for _, event := range missed {
+			if writeMovieEvent(w, event) != nil {
+				return
+			}
+			cursor = event.Cursor()
+		}
+
+		if len(missed) < movieEventBatchSize {
+			break
+		}
+	}
+	flusher.Flush()
+
+	heartbeat := time.NewTicker(movieEventHeartbeat)
+	defer heartbeat.Stop()
+
+	// Streaming the live events until the client goes away
+	for {
+		select {
+		case event, ok := <-events:
+			// The subscription ends when the client falls behind or the server shuts down
+			if !ok {
+				return
+			}
+
+			// Skipping the events which were already sent by the replay
+			if !event.Cursor().After(cursor) {
+				continue
+			}
+			if writeMovieEvent(w, event) != nil {
+				return
+			}
+			cursor = event.Cursor()
+
+		case <-heartbeat.C:
+			_, err = fmt.Fprint(w, ": heartbeat\n\n")
+			if err != nil {
+				return
+			}
+
+		case <-end:
+			return
+
+		case <-r.Context().Done():
+			return
+		}
+
+		flusher.Flush()
+	}
+}
+
+// Write a movie event in the Server-Sent Events format
+// The payload comes from a jsonb column, which is always written on a single line
+func writeMovieEvent(w http.ResponseWriter, event *data.MovieEvent) error {
+	_, err := fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", event.ID, event.Event, event.Payload)
+	return err
+}
+
+// Listen for the movie events of every API instance in the background, passing them on to the local streams
+// The notifications only wake the listener up, the events themselves are read from the log after the last one
+// seen, so that nothing is lost when a notification is missed while reconnecting
+func (app *application) listenMovieEvents() {
+	app.background(func() {
+		listener := pq.NewListener(app.config.db.dsn, 10*time.Second, time.Minute, func(_ pq.ListenerEventType, err error) {
+			if err != nil {
+				app.logger.PrintError(err, nil)
+			}
+		})
+		defer listener.Close()
+
+		err := listener.Listen(data.MovieEventsChannel)
+		if err != nil {
+			app.logger.PrintError(err, nil)
+			return
+		}
+
+		// Reading the events after the last one seen, which is unknown until the log can be read
+		// Returns whether some events were held back behind a transaction which is still running
+		var cursor data.MovieEventCursor
+		started := false
+		catchUp := func() bool {
+			if !started {
+				cursor, err = app.models.MovieEvents.LatestCursor()
+				if err != nil {
+					app.logger.PrintError(err, nil)
+					return false
+				}
+				started = true
+				return false
+			}
+
+			for {
+				events, held, err := app.models.MovieEvents.GetSince(cursor, movieEventBatchSize)
+				if err != nil {
+					app.logger.PrintError(err, nil)
+					return false
+				}
+
+				for _, event := range events {
+					app.movieEvents.Publish(event)
+					cursor = event.Cursor()
+				}
+
+				// Dropping the cached suggestions once any movie is created, changed, deleted or merged, on every instance
+				if len(events) > 0 {
+					app.autocompleteCache.Clear()
+				}
+
+				if held || len(events) < movieEventBatchSize {
+					return held
+				}
+			}
+		}
+		catchUp()
+
+		// Checking the connection now and then, which also catches up on any missed notification
+		ticker := time.NewTicker(time.Minute)
+		defer ticker.Stop()
+
+		// Reading the log again shortly when events were held back, since their notifications already arrived
+		var retry <-chan time.Time
+		schedule := func(held bool) {
+			retry = nil
+			if held {
+				retry = time.After(movieEventHeldRetry)
+			}
+		}
+
+		for {
+			select {
+			// A nil notification is sent after reconnecting
+			case <-listener.Notify:
+				schedule(catchUp())
+
+			case <-retry:
+				schedule(catchUp())
+
+			case <-ticker.C:
+				listener.Ping()
+				schedule(catchUp())
+
+			// Returning once the shutdown has started
+			case <-app.shutdown:
+				return
+			}
+		}
+	})
+}
+
+// Periodic task which deletes the movie events older than the retention period
+func (app *application) pruneMovieEvents() {
+	pruned, err := app.models.MovieEvents.Prune(app.config.events.retention)
+	if err != nil {
+		app.logger.PrintError(err, nil)
+		return
+	}
+
+	if pruned > 0 {
+		app.logger.PrintInfo("pruned movie events", map[string]string{
+			"count": strconv.FormatInt(pruned, 10),
+		})
+	}
+}
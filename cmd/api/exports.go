@@ -0,0 +1,193 @@
+package main
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"moviego.madhav.net/internal/data"
+	"moviego.madhav.net/internal/validator"
+)
+
+// Declare an exportMovie struct to hold the shape of a movie in an export
+// The fields are the ones accepted by the import endpoint, so that a CSV or NDJSON export can be imported again,
+// and the external ids let such an import update the movies it already holds rather than duplicate them
+type exportMovie struct {
+	Title       string            `json:"title"`
+	Year        int32             `json:"year"`
+	Runtime     int32             `json:"runtime"`
+	Genres      []string          `json:"genres"`
+	ExternalIDs map[string]string `json:"external_ids,omitempty"`
+}
+
+// Providers of the external ids, in the order of their CSV columns
+var exportProviders = []string{data.ProviderIMDb, data.ProviderTMDB, data.ProviderWikidata}
+
+// Content types of the supported export formats
+var exportContentTypes = map[string]string{
+	"csv":    "text/csv; charset=utf-8",
+	"ndjson": "application/x-ndjson",
+	"json":   "application/json",
+}
+
+// exportMoviesHandler for the "GET /v1/movies/export" endpoint
+// The movies are streamed as they are read from the database, rather than buffered like writeJson()
+func (app *application) exportMoviesHandler(w http.ResponseWriter, r *http.Request) {
+	// Declare an input struct to hold the expected data from the client (Resquest DTO)
+	var input struct {
+		movieFilters
+		Format string
+	}
+
+	// Validating the query string parameters
+	v := validator.New()
+	qs := r.URL.Query()
+
+	input.movieFilters = app.readMovieFilters(qs, v)
+	input.Format = app.readString(qs, "format", "json")
+
+	v.Check(validator.In(input.Format, "csv", "ndjson", "json"), "format", "must be csv, ndjson or json")
+	v.Check(input.Filters.Cursor == "", "cursor", "is not supported for exports")
+
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	// Lifting the server write timeout, since a full export can take longer to send
+	// This is best effort, and is not supported by every response writer
+	http.NewResponseController(w).SetWriteDeadline(time.Time{})
+
+	// Setting the headers for a file download
+	filename := fmt.Sprintf("movies-%s.%s", time.Now().UTC().Format("20060102T150405Z"), input.Format)
+	w.Header().Set("Content-Type", exportContentTypes[input.Format])
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+	w.WriteHeader(http.StatusOK)
+
+	// Buffering the writes, and flushing every batch of rows to the client
+	buf := bufio.NewWriter(w)
+	flusher, _ := w.(http.Flusher)
+	rowCount := 0
+
+	write := exportWriter(buf, input.Format)
+	err := app.models.Movies.Export(r.Context(), input.Title, input.Genres, input.Fuzzy, input.Releases, input.Filters, func(movie *data.Movie) error {
+		err := write(movie)
+		if err != nil {
+			return err
+		}
+
+		rowCount++
+		if rowCount%500 == 0 {
+			err = buf.Flush()
+			if flusher != nil {
+				flusher.Flush()
+			}
+		}
+		return err
+	})
+	if err == nil {
+		err = write(nil)
+	}
+	if err == nil {
+		err = buf.Flush()
+	}
+
+	// The status has already been sent, so an error can only be logged and the stream cut short
+	if err != nil {
+		app.logError(r, err)
+	}
+}
+
+// Return a function which writes a movie in the given export format
+// It is called with a nil movie once the last movie has been written, to close the document
+func exportWriter(buf *bufio.Writer, format string) func(*data.Movie) error {
+	switch format {
+	case "csv":
+		writer := csv.NewWriter(buf)
+		header := false
+
+		return func(movie *data.Movie) error {
+			if !header {
+				header = true
+				record := []string{"title", "year", "runtime", "genres"}
+				for _, provider := range exportProviders {
+					record = append(record, provider+"_id")
+				}
+				writer.Write(record)
+			}
+
+			if movie != nil {
+				record := []string{
+					*movie.Title,
+					strconv.Itoa(int(*movie.Year)),
+					strconv.Itoa(int(*movie.Runtime)),
+					strings.Join(movie.Genres, "|"),
+				}
+				for _, provider := range exportProviders {
+					record = append(record, movie.ExternalIDs[provider])
+				}
+				writer.Write(record)
+			}
+
+			writer.Flush()
+			return writer.Error()
+		}
+
+	case "ndjson":
+		enc := json.NewEncoder(buf)
+
+		return func(movie *data.Movie) error {
+			if movie == nil {
+				return nil
+			}
+			return enc.Encode(newExportMovie(movie))
+		}
+
+	default:
+		enc := json.NewEncoder(buf)
+		count := 0
+
+		return func(movie *data.Movie) error {
+			// Opening the document before the first movie, or for an empty export
+			if count == 0 {
+				_, err := buf.WriteString(`{"movies":[`)
+				if err != nil {
+					return err
+				}
+			}
+
+			// Closing the document after the last movie
+			if movie == nil {
+				count++
+				_, err := buf.WriteString("]}\n")
+				return err
+			}
+
+			if count > 0 {
+				err := buf.WriteByte(',')
+				if err != nil {
+					return err
+				}
+			}
+			count++
+
+			return enc.Encode(newExportMovie(movie))
+		}
+	}
+}
+
+// Convert a movie into its export shape
+func newExportMovie(movie *data.Movie) exportMovie {
+	return exportMovie{
+		Title:       *movie.Title,
+		Year:        *movie.Year,
+		Runtime:     *movie.Runtime,
+		Genres:      movie.Genres,
+		ExternalIDs: movie.ExternalIDs,
+	}
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"reflect"
+	"testing"
+
+	"moviego.madhav.net/internal/data"
+)
+
+func TestExportImportRoundTrip(t *testing.T) {
+	title, year, runtime := "Up", int32(2009), int32(96)
+	other, otherYear, otherRuntime := "Heat, the director's cut", int32(1995), int32(170)
+
+	movies := []*data.Movie{
+		{
+			ID: 1, Title: &title, Year: &year, Runtime: &runtime,
+			Genres:      []string{"animation", "family"},
+			ExternalIDs: map[string]string{data.ProviderIMDb: "tt1049413", data.ProviderWikidata: "Q174811"},
+		},
+		{
+			ID: 2, Title: &other, Year: &otherYear, Runtime: &otherRuntime,
+			Genres:      []string{"crime"},
+			ExternalIDs: map[string]string{},
+		},
+	}
+
+	tests := []struct {
+		format string
+		parse  func(r io.Reader) ([]importRow, error)
+	}{
+		{format: "csv", parse: parseCSVImport},
+		{format: "ndjson", parse: parseNDJSONImport},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.format, func(t *testing.T) {
+			// Exporting the movies
+			var out bytes.Buffer
+			buf := bufio.NewWriter(&out)
+			write := exportWriter(buf, tt.format)
+			for _, movie := range append(movies, nil) {
+				if err := write(movie); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if err := buf.Flush(); err != nil {
+				t.Fatal(err)
+			}
+
+			// Importing the export again
+			rows, err := tt.parse(&out)
+			if err != nil {
+				t.Fatalf("got error %v parsing the export:\n%s", err, out.String())
+			}
+			if len(rows) != len(movies) {
+				t.Fatalf("got %d rows; want %d", len(rows), len(movies))
+			}
+
+			for i, row := range rows {
+				want := movies[i]
+				if row.errors != nil {
+					t.Errorf("row %d: got errors %v", row.row, row.errors)
+				}
+				if *row.movie.Title != *want.Title || *row.movie.Year != *want.Year || *row.movie.Runtime != *want.Runtime {
+					t.Errorf("row %d: got %q (%d, %d min); want %q (%d, %d min)", row.row,
+						*row.movie.Title, *row.movie.Year, *row.movie.Runtime, *want.Title, *want.Year, *want.Runtime)
+				}
+				if !reflect.DeepEqual(row.movie.Genres, want.Genres) {
+					t.Errorf("row %d: got genres %v; want %v", row.row, row.movie.Genres, want.Genres)
+				}
+				if len(row.movie.ExternalIDs) != len(want.ExternalIDs) || (len(want.ExternalIDs) > 0 && !reflect.DeepEqual(row.movie.ExternalIDs, want.ExternalIDs)) {
+					t.Errorf("row %d: got external ids %v; want %v", row.row, row.movie.ExternalIDs, want.ExternalIDs)
+				}
+			}
+		})
+	}
+}
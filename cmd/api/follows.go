@@ -0,0 +1,127 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+
+	"moviego.madhav.net/internal/data"
+	"moviego.madhav.net/internal/validator"
+)
+
+// followUserHandler for the "POST /v1/follows" endpoint
+func (app *application) followUserHandler(w http.ResponseWriter, r *http.Request) {
+	// Declare an input struct to hold the expected data from the client (Resquest DTO)
+	var input struct {
+		UserID int64 `json:"user_id"`
+	}
+
+	// Decode the request body into the input struct
+	err := app.readJson(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	// Validate the input
+	v := validator.New()
+	v.Check(input.UserID > 0, "user_id", "must be provided")
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	// Following the user
+	user := app.contextGetUser(r)
+	created, err := app.models.Follows.Insert(user.ID, input.UserID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrSelfFollow):
+			v.AddError("user_id", "must not be your own id")
+			app.failedValidationResponse(w, r, v.Errors)
+		case errors.Is(err, data.ErrRecordNotFound):
+			v.AddError("user_id", "must be the id of an existing user")
+			app.failedValidationResponse(w, r, v.Errors)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	// Telling the followed user about their new follower
+	if created {
+		app.notify(input.UserID, data.NotificationUserFollowed, map[string]any{"follower_id": user.ID, "follower_name": user.Name})
+	}
+
+	// Return a 200 OK status code along with a success message
+	err = app.writeJson(w, http.StatusOK, envelope{"message": "user successfully followed"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// unfollowUserHandler for the "DELETE /v1/follows/:id" endpoint
+func (app *application) unfollowUserHandler(w http.ResponseWriter, r *http.Request) {
+	// Extract the id of the followed user from the URL
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	// Unfollowing the user
+	err = app.models.Follows.Delete(app.contextGetUser(r).ID, id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	// Return a 200 OK status code along with a success message
+	err = app.writeJson(w, http.StatusOK, envelope{"message": "user successfully unfollowed"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// feedHandler for the "GET /v1/users/me/feed" endpoint
+// The feed is paginated by the opaque cursor handed out in the metadata of the previous page
+func (app *application) feedHandler(w http.ResponseWriter, r *http.Request) {
+	// Declare an input struct to hold the expected data from the client (Resquest DTO)
+	var input struct {
+		data.Filters
+	}
+
+	// Validating the query string parameters
+	v := validator.New()
+	qs := r.URL.Query()
+
+	input.Filters.Page = 1
+	input.Filters.PageSize = app.readInt(qs, "page_size", 20, v)
+	input.Filters.Cursor = app.readString(qs, "cursor", "")
+
+	// The feed is always ordered from the most recent event
+	input.Filters.Sort = "-id"
+	input.Filters.SortSafelist = []string{"-id"}
+
+	if data.ValidateFilters(v, input.Filters); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	// Retriving the feed of the authenticated user
+	events, metadata, err := app.models.Activity.GetFeed(app.contextGetUser(r).ID, input.Filters)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	// Return a 200 OK status code along with the events
+	err = app.writeJson(w, http.StatusOK, envelope{"feed": events, "metadata": metadata}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
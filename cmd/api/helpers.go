@@ -7,10 +7,13 @@ import (
 	"io"
 	"net/http"
 	"net/url"
+	"sort"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/julienschmidt/httprouter"
+	"moviego.madhav.net/internal/data"
 	"moviego.madhav.net/internal/validator"
 )
 
@@ -107,10 +110,15 @@ func (app *application) readJson(w http.ResponseWriter, r *http.Request, dst any
 
 // method to read the id parameter from the URL
 func (app *application) readIDParam(r *http.Request) (int64, error) {
+	return app.readIntParam(r, "id")
+}
+
+// method to read a positive integer parameter with the given name from the URL
+func (app *application) readIntParam(r *http.Request, name string) (int64, error) {
 	params := httprouter.ParamsFromContext(r.Context())
-	id, err := strconv.ParseInt(params.ByName("id"), 10, 64)
+	id, err := strconv.ParseInt(params.ByName(name), 10, 64)
 	if err != nil || id < 1 {
-		return 0, errors.New("invalid id parameter")
+		return 0, fmt.Errorf("invalid %s parameter", name)
 	}
 	return id, nil
 }
@@ -136,7 +144,7 @@ func (app *application) readInt(ps url.Values, key string, defaultValue int, v *
 
 	// If no key exists, or the value is empty, return the default value
 	if s == "" {
-		return 0
+		return defaultValue
 	}
 
 	// Else, try to convert the value to an int
@@ -150,6 +158,47 @@ func (app *application) readInt(ps url.Values, key string, defaultValue int, v *
 	return i
 }
 
+// method to read a boolean value from the query string
+func (app *application) readBool(ps url.Values, key string, defaultValue bool, v *validator.Validator) bool {
+	// Extract the value from the query string
+	s := ps.Get(key)
+
+	// If no key exists, or the value is empty, return the default value
+	if s == "" {
+		return defaultValue
+	}
+
+	// Else, try to convert the value to a bool
+	b, err := strconv.ParseBool(s)
+	if err != nil {
+		v.AddError(key, "must be a boolean value")
+		return defaultValue
+	}
+
+	// Return the boolean value
+	return b
+}
+
+// method to read a date in the form YYYY-MM-DD from the query string, returning nil when it is absent
+func (app *application) readDate(ps url.Values, key string, v *validator.Validator) *time.Time {
+	// Extract the value from the query string
+	s := ps.Get(key)
+
+	// If no key exists, or the value is empty, return nil
+	if s == "" {
+		return nil
+	}
+
+	// Parse the value as a date, adding an error to the validator if it fails
+	t, err := time.Parse("2006-01-02", s)
+	if err != nil {
+		v.AddError(key, "must be a date in the form YYYY-MM-DD")
+		return nil
+	}
+
+	return &t
+}
+
 // method to read a string value from the query string
 func (app *application) readString(ps url.Values, key string, defaultValue string) string {
 	// Extract the value from the query string
@@ -164,6 +213,56 @@ func (app *application) readString(ps url.Values, key string, defaultValue strin
 	return s
 }
 
+// method to read the languages preferred by the client, most preferred first
+// The "lang" query string parameter takes precedence over the Accept-Language header
+func (app *application) readLanguages(r *http.Request) []string {
+	if lang := r.URL.Query().Get("lang"); lang != "" {
+		return []string{data.NormalizeLanguage(lang)}
+	}
+
+	// Parsing the quality value of each language range in the header
+	type languageRange struct {
+		tag     string
+		quality float64
+	}
+
+	var ranges []languageRange
+	for _, part := range strings.Split(r.Header.Get("Accept-Language"), ",") {
+		tag, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		if tag == "" || tag == "*" {
+			continue
+		}
+
+		quality := 1.0
+		if q, found := strings.CutPrefix(strings.TrimSpace(params), "q="); found {
+			parsed, err := strconv.ParseFloat(q, 64)
+			if err != nil {
+				continue
+			}
+			quality = parsed
+		}
+
+		// A quality of zero marks the language as not acceptable
+		if quality <= 0 {
+			continue
+		}
+
+		ranges = append(ranges, languageRange{tag: data.NormalizeLanguage(tag), quality: quality})
+	}
+
+	// Ordering the languages by quality, keeping the header order for equal qualities
+	sort.SliceStable(ranges, func(i, j int) bool {
+		return ranges[i].quality > ranges[j].quality
+	})
+
+	languages := make([]string, len(ranges))
+	for i, lr := range ranges {
+		languages[i] = lr.tag
+	}
+
+	return languages
+}
+
 // method to run background tasks
 func (app *application) background(fn func()) {
 	// Incrementing the WaitGroup counter
@@ -185,3 +284,32 @@ func (app *application) background(fn func()) {
 		fn()
 	}()
 }
+
+// method to run a task periodically in the background until the application shuts down
+func (app *application) periodic(interval time.Duration, fn func()) {
+	app.background(func() {
+		// Creating a ticker which fires once every interval
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				// Recovering any panic, so that one failed run doesn't stop the task
+				func() {
+					defer func() {
+						if err := recover(); err != nil {
+							app.logger.PrintError(fmt.Errorf("%s", err), nil)
+						}
+					}()
+
+					fn()
+				}()
+
+			// Returning once the shutdown has started
+			case <-app.shutdown:
+				return
+			}
+		}
+	})
+}
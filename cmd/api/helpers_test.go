@@ -0,0 +1,44 @@
+package main
+
+import (
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+func TestReadLanguages(t *testing.T) {
+	tests := []struct {
+		name           string
+		query          string
+		acceptLanguage string
+		want           []string
+	}{
+		{name: "Nothing", want: []string{}},
+		{name: "Single language", acceptLanguage: "fr", want: []string{"fr"}},
+		{name: "Normalized", acceptLanguage: "PT-br", want: []string{"pt-BR"}},
+		{name: "Header order", acceptLanguage: "de, fr", want: []string{"de", "fr"}},
+		{name: "Quality order", acceptLanguage: "de;q=0.5, fr, en;q=0.8", want: []string{"fr", "en", "de"}},
+		{name: "Equal qualities keep the header order", acceptLanguage: "es;q=0.7, it;q=0.7", want: []string{"es", "it"}},
+		{name: "Not acceptable", acceptLanguage: "de;q=0, fr", want: []string{"fr"}},
+		{name: "Wildcard", acceptLanguage: "fr, *;q=0.1", want: []string{"fr"}},
+		{name: "Invalid quality", acceptLanguage: "de;q=high, fr", want: []string{"fr"}},
+		{name: "Empty ranges", acceptLanguage: " , fr,, ", want: []string{"fr"}},
+		{name: "Query string", query: "?lang=ES-mx", acceptLanguage: "fr", want: []string{"es-MX"}},
+		{name: "Empty query string", query: "?lang=", acceptLanguage: "fr", want: []string{"fr"}},
+	}
+
+	app := &application{}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("GET", "/v1/movies"+tt.query, nil)
+			if tt.acceptLanguage != "" {
+				r.Header.Set("Accept-Language", tt.acceptLanguage)
+			}
+
+			if got := app.readLanguages(r); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %q; want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,288 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"image"
+	_ "image/gif"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"net/http"
+	"time"
+
+	"moviego.madhav.net/internal/data"
+	"moviego.madhav.net/internal/images"
+	"moviego.madhav.net/internal/validator"
+)
+
+// Widths of the thumbnails generated for each kind of image
+var thumbnailWidths = map[string][]int{
+	data.ImagePoster:   {92, 185, 342, 500},
+	data.ImageBackdrop: {300, 780, 1280},
+}
+
+// Largest width or height, and largest number of pixels, accepted for an uploaded image
+// They guard against decompression bombs, a decoded image taking 4 bytes per pixel
+const (
+	maxImageDimension = 8000
+	maxImagePixels    = 40_000_000
+)
+
+// Time allowed for uploading an image, which can be far larger than the server read timeout allows for
+const imageReadTimeout = 2 * time.Minute
+
+// uploadMovieImageHandler for the "POST /v1/movies/:id/images" endpoint
+// The image is sent as the "image" field of a multipart form, along with its "kind"
+func (app *application) uploadMovieImageHandler(w http.ResponseWriter, r *http.Request) {
+	// Extract the id from the URL
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	// Checking that the movie exists
+	_, err = app.models.Movies.Get(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	// Giving the client longer to send the body, and limiting its size, allowing some room for the rest of the form
+	extendUploadDeadlines(w, imageReadTimeout)
+	r.Body = http.MaxBytesReader(w, r.Body, app.config.images.maxBytes+64*1024)
+	err = r.ParseMultipartForm(app.config.images.maxBytes)
+	if err != nil {
+		var maxBytesError *http.MaxBytesError
+		switch {
+		case errors.As(err, &maxBytesError):
+			app.badRequestResponse(w, r, fmt.Errorf("image must not be larger than %d bytes", app.config.images.maxBytes))
+		default:
+			app.badRequestResponse(w, r, errors.New("body must be a valid multipart form"))
+		}
+		return
+	}
+	defer r.MultipartForm.RemoveAll()
+
+	// Validate the input
+	v := validator.New()
+
+	kind := r.FormValue("kind")
+	v.Check(validator.In(kind, data.ImagePoster, data.ImageBackdrop), "kind", "must be poster or backdrop")
+
+	file, header, err := r.FormFile("image")
+	if err != nil {
+		v.AddError("image", "must be provided")
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+	defer file.Close()
+
+	v.Check(header.Size <= app.config.images.maxBytes, "image", fmt.Sprintf("must not be larger than %d bytes", app.config.images.maxBytes))
+
+	// Sniffing the content type from the content itself, rather than trusting the client
+	content, err := io.ReadAll(file)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	contentType := http.DetectContentType(content)
+	v.Check(validator.In(contentType, "image/jpeg", "image/png", "image/gif"), "image", "must be a JPEG, PNG or GIF image")
+
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	// Checking the dimensions before decoding the whole image
+	config, _, err := image.DecodeConfig(bytes.NewReader(content))
+	if err != nil {
+		v.AddError("image", "must be a valid image")
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+	v.Check(config.Width <= maxImageDimension && config.Height <= maxImageDimension, "image", fmt.Sprintf("must not be larger than %dx%d pixels", maxImageDimension, maxImageDimension))
+	v.Check(config.Width*config.Height <= maxImagePixels, "image", fmt.Sprintf("must not have more than %d megapixels", maxImagePixels/1_000_000))
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	// Limiting the number of images decoded at once, since each one takes up to 160 MB and a lot of CPU
+	select {
+	case app.imageDecodes <- struct{}{}:
+		defer func() { <-app.imageDecodes }()
+	case <-r.Context().Done():
+		return
+	}
+
+	src, _, err := image.Decode(bytes.NewReader(content))
+	if err != nil {
+		v.AddError("image", "must be a valid image")
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	// Storing the original and its thumbnails under a random prefix for this upload
+	img := &data.MovieImage{
+		MovieID:     id,
+		Kind:        kind,
+		ContentType: contentType,
+		Width:       config.Width,
+		Height:      config.Height,
+		URLs:        make(map[string]string),
+	}
+
+	err = app.storeMovieImage(r.Context(), img, content, src)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	// Insert the image into the database, removing the stored files if that fails
+	err = app.models.Images.Insert(img)
+	if err != nil {
+		app.deleteImageFiles(img)
+
+		// The movie can have been moved to the trash while the image was being processed
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	// Return a 201 Created status code along with the image data
+	err = app.writeJson(w, http.StatusCreated, envelope{"image": img}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// deleteMovieImageHandler for the "DELETE /v1/movies/:id/images/:image_id" endpoint
+func (app *application) deleteMovieImageHandler(w http.ResponseWriter, r *http.Request) {
+	// Extract the ids from the URL
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+	imageID, err := app.readIntParam(r, "image_id")
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	// Delete the image from the database
+	img, err := app.models.Images.Delete(id, imageID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	// Removing the stored files once the record is gone
+	app.deleteImageFiles(img)
+
+	// Return a 200 OK status code along with a success message
+	err = app.writeJson(w, http.StatusOK, envelope{"message": "image successfully deleted"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// Store the original image and its thumbnails, recording their keys and URLs on the image
+func (app *application) storeMovieImage(ctx context.Context, img *data.MovieImage, content []byte, src image.Image) error {
+	// Generating a random prefix, so that uploads never overwrite each other
+	randomBytes := make([]byte, 8)
+	_, err := rand.Read(randomBytes)
+	if err != nil {
+		return err
+	}
+	prefix := fmt.Sprintf("movies/%d/%s", img.MovieID, hex.EncodeToString(randomBytes))
+
+	// Storing the original as it was uploaded
+	ext := map[string]string{"image/jpeg": "jpg", "image/png": "png", "image/gif": "gif"}[img.ContentType]
+	err = app.putImageFile(ctx, img, "original", fmt.Sprintf("%s/original.%s", prefix, ext), content, img.ContentType)
+	if err != nil {
+		return err
+	}
+
+	// Generating the thumbnails narrower than the original, as JPEG unless transparency must be kept
+	for _, width := range thumbnailWidths[img.Kind] {
+		if width >= img.Width {
+			continue
+		}
+
+		thumbnail := images.Thumbnail(src, width)
+
+		buf := new(bytes.Buffer)
+		contentType, thumbExt := "image/jpeg", "jpg"
+		switch img.ContentType {
+		case "image/jpeg":
+			err = jpeg.Encode(buf, thumbnail, &jpeg.Options{Quality: 85})
+		default:
+			contentType, thumbExt = "image/png", "png"
+			err = png.Encode(buf, thumbnail)
+		}
+		if err != nil {
+			app.deleteImageFiles(img)
+			return err
+		}
+
+		size := fmt.Sprintf("w%d", width)
+		err = app.putImageFile(ctx, img, size, fmt.Sprintf("%s/%s.%s", prefix, size, thumbExt), buf.Bytes(), contentType)
+		if err != nil {
+			app.deleteImageFiles(img)
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Store a single file of an image and record its key and URL
+func (app *application) putImageFile(ctx context.Context, img *data.MovieImage, size, key string, content []byte, contentType string) error {
+	err := app.storage.Put(ctx, key, bytes.NewReader(content), contentType)
+	if err != nil {
+		return err
+	}
+
+	img.Keys = append(img.Keys, key)
+	img.URLs[size] = app.storage.URL(key)
+	return nil
+}
+
+// Remove the stored files of an image, logging any failures
+func (app *application) deleteImageFiles(img *data.MovieImage) {
+	app.deleteStoredFiles(img.Keys)
+}
+
+// Delete the files with the given keys from the storage, logging the ones which couldn't be deleted
+func (app *application) deleteStoredFiles(keys []string) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	for _, key := range keys {
+		err := app.storage.Delete(ctx, key)
+		if err != nil {
+			app.logger.PrintError(err, map[string]string{"key": key})
+		}
+	}
+}
@@ -0,0 +1,571 @@
+package main
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"moviego.madhav.net/internal/data"
+	"moviego.madhav.net/internal/validator"
+)
+
+// Bodies up to this size are imported while the client waits, larger ones in the background
+const importSyncMaxBytes = 1_048_576
+
+// Number of movies inserted per transaction in best effort mode
+const importBatchSize = 500
+
+// Time allowed for uploading an import body, which can be far larger than the server read timeout allows for
+const importReadTimeout = 10 * time.Minute
+
+// Time after which an import which hasn't finished is taken to be lost with the instance which was running it
+const importStaleAfter = time.Hour
+
+// Declare an importRow struct to hold a single parsed row of an import
+type importRow struct {
+	row    int
+	movie  *data.Movie
+	errors map[string]string
+}
+
+// importMoviesHandler for the "POST /v1/movies/import" endpoint
+func (app *application) importMoviesHandler(w http.ResponseWriter, r *http.Request) {
+	// Declare an input struct to hold the expected data from the client (Resquest DTO)
+	var input struct {
+		Format string
+		Mode   string
+		DryRun bool
+	}
+
+	// Validating the query string parameters
+	v := validator.New()
+	qs := r.URL.Query()
+
+	input.Format = app.readString(qs, "format", importFormat(r.Header.Get("Content-Type")))
+	input.Mode = app.readString(qs, "mode", "atomic")
+	input.DryRun = app.readBool(qs, "dry_run", false, v)
+
+	v.Check(validator.In(input.Format, "csv", "ndjson"), "format", "must be csv or ndjson")
+	v.Check(validator.In(input.Mode, "atomic", "best_effort"), "mode", "must be atomic or best_effort")
+
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	// Spooling the body to a temporary file, so that large imports can outlive the request
+	file, err := os.CreateTemp("", "moviego-import-*")
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	// Giving the client longer to send the body, and limiting its size to the configured maximum
+	extendUploadDeadlines(w, importReadTimeout)
+	r.Body = http.MaxBytesReader(w, r.Body, app.config.imports.maxBytes)
+	size, err := io.Copy(file, r.Body)
+	if err == nil {
+		_, err = file.Seek(0, io.SeekStart)
+	}
+	if err != nil {
+		file.Close()
+		os.Remove(file.Name())
+
+		var maxBytesError *http.MaxBytesError
+		switch {
+		case errors.As(err, &maxBytesError):
+			app.badRequestResponse(w, r, fmt.Errorf("body must not be larger than %d bytes", maxBytesError.Limit))
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	atomic := input.Mode == "atomic"
+
+	// Importing small bodies straight away and returning the report
+	if size <= importSyncMaxBytes {
+		defer os.Remove(file.Name())
+		defer file.Close()
+
+		report, err := app.importMovies(file, input.Format, input.DryRun, atomic)
+		if err != nil {
+			var parseError *importParseError
+			switch {
+			case errors.As(err, &parseError):
+				app.badRequestResponse(w, r, err)
+			default:
+				app.serverErrorResponse(w, r, err)
+			}
+			return
+		}
+
+		err = app.writeJson(w, http.StatusOK, envelope{"report": report}, nil)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	// Recording the import, so that its progress can be followed through the status endpoint
+	imp := &data.Import{
+		UserID: app.contextGetUser(r).ID,
+		Status: data.ImportPending,
+		Format: input.Format,
+		DryRun: input.DryRun,
+		Atomic: atomic,
+	}
+
+	err = app.models.Imports.Insert(imp)
+	if err != nil {
+		file.Close()
+		os.Remove(file.Name())
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	// Processing the import as a background task, on a copy so that the response below isn't raced
+	job := *imp
+	app.background(func() {
+		defer os.Remove(file.Name())
+		defer file.Close()
+
+		app.runImport(&job, file)
+	})
+
+	// Add a Location header to the response containing the URL of the import status
+	headers := make(http.Header)
+	headers.Set("Location", fmt.Sprintf("/v1/imports/%d", imp.ID))
+
+	// Return a 202 Accepted status code along with the import details
+	err = app.writeJson(w, http.StatusAccepted, envelope{"import": imp}, headers)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// showImportHandler for the "GET /v1/imports/:id" endpoint
+func (app *application) showImportHandler(w http.ResponseWriter, r *http.Request) {
+	// Extract the id from the URL
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	// Retriving the import record from the database, based on the ID
+	imp, err := app.models.Imports.Get(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	// Only the user who started the import may follow it
+	if imp.UserID != app.contextGetUser(r).ID {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	// Return a 200 OK status code along with the import details
+	err = app.writeJson(w, http.StatusOK, envelope{"import": imp}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// Process an import in the background, recording its progress and report
+func (app *application) runImport(imp *data.Import, r io.Reader) {
+	properties := map[string]string{"import_id": strconv.FormatInt(imp.ID, 10)}
+
+	// Marking the import as running
+	imp.Status = data.ImportRunning
+	err := app.models.Imports.Update(imp)
+	if err != nil {
+		app.logger.PrintError(err, properties)
+		return
+	}
+
+	// Importing the movies and recording the outcome
+	report, err := app.importMovies(r, imp.Format, imp.DryRun, imp.Atomic)
+	if err != nil {
+		// Errors which prevent the whole file from being read are reported against row zero,
+		// while the details of server errors are only logged
+		message := err.Error()
+		var parseError *importParseError
+		if !errors.As(err, &parseError) {
+			app.logger.PrintError(err, properties)
+			message = "the server encountered a problem and could not process the import"
+		}
+
+		report = &data.ImportReport{
+			DryRun: imp.DryRun,
+			Atomic: imp.Atomic,
+			Errors: []data.ImportRowError{{Row: 0, Errors: map[string]string{"file": message}}},
+		}
+		imp.Status = data.ImportFailed
+	} else {
+		imp.Status = data.ImportCompleted
+	}
+
+	finishedAt := time.Now()
+	imp.Report = report
+	imp.FinishedAt = &finishedAt
+
+	err = app.models.Imports.Update(imp)
+	if err != nil {
+		app.logger.PrintError(err, properties)
+	}
+}
+
+// importParseError is returned by the import parsers when the body as a whole can't be read in its format
+// It is the client's fault, unlike any other error returned while importing
+type importParseError struct {
+	message string
+}
+
+func (e *importParseError) Error() string {
+	return e.message
+}
+
+// Return a new importParseError, formatting the message as fmt.Sprintf() does
+func importParseErrorf(format string, args ...any) error {
+	return &importParseError{message: fmt.Sprintf(format, args...)}
+}
+
+// Parse, validate and insert the movies in an import, returning the per row report
+// An error is only returned when the file as a whole can't be processed, an *importParseError when the
+// body can't be parsed
+func (app *application) importMovies(r io.Reader, format string, dryRun, atomic bool) (*data.ImportReport, error) {
+	// Parsing the rows in the given format
+	var rows []importRow
+	var err error
+	switch format {
+	case "csv":
+		rows, err = parseCSVImport(r)
+	default:
+		rows, err = parseNDJSONImport(r)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	report := &data.ImportReport{
+		TotalRows: len(rows),
+		DryRun:    dryRun,
+		Atomic:    atomic,
+		Errors:    []data.ImportRowError{},
+	}
+
+	// Validating every parsed row, and collecting the valid movies
+	var valid []importRow
+	for _, row := range rows {
+		if row.errors == nil {
+			v := validator.New()
+			data.ValidateMovie(v, row.movie)
+			if data.ValidateExternalIDs(v, row.movie.ExternalIDs); !v.Valid() {
+				row.errors = v.Errors
+			}
+		}
+
+		if row.errors != nil {
+			report.Errors = append(report.Errors, data.ImportRowError{Row: row.row, Errors: row.errors})
+			continue
+		}
+		valid = append(valid, row)
+	}
+
+	// Nothing is written in a dry run, or when an atomic import already has invalid rows
+	if dryRun || (atomic && len(report.Errors) > 0) {
+		report.Failed = len(report.Errors)
+		return report, nil
+	}
+
+	// Inserting the movies in one transaction for atomic imports, or in batches otherwise
+	batchSize := importBatchSize
+	if atomic {
+		batchSize = len(valid)
+	}
+
+	for start := 0; start < len(valid); start += batchSize {
+		end := start + batchSize
+		if end > len(valid) {
+			end = len(valid)
+		}
+		batch := valid[start:end]
+
+		movies := make([]*data.Movie, len(batch))
+		for i := range batch {
+			movies[i] = batch[i].movie
+		}
+
+		errs, err := app.models.Movies.InsertBatch(movies, atomic)
+		if err != nil && !errors.Is(err, data.ErrBatchAborted) {
+			return nil, err
+		}
+
+		// Reporting the movies which the database refused
+		for i, insertErr := range errs {
+			switch {
+			case errors.Is(insertErr, data.ErrDuplicateExternalID):
+				report.Errors = append(report.Errors, data.ImportRowError{
+					Row:    batch[i].row,
+					Errors: map[string]string{"external_ids": "already belong to another movie"},
+				})
+			case insertErr != nil:
+				report.Errors = append(report.Errors, data.ImportRowError{
+					Row:    batch[i].row,
+					Errors: map[string]string{"movie": "could not be inserted"},
+				})
+			case !errors.Is(err, data.ErrBatchAborted):
+				report.Imported++
+
+				// A movie which already existed comes back from the upsert with a later version
+				if movies[i].Version > 1 {
+					report.Updated++
+				}
+			}
+		}
+	}
+
+	// Ordering the errors by row, since database errors are only found after validation
+	sort.Slice(report.Errors, func(i, j int) bool {
+		return report.Errors[i].Row < report.Errors[j].Row
+	})
+	report.Failed = len(report.Errors)
+
+	return report, nil
+}
+
+// Return the import format for the given Content-Type header, or an empty string if unknown
+func importFormat(contentType string) string {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return ""
+	}
+
+	switch mediaType {
+	case "text/csv":
+		return "csv"
+	case "application/x-ndjson", "application/jsonl", "application/json-lines":
+		return "ndjson"
+	default:
+		return ""
+	}
+}
+
+// Parse a CSV import, which starts with a header row naming the title, year, runtime and genres columns
+// The imdb_id, tmdb_id and wikidata_id columns are optional, and hold the external ids of the movie
+// Genres are separated by a "|" within their column, and rows are numbered from the first data row
+func parseCSVImport(r io.Reader) ([]importRow, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+
+	// Reading the header row and mapping each column to its position
+	header, err := reader.Read()
+	if err != nil {
+		var csvError *csv.ParseError
+		switch {
+		case errors.Is(err, io.EOF):
+			return nil, importParseErrorf("body must not be empty")
+		case errors.As(err, &csvError):
+			return nil, importParseErrorf("body contains a malformed CSV header: %v", err)
+		default:
+			return nil, err
+		}
+	}
+
+	columns := make(map[string]int)
+	for i, name := range header {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if !validator.In(name, "title", "year", "runtime", "genres", "imdb_id", "tmdb_id", "wikidata_id") {
+			return nil, importParseErrorf("body contains unknown column %q", name)
+		}
+		columns[name] = i
+	}
+	for _, name := range []string{"title", "year", "runtime", "genres"} {
+		if _, ok := columns[name]; !ok {
+			return nil, importParseErrorf("body is missing the %q column", name)
+		}
+	}
+
+	// Reading every data row
+	var rows []importRow
+	for n := 1; ; n++ {
+		record, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+
+		// Reading errors other than malformed rows mean the body itself can't be read any further
+		var csvError *csv.ParseError
+		if err != nil && !errors.As(err, &csvError) {
+			return nil, err
+		}
+
+		row := importRow{row: n, movie: emptyImportMovie()}
+		if err != nil {
+			row.errors = map[string]string{"row": "is not valid CSV"}
+			rows = append(rows, row)
+			continue
+		}
+		if len(record) != len(header) {
+			row.errors = map[string]string{"row": fmt.Sprintf("must have %d columns", len(header))}
+			rows = append(rows, row)
+			continue
+		}
+
+		// Converting the columns into the movie fields
+		errs := make(map[string]string)
+
+		title := strings.TrimSpace(record[columns["title"]])
+		row.movie.Title = &title
+
+		for _, name := range []string{"year", "runtime"} {
+			value := strings.TrimSpace(record[columns[name]])
+			if value == "" {
+				continue
+			}
+
+			i, err := strconv.ParseInt(value, 10, 32)
+			if err != nil {
+				errs[name] = "must be an integer value"
+				continue
+			}
+
+			i32 := int32(i)
+			if name == "year" {
+				row.movie.Year = &i32
+			} else {
+				row.movie.Runtime = &i32
+			}
+		}
+
+		row.movie.Genres = []string{}
+		for _, genre := range strings.Split(record[columns["genres"]], "|") {
+			if genre = strings.TrimSpace(genre); genre != "" {
+				row.movie.Genres = append(row.movie.Genres, genre)
+			}
+		}
+
+		row.movie.ExternalIDs = map[string]string{}
+		for _, provider := range []string{data.ProviderIMDb, data.ProviderTMDB, data.ProviderWikidata} {
+			if i, ok := columns[provider+"_id"]; ok {
+				if id := strings.TrimSpace(record[i]); id != "" {
+					row.movie.ExternalIDs[provider] = id
+				}
+			}
+		}
+
+		if len(errs) > 0 {
+			row.errors = errs
+		}
+		rows = append(rows, row)
+	}
+
+	return rows, nil
+}
+
+// Parse an NDJSON import, which holds one movie object per line
+// Blank lines are skipped, and rows are numbered by their line in the body
+func parseNDJSONImport(r io.Reader) ([]importRow, error) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), importSyncMaxBytes)
+
+	var rows []importRow
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+
+		// Decoding the line into the same fields accepted by the create endpoint
+		var input struct {
+			Title       *string           `json:"title"`
+			Year        *int32            `json:"year"`
+			Runtime     *int32            `json:"runtime"`
+			Genres      []string          `json:"genres"`
+			ExternalIDs map[string]string `json:"external_ids"`
+		}
+
+		dec := json.NewDecoder(strings.NewReader(line))
+		dec.DisallowUnknownFields()
+
+		row := importRow{row: n, movie: emptyImportMovie()}
+		err := dec.Decode(&input)
+		if err == nil && dec.More() {
+			err = errors.New("line must contain a single JSON object")
+		}
+		if err != nil {
+			row.errors = map[string]string{"row": "must be a valid JSON object"}
+			rows = append(rows, row)
+			continue
+		}
+
+		if input.Title != nil {
+			row.movie.Title = input.Title
+		}
+		if input.Year != nil {
+			row.movie.Year = input.Year
+		}
+		if input.Runtime != nil {
+			row.movie.Runtime = input.Runtime
+		}
+		row.movie.Genres = input.Genres
+		row.movie.ExternalIDs = input.ExternalIDs
+
+		rows = append(rows, row)
+	}
+
+	// Handling lines which are too long to be read, or errors reading the body
+	if err := scanner.Err(); err != nil {
+		if errors.Is(err, bufio.ErrTooLong) {
+			return nil, importParseErrorf("body contains a line longer than %d bytes", importSyncMaxBytes)
+		}
+		return nil, err
+	}
+
+	if len(rows) == 0 {
+		return nil, importParseErrorf("body must not be empty")
+	}
+
+	return rows, nil
+}
+
+// Return a movie with zero values for the required fields, so that missing fields fail validation
+func emptyImportMovie() *data.Movie {
+	var title string
+	var year, runtime int32
+
+	return &data.Movie{Title: &title, Year: &year, Runtime: &runtime}
+}
+
+// Periodic task which fails the imports lost with an instance which stopped before finishing them
+func (app *application) failStaleImports() {
+	failed, err := app.models.Imports.FailStale(importStaleAfter)
+	if err != nil {
+		app.logger.PrintError(err, nil)
+		return
+	}
+
+	if failed > 0 {
+		app.logger.PrintInfo("failed stale imports", map[string]string{
+			"count": strconv.FormatInt(failed, 10),
+		})
+	}
+}
@@ -0,0 +1,184 @@
+package main
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"testing/iotest"
+
+	"moviego.madhav.net/internal/data"
+)
+
+// Fields of a parsed row which the tests compare, the movie pointers are dereferenced
+type parsedRow struct {
+	row         int
+	title       string
+	year        int32
+	runtime     int32
+	genres      []string
+	externalIDs map[string]string
+	errors      map[string]string
+}
+
+func flattenRows(rows []importRow) []parsedRow {
+	var parsed []parsedRow
+	for _, row := range rows {
+		parsed = append(parsed, parsedRow{
+			row:         row.row,
+			title:       *row.movie.Title,
+			year:        *row.movie.Year,
+			runtime:     *row.movie.Runtime,
+			genres:      row.movie.Genres,
+			externalIDs: row.movie.ExternalIDs,
+			errors:      row.errors,
+		})
+	}
+	return parsed
+}
+
+func TestParseCSVImport(t *testing.T) {
+	tests := []struct {
+		name      string
+		body      string
+		want      []parsedRow
+		wantParse bool // Whether an *importParseError is expected
+	}{
+		{
+			name: "Valid rows",
+			body: "title,year,runtime,genres,imdb_id\nUp,2009,96,animation|family,tt1049413\nHeat,1995,170,crime,\n",
+			want: []parsedRow{
+				{row: 1, title: "Up", year: 2009, runtime: 96, genres: []string{"animation", "family"}, externalIDs: map[string]string{data.ProviderIMDb: "tt1049413"}},
+				{row: 2, title: "Heat", year: 1995, runtime: 170, genres: []string{"crime"}, externalIDs: map[string]string{}},
+			},
+		},
+		{
+			name: "Columns in any order and case",
+			body: "Genres, Runtime, Title, Year\n drama | , 120, Ran ,1985\n",
+			want: []parsedRow{
+				{row: 1, title: "Ran", year: 1985, runtime: 120, genres: []string{"drama"}, externalIDs: map[string]string{}},
+			},
+		},
+		{
+			name: "Row errors",
+			body: "title,year,runtime,genres\nUp,soon,96,animation\nHeat,1995\n",
+			want: []parsedRow{
+				{row: 1, title: "Up", runtime: 96, genres: []string{"animation"}, externalIDs: map[string]string{}, errors: map[string]string{"year": "must be an integer value"}},
+				{row: 2, errors: map[string]string{"row": "must have 4 columns"}},
+			},
+		},
+		{
+			name: "Header only",
+			body: "title,year,runtime,genres\n",
+			want: nil,
+		},
+		{name: "Empty body", body: "", wantParse: true},
+		{name: "Unknown column", body: "title,year,runtime,genres,rating\n", wantParse: true},
+		{name: "Missing column", body: "title,year,runtime\n", wantParse: true},
+		{name: "Malformed header", body: "title,\"year\n", wantParse: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rows, err := parseCSVImport(strings.NewReader(tt.body))
+
+			var parseErr *importParseError
+			if tt.wantParse {
+				if !errors.As(err, &parseErr) {
+					t.Fatalf("got error %v; want an *importParseError", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("got error %v; want none", err)
+			}
+
+			if got := flattenRows(rows); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %+v; want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseNDJSONImport(t *testing.T) {
+	tests := []struct {
+		name      string
+		body      string
+		want      []parsedRow
+		wantParse bool // Whether an *importParseError is expected
+	}{
+		{
+			name: "Valid rows",
+			body: `{"title":"Up","year":2009,"runtime":96,"genres":["animation"],"external_ids":{"tmdb":"14160"}}` + "\n\n" +
+				`{"title":"Heat","year":1995,"runtime":170,"genres":["crime"]}`,
+			want: []parsedRow{
+				{row: 1, title: "Up", year: 2009, runtime: 96, genres: []string{"animation"}, externalIDs: map[string]string{data.ProviderTMDB: "14160"}},
+				{row: 3, title: "Heat", year: 1995, runtime: 170, genres: []string{"crime"}},
+			},
+		},
+		{
+			name: "Missing fields are left empty",
+			body: `{"title":"Up"}`,
+			want: []parsedRow{
+				{row: 1, title: "Up"},
+			},
+		},
+		{
+			name: "Row errors",
+			body: "not json\n" + `{"title":"Up","rating":5}` + "\n" + `{"title":"Up"} {"title":"Heat"}`,
+			want: []parsedRow{
+				{row: 1, errors: map[string]string{"row": "must be a valid JSON object"}},
+				{row: 2, errors: map[string]string{"row": "must be a valid JSON object"}},
+				{row: 3, errors: map[string]string{"row": "must be a valid JSON object"}},
+			},
+		},
+		{name: "Empty body", body: "", wantParse: true},
+		{name: "Blank lines only", body: "\n  \n", wantParse: true},
+		{name: "Line too long", body: `{"title":"` + strings.Repeat("a", importSyncMaxBytes) + `"}`, wantParse: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rows, err := parseNDJSONImport(strings.NewReader(tt.body))
+
+			var parseErr *importParseError
+			if tt.wantParse {
+				if !errors.As(err, &parseErr) {
+					t.Fatalf("got error %v; want an *importParseError", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("got error %v; want none", err)
+			}
+
+			if got := flattenRows(rows); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %+v; want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseImportReadError(t *testing.T) {
+	// A body which can't be read is a fault of the server or the connection, not a parse error
+	readErr := errors.New("connection reset")
+
+	tests := []struct {
+		name  string
+		parse func() ([]importRow, error)
+	}{
+		{name: "CSV", parse: func() ([]importRow, error) { return parseCSVImport(iotest.ErrReader(readErr)) }},
+		{name: "NDJSON", parse: func() ([]importRow, error) { return parseNDJSONImport(iotest.ErrReader(readErr)) }},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := tt.parse()
+
+			var parseErr *importParseError
+			if !errors.Is(err, readErr) || errors.As(err, &parseErr) {
+				t.Errorf("got error %v; want the read error", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,332 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"moviego.madhav.net/internal/data"
+	"moviego.madhav.net/internal/validator"
+)
+
+// Time on top of the job timeout before a claimed job is run again, leaving the worker time to record the outcome
+const jobLeaseMargin = 30 * time.Second
+
+// errPermanentJob marks a failure which a retry can't fix, the job is dead-lettered straight away
+var errPermanentJob = errors.New("permanent job failure")
+
+// jobHandler runs a claimed job, giving up once the context is done
+type jobHandler func(ctx context.Context, payload json.RawMessage) error
+
+// Adapt a handler taking the payload of its job decoded into T
+// A payload which can't be decoded will never run, so it fails the job permanently
+func typedJob[T any](fn func(ctx context.Context, payload T) error) jobHandler {
+	return func(ctx context.Context, payload json.RawMessage) error {
+		var v T
+		err := json.Unmarshal(payload, &v)
+		if err != nil {
+			return fmt.Errorf("%w: decoding the payload: %v", errPermanentJob, err)
+		}
+
+		return fn(ctx, v)
+	}
+}
+
+// Handlers for every kind of job, by kind
+func (app *application) jobHandlers() map[string]jobHandler {
+	return map[string]jobHandler{
+		data.JobWelcomeEmail: typedJob(app.sendWelcomeEmail),
+	}
+}
+
+// jobOptions for queuing a job, the zero value runs it straight away without a unique key
+type jobOptions struct {
+	UniqueKey string
+	RunAt     time.Time
+}
+
+// Build a job of the given kind, which is run by a worker of any API instance
+// It is queued by the model making the change it follows from, in the same transaction
+func (app *application) newJob(kind string, payload any, opts jobOptions) (*data.Job, error) {
+	js, err := json.Marshal(payload)
+	if err != nil {
+		return nil, err
+	}
+
+	return &data.Job{
+		Kind:        kind,
+		Payload:     js,
+		UniqueKey:   opts.UniqueKey,
+		MaxAttempts: app.config.jobs.maxAttempts,
+		RunAt:       opts.RunAt,
+	}, nil
+}
+
+// Start the workers, which run the jobs that are due until the shutdown starts
+// They are tracked apart from the other background tasks, so that serve() can drain them first
+func (app *application) startJobWorkers() {
+	handlers := app.jobHandlers()
+
+	for i := 0; i < app.config.jobs.workers; i++ {
+		app.workers.Add(1)
+
+		go func() {
+			defer app.workers.Done()
+
+			ticker := time.NewTicker(app.config.jobs.pollInterval)
+			defer ticker.Stop()
+
+			for {
+				// Running the jobs which are due until none are left, checking for the shutdown between jobs
+				for app.runNextJob(handlers) {
+					select {
+					case <-app.shutdown:
+						return
+					default:
+					}
+				}
+
+				select {
+				case <-ticker.C:
+				case <-app.shutdown:
+					return
+				}
+			}
+		}()
+	}
+}
+
+// Wait for the workers to finish their running jobs once the shutdown has started
+// Jobs still running after the drain timeout are cancelled, and are retried by the next instance to run
+func (app *application) drainJobs() {
+	done := make(chan struct{})
+	go func() {
+		app.workers.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(app.config.jobs.drainTimeout):
+		app.logger.PrintInfo("cancelling running jobs", nil)
+		app.cancelJobs()
+		<-done
+	}
+}
+
+// Claim a single job which is due and run it, returning whether there was one
+func (app *application) runNextJob(handlers map[string]jobHandler) bool {
+	jobs, err := app.models.Jobs.Claim(1, app.config.jobs.timeout+jobLeaseMargin)
+	if err != nil {
+		app.logger.PrintError(err, nil)
+		return false
+	}
+	if len(jobs) == 0 {
+		return false
+	}
+
+	app.runJob(handlers, jobs[0])
+	return true
+}
+
+// Run a claimed job and record the outcome
+// Failed jobs are retried with an exponential backoff, until they run out of attempts and are dead-lettered
+func (app *application) runJob(handlers map[string]jobHandler, job *data.Job) {
+	err := app.callJobHandler(handlers, job)
+
+	now := time.Now()
+	job.FinishedAt = nil
+	job.LastError = ""
+
+	switch {
+	case err == nil:
+		job.Status = data.JobSucceeded
+		job.FinishedAt = &now
+	case errors.Is(err, errPermanentJob) || job.Attempts >= job.MaxAttempts:
+		job.Status = data.JobDead
+		job.FinishedAt = &now
+		job.LastError = err.Error()
+	default:
+		// Doubling the wait after each attempt, up to a day
+		backoff := app.config.jobs.backoff << (job.Attempts - 1)
+		if backoff <= 0 || backoff > 24*time.Hour {
+			backoff = 24 * time.Hour
+		}
+
+		job.Status = data.JobPending
+		job.RunAt = now.Add(backoff)
+		job.LastError = err.Error()
+	}
+
+	if err != nil {
+		app.logger.PrintError(err, map[string]string{
+			"job":     strconv.FormatInt(job.ID, 10),
+			"kind":    job.Kind,
+			"attempt": strconv.Itoa(job.Attempts),
+			"status":  job.Status,
+		})
+	}
+
+	// Recording the outcome, when this fails the job is run again once its lease runs out
+	err = app.models.Jobs.RecordAttempt(job)
+	if err != nil {
+		app.logger.PrintError(err, nil)
+	}
+}
+
+// Call the handler for the kind of the job, within the job timeout
+// A panic fails the attempt like an error would, and an unknown kind fails the job permanently
+func (app *application) callJobHandler(handlers map[string]jobHandler, job *data.Job) (err error) {
+	handler, ok := handlers[job.Kind]
+	if !ok {
+		return fmt.Errorf("%w: unknown job kind %q", errPermanentJob, job.Kind)
+	}
+
+	ctx, cancel := context.WithTimeout(app.jobsCtx, app.config.jobs.timeout)
+	defer cancel()
+
+	defer func() {
+		if rec := recover(); rec != nil {
+			err = fmt.Errorf("%s", rec)
+		}
+	}()
+
+	return handler(ctx, job.Payload)
+}
+
+// Periodic task which deletes the jobs that succeeded before the retention period
+func (app *application) pruneJobs() {
+	pruned, err := app.models.Jobs.Prune(app.config.jobs.retention)
+	if err != nil {
+		app.logger.PrintError(err, nil)
+		return
+	}
+
+	if pruned > 0 {
+		app.logger.PrintInfo("pruned jobs", map[string]string{
+			"count": strconv.FormatInt(pruned, 10),
+		})
+	}
+}
+
+// welcomeEmailJob is the payload of the job sending the welcome email to a new user
+type welcomeEmailJob struct {
+	UserID int64 `json:"user_id"`
+}
+
+// Send the welcome email, along with an activation token
+// The token is created by the job, so that its plaintext is never stored in the queue
+// A retry replaces the token sent by an earlier attempt, so that a user has a single activation token at a time
+// Every step gives up once the context is done, which lets the drain cancel the job on shutdown
+func (app *application) sendWelcomeEmail(ctx context.Context, job welcomeEmailJob) error {
+	user, err := app.models.Users.GetContext(ctx, job.UserID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			return fmt.Errorf("%w: %v", errPermanentJob, err)
+		default:
+			return err
+		}
+	}
+
+	// Nothing is left to do once the user is activated
+	if user.Activated {
+		return nil
+	}
+
+	// Create a new activation token for the user, revoking the ones sent before
+	token, err := app.models.Tokens.Replace(ctx, user.ID, 3*24*time.Hour, data.ScopeActivation)
+	if err != nil {
+		return err
+	}
+
+	// Define the data for the welcome email
+	data := map[string]any{
+		"activationToken": token.Plaintext,
+		"userID":          user.ID,
+	}
+
+	// Sending the welcome email
+	return app.mailer.SendContext(ctx, user.Email, "user_welcome.tmpl", data)
+}
+
+// listJobsHandler for the "GET /v1/jobs" endpoint
+// Dead jobs are listed with ?status=dead, to be looked into and retried
+func (app *application) listJobsHandler(w http.ResponseWriter, r *http.Request) {
+	// Declare an input struct to hold the expected data from the client (Resquest DTO)
+	var input struct {
+		Status string
+		Kind   string
+		data.Filters
+	}
+
+	// Validating the query string parameters
+	v := validator.New()
+	qs := r.URL.Query()
+
+	input.Status = app.readString(qs, "status", "")
+	input.Kind = app.readString(qs, "kind", "")
+	input.Filters.Page = app.readInt(qs, "page", 1, v)
+	input.Filters.PageSize = app.readInt(qs, "page_size", 20, v)
+
+	// Jobs are always ordered from the most recent
+	input.Filters.Sort = "-id"
+	input.Filters.SortSafelist = []string{"-id"}
+
+	if input.Status != "" {
+		v.Check(validator.In(input.Status, data.JobPending, data.JobSucceeded, data.JobDead), "status", "must be pending, succeeded or dead")
+	}
+
+	if data.ValidateFilters(v, input.Filters); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	// Retriving the jobs from the database
+	jobs, metadata, err := app.models.Jobs.GetAll(input.Status, input.Kind, input.Filters)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	// Return a 200 OK status code along with the jobs
+	err = app.writeJson(w, http.StatusOK, envelope{"jobs": jobs, "metadata": metadata}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// retryJobHandler for the "POST /v1/jobs/:id/retry" endpoint
+// Only dead jobs can be retried, and they are given a fresh set of attempts
+func (app *application) retryJobHandler(w http.ResponseWriter, r *http.Request) {
+	// Extract the id from the URL
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	// Queuing the job again
+	job, err := app.models.Jobs.Retry(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		case errors.Is(err, data.ErrDuplicateJob):
+			app.errorResponse(w, r, http.StatusConflict, "a pending job with the same unique key is already queued")
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	// Return a 202 Accepted status code along with the job, since it is run by a worker
+	err = app.writeJson(w, http.StatusAccepted, envelope{"job": job}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
@@ -12,9 +12,14 @@ import (
 
 	_ "github.com/lib/pq"
 
+	"moviego.madhav.net/internal/broadcast"
+	"moviego.madhav.net/internal/cache"
 	"moviego.madhav.net/internal/data"
 	"moviego.madhav.net/internal/logs"
 	"moviego.madhav.net/internal/mail"
+	"moviego.madhav.net/internal/presence"
+	"moviego.madhav.net/internal/storage"
+	"moviego.madhav.net/internal/webhook"
 )
 
 var (
@@ -32,9 +37,56 @@ type config struct {
 		maxIdleTime  string
 	}
 	limiter struct {
-		rps     float64
-		burst   int
-		enabled bool
+		rps               float64
+		burst             int
+		enabled           bool
+		autocompleteRPS   float64
+		autocompleteBurst int
+		commentRPS        float64
+		commentBurst      int
+	}
+	autocomplete struct {
+		cacheSize int
+		cacheTTL  time.Duration
+	}
+	stats struct {
+		cacheTTL time.Duration
+	}
+	imports struct {
+		maxBytes int64
+	}
+	images struct {
+		maxBytes   int64
+		maxDecodes int
+	}
+	storage struct {
+		dir     string
+		baseURL string
+	}
+	comments struct {
+		editWindow time.Duration
+	}
+	webhooks struct {
+		pollInterval time.Duration
+		timeout      time.Duration
+		maxAttempts  int
+		backoff      time.Duration
+	}
+	events struct {
+		retention time.Duration
+	}
+	jobs struct {
+		workers      int
+		pollInterval time.Duration
+		timeout      time.Duration
+		maxAttempts  int
+		backoff      time.Duration
+		drainTimeout time.Duration
+		retention    time.Duration
+	}
+	trash struct {
+		retention     time.Duration
+		purgeInterval time.Duration
 	}
 	smtp struct {
 		host     string
@@ -49,11 +101,22 @@ type config struct {
 }
 
 type application struct {
-	config config
-	logger *logs.Logger
-	models data.Models
-	mailer mail.Mailer
-	wg     sync.WaitGroup
+	config            config
+	logger            *logs.Logger
+	models            data.Models
+	mailer            mail.Mailer
+	wg                sync.WaitGroup
+	shutdown          chan struct{}
+	workers           sync.WaitGroup
+	jobsCtx           context.Context
+	cancelJobs        context.CancelFunc
+	storage           storage.Storage
+	webhooks          *webhook.Sender
+	movieEvents       *broadcast.Broker[*data.MovieEvent]
+	presence          *presence.Hub
+	imageDecodes      chan struct{}
+	autocompleteCache *cache.Cache[string, []*data.MovieSuggestion]
+	statsCache        *cache.Cache[string, *data.MovieStats]
 }
 
 func main() {
@@ -77,6 +140,17 @@ func main() {
 	flag.Float64Var(&cfg.limiter.rps, "limiter-rps", 2, "Rate limiter maximum requests per second")
 	flag.IntVar(&cfg.limiter.burst, "limiter-burst", 4, "Rate limiter maximum burst")
 	flag.BoolVar(&cfg.limiter.enabled, "limiter-enabled", true, "Rate limiter enabled")
+	flag.Float64Var(&cfg.limiter.autocompleteRPS, "limiter-autocomplete-rps", 1, "Rate limiter maximum autocomplete requests per second")
+	flag.IntVar(&cfg.limiter.autocompleteBurst, "limiter-autocomplete-burst", 3, "Rate limiter maximum autocomplete burst")
+	flag.Float64Var(&cfg.limiter.commentRPS, "limiter-comment-rps", 0.2, "Rate limiter maximum comments per second for each user")
+	flag.IntVar(&cfg.limiter.commentBurst, "limiter-comment-burst", 5, "Rate limiter maximum comment burst for each user")
+
+	// Autocomplete Settings Flags
+	flag.IntVar(&cfg.autocomplete.cacheSize, "autocomplete-cache-size", 1000, "Number of autocomplete prefixes to cache")
+	flag.DurationVar(&cfg.autocomplete.cacheTTL, "autocomplete-cache-ttl", time.Minute, "Time to live of cached autocomplete prefixes")
+
+	// Statistics Settings Flags
+	flag.DurationVar(&cfg.stats.cacheTTL, "stats-cache-ttl", 5*time.Minute, "Time to live of the cached catalogue statistics (0 disables caching)")
 
 	// SMTP Settings Flags
 	flag.StringVar(&cfg.smtp.host, "smtp-host", "smtp.mailtrap.io", "SMTP server hostname")
@@ -85,6 +159,42 @@ func main() {
 	flag.StringVar(&cfg.smtp.password, "smtp-password", "", "SMTP server password")
 	flag.StringVar(&cfg.smtp.sender, "smtp-sender", "", "SMTP sender email address")
 
+	// Import Settings Flags
+	flag.Int64Var(&cfg.imports.maxBytes, "import-max-bytes", 50*1_048_576, "Maximum size of a movie import body in bytes")
+
+	// Image Settings Flags
+	flag.Int64Var(&cfg.images.maxBytes, "image-max-bytes", 10*1_048_576, "Maximum size of an uploaded image in bytes")
+	flag.IntVar(&cfg.images.maxDecodes, "image-max-decodes", 4, "Maximum number of uploaded images decoded at once")
+
+	// Storage Settings Flags
+	flag.StringVar(&cfg.storage.dir, "storage-dir", "./uploads", "Directory for storing uploaded files")
+	flag.StringVar(&cfg.storage.baseURL, "storage-base-url", "/images", "Base URL the uploaded files are served from")
+
+	// Comment Settings Flags
+	flag.DurationVar(&cfg.comments.editWindow, "comment-edit-window", 15*time.Minute, "Time during which the author of a comment can edit it")
+
+	// Webhook Settings Flags
+	flag.DurationVar(&cfg.webhooks.pollInterval, "webhook-poll-interval", 5*time.Second, "Interval between checks for webhook deliveries which are due")
+	flag.DurationVar(&cfg.webhooks.timeout, "webhook-timeout", 10*time.Second, "Time a webhook receiver has to respond to a delivery")
+	flag.IntVar(&cfg.webhooks.maxAttempts, "webhook-max-attempts", 8, "Number of attempts of a webhook delivery before it is marked as failed")
+	flag.DurationVar(&cfg.webhooks.backoff, "webhook-backoff", 30*time.Second, "Wait before the first retry of a webhook delivery, doubled after each attempt")
+
+	// Event Stream Settings Flags
+	flag.DurationVar(&cfg.events.retention, "event-retention", 24*time.Hour, "Time movie events are kept for streams to resume from")
+
+	// Job Queue Settings Flags
+	flag.IntVar(&cfg.jobs.workers, "job-workers", 4, "Number of workers running queued jobs")
+	flag.DurationVar(&cfg.jobs.pollInterval, "job-poll-interval", time.Second, "Interval between checks for jobs which are due")
+	flag.DurationVar(&cfg.jobs.timeout, "job-timeout", time.Minute, "Time a job has to run before it is cancelled and retried")
+	flag.IntVar(&cfg.jobs.maxAttempts, "job-max-attempts", 10, "Number of attempts of a job before it is marked as dead")
+	flag.DurationVar(&cfg.jobs.backoff, "job-backoff", 10*time.Second, "Wait before the first retry of a job, doubled after each attempt")
+	flag.DurationVar(&cfg.jobs.drainTimeout, "job-drain-timeout", 10*time.Second, "Time the running jobs have to finish on shutdown before they are cancelled")
+	flag.DurationVar(&cfg.jobs.retention, "job-retention", 7*24*time.Hour, "Time succeeded jobs are kept for")
+
+	// Trash Settings Flags
+	flag.DurationVar(&cfg.trash.retention, "trash-retention", 30*24*time.Hour, "Time deleted movies are kept in the trash before being purged")
+	flag.DurationVar(&cfg.trash.purgeInterval, "trash-purge-interval", time.Hour, "Interval between purges of the trash")
+
 	// CORS Settings Flags
 	flag.Func("cors-trusted-origins", "CORS trusted origins (space separated)", func(val string) error {
 		cfg.cors.trustedOrigins = strings.Fields(val)
@@ -107,6 +217,21 @@ func main() {
 	// Initialize a new logger which writes messages to the standard outstream
 	logger := logs.New(os.Stdout, logs.LevelInfo)
 
+	// Checking the interval the trash is purged at, since a ticker can't tick at zero
+	if cfg.trash.purgeInterval <= 0 {
+		logger.PrintFatal(fmt.Errorf("invalid value %s for flag -trash-purge-interval: must be positive", cfg.trash.purgeInterval), nil)
+	}
+
+	// Checking the interval webhook deliveries are polled at, since a ticker can't tick at zero
+	if cfg.webhooks.pollInterval <= 0 {
+		logger.PrintFatal(fmt.Errorf("invalid value %s for flag -webhook-poll-interval: must be positive", cfg.webhooks.pollInterval), nil)
+	}
+
+	// Checking the interval the job workers poll the queue at, since a ticker can't tick at zero
+	if cfg.jobs.pollInterval <= 0 {
+		logger.PrintFatal(fmt.Errorf("invalid value %s for flag -job-poll-interval: must be positive", cfg.jobs.pollInterval), nil)
+	}
+
 	// Initialize a new connection pool, passing in the DSN from the config struct
 	db, err := openDB(cfg)
 	if err != nil {
@@ -117,14 +242,56 @@ func main() {
 	// Log a message to say that the connection pool has been successfully
 	logger.PrintInfo("database connection pool established", nil)
 
+	// Create the context of the running jobs, which is cancelled when they take too long to drain on shutdown
+	jobsCtx, cancelJobs := context.WithCancel(context.Background())
+	defer cancelJobs()
+
 	// Initialize a new instance of application containing the dependencies
 	app := &application{
 		config: cfg,
 		logger: logger,
 		models: data.NewModels(db),
 		mailer: mail.New(cfg.smtp.host, cfg.smtp.port, cfg.smtp.username, cfg.smtp.password, cfg.smtp.sender),
+
+		shutdown: make(chan struct{}),
+		storage:  storage.NewLocal(cfg.storage.dir, cfg.storage.baseURL),
+		webhooks: webhook.NewSender(cfg.webhooks.timeout),
+
+		jobsCtx:    jobsCtx,
+		cancelJobs: cancelJobs,
+
+		movieEvents: broadcast.New[*data.MovieEvent](64),
+		presence:    presence.NewHub(presenceClientBuffer),
+
+		imageDecodes: make(chan struct{}, cfg.images.maxDecodes),
+
+		autocompleteCache: cache.New[string, []*data.MovieSuggestion](cfg.autocomplete.cacheSize, cfg.autocomplete.cacheTTL),
+		statsCache:        cache.New[string, *data.MovieStats](1, cfg.stats.cacheTTL),
 	}
 
+	// Failing the imports lost when an instance stopped, once at startup and then periodically, since any instance can stop
+	app.failStaleImports()
+
+	// Start the periodic background tasks, which run until the server shuts down
+	app.periodic(time.Hour, app.failStaleImports)
+	app.periodic(cfg.trash.purgeInterval, app.purgeTrash)
+	app.periodic(cfg.webhooks.pollInterval, app.deliverWebhooks)
+	app.periodic(time.Hour, app.pruneMovieEvents)
+	app.periodic(time.Hour, app.pruneJobs)
+	app.periodic(time.Hour, app.pruneTokens)
+
+	// Start the workers running the queued jobs, which are drained when the server shuts down
+	app.startJobWorkers()
+
+	// Start listening for the movie events of every API instance
+	app.listenMovieEvents()
+
+	// Start passing the saves of movies on to their editors
+	app.watchMovieVersions()
+
+	// Start sharing the editors of movies with the other API instances
+	app.listenPresence()
+
 	// Start the HTTP server
 	err = app.serve()
 	if err != nil {
@@ -11,6 +11,7 @@ import (
 	"time"
 
 	"github.com/felixge/httpsnoop"
+	"github.com/gorilla/websocket"
 	"github.com/tomasen/realip"
 	"golang.org/x/time/rate"
 	"moviego.madhav.net/internal/data"
@@ -36,8 +37,43 @@ func (app *application) recoverPanic(next http.Handler) http.Handler {
 	})
 }
 
-// Middleware for rate limiting
+// Paths which are limited by a budget of their own rather than the global one, see routes()
+// A user typing into the search box would otherwise run through the global budget of the whole API
+var ownBudgetPaths = map[string]bool{
+	"/v1/movies/autocomplete": true,
+}
+
+// Middleware for rate limiting, using the global budget from the limiter config
 func (app *application) rateLimit(next http.Handler) http.Handler {
+	limited := app.rateLimitWith(app.config.limiter.rps, app.config.limiter.burst, next)
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Leaving the paths with a budget of their own to it
+		if ownBudgetPaths[r.URL.Path] {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		limited.ServeHTTP(w, r)
+	})
+}
+
+// Middleware for rate limiting with the given budget for each client IP address
+// Every call keeps its own set of clients, so a route can be given a budget separate from the global one
+func (app *application) rateLimitWith(rps float64, burst int, next http.Handler) http.Handler {
+	return app.rateLimitBy(rps, burst, realip.FromRequest, next)
+}
+
+// Middleware for rate limiting with the given budget for each authenticated user
+// It must run after the authenticate middleware, and anonymous users share a single budget
+func (app *application) rateLimitUser(rps float64, burst int, next http.Handler) http.Handler {
+	return app.rateLimitBy(rps, burst, func(r *http.Request) string {
+		return fmt.Sprintf("user:%d", app.contextGetUser(r).ID)
+	}, next)
+}
+
+// Middleware for rate limiting with the given budget for each client, as identified by the key function
+func (app *application) rateLimitBy(rps float64, burst int, key func(r *http.Request) string, next http.Handler) http.Handler {
 	// Declare a client struct to hold the rate limiter and last seen time for each client
 	type client struct {
 		limiter  *rate.Limiter
@@ -73,9 +109,9 @@ func (app *application) rateLimit(next http.Handler) http.Handler {
 	// Return a closure over the limiter
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		//Check if rate limiting is enabled
-		if !app.config.limiter.enabled {
-			// Using the realip package to retrieve the client's real IP address
-			ip := realip.FromRequest(r)
+		if app.config.limiter.enabled {
+			// Identifying the client, by default through its real IP address
+			ip := key(r)
 
 			// Locking the mutex to prevent this code from being executed concurrently
 			mu.Lock()
@@ -83,7 +119,7 @@ func (app *application) rateLimit(next http.Handler) http.Handler {
 			// Checking to see if the IP address already exists in the map, initializing one if not
 			if _, ok := clients[ip]; !ok {
 				clients[ip] = &client{
-					limiter: rate.NewLimiter(rate.Limit(app.config.limiter.rps), app.config.limiter.burst),
+					limiter: rate.NewLimiter(rate.Limit(rps), burst),
 				}
 			}
 			// Updating the last seen time for the client
@@ -115,6 +151,35 @@ func (app *application) authenticate(next http.Handler) http.Handler {
 		// Extracting the value of the Authorization header from the request
 		authorizationHeader := r.Header.Get("Authorization")
 
+		// Browsers can't set headers on a WebSocket handshake, so it carries a ticket in the query string instead
+		// Tickets are short lived and single use, so one which ends up in a log is of no use to anyone reading it
+		if authorizationHeader == "" && websocket.IsWebSocketUpgrade(r) && r.URL.Query().Has("ticket") {
+			// Retrieving the ticket from the query string and performing validation
+			ticket := r.URL.Query().Get("ticket")
+			v := validator.New()
+			if data.ValidateTokenPlaintext(v, ticket); !v.Valid() {
+				app.invalidAuthenticationTokenResponse(w, r)
+				return
+			}
+
+			// Retrieving the details of the user from the ticket, which can't be used again
+			user, err := app.models.Users.ConsumeToken(data.ScopeWebSocket, ticket)
+			if err != nil {
+				switch {
+				case errors.Is(err, data.ErrRecordNotFound):
+					app.invalidAuthenticationTokenResponse(w, r)
+				default:
+					app.serverErrorResponse(w, r, err)
+				}
+				return
+			}
+
+			// Adding the user details to the request context and calling the next handler in the chain
+			r = app.contextSetUser(r, user)
+			next.ServeHTTP(w, r)
+			return
+		}
+
 		// If there is no Authorization header found, use the contextSetUser() method to set the AnonymousUser in the request context and call the next handler in the chain and return
 		if authorizationHeader == "" {
 			r = app.contextSetUser(r, data.AnonymousUser)
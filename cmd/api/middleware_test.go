@@ -0,0 +1,49 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestRateLimitOwnBudgetPaths(t *testing.T) {
+	tests := []struct {
+		name string
+		path string
+		want []int // Status codes of consecutive requests from the same client
+	}{
+		{
+			name: "Global budget",
+			path: "/v1/movies",
+			want: []int{http.StatusOK, http.StatusTooManyRequests},
+		},
+		{
+			name: "Own budget",
+			path: "/v1/movies/autocomplete",
+			want: []int{http.StatusOK, http.StatusOK, http.StatusOK},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Allowing a single request at a time through the global budget
+			app := newTestApplication()
+			app.config.limiter.enabled = true
+			app.config.limiter.rps = 0.001
+			app.config.limiter.burst = 1
+
+			handler := app.rateLimit(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusOK)
+			}))
+
+			for i, want := range tt.want {
+				rr := httptest.NewRecorder()
+				handler.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, tt.path, nil))
+
+				if rr.Code != want {
+					t.Errorf("request %d: got status %d; want %d", i+1, rr.Code, want)
+				}
+			}
+		})
+	}
+}
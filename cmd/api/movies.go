@@ -4,7 +4,9 @@ import (
 	"errors"
 	"fmt"
 	"net/http"
+	"net/url"
 	"strconv"
+	"strings"
 
 	"moviego.madhav.net/internal/data"
 	"moviego.madhav.net/internal/validator"
@@ -14,10 +16,11 @@ import (
 func (app *application) createMovieHandler(w http.ResponseWriter, r *http.Request) {
 	// Declare an input struct to hold the expected data from the client (Resquest DTO)
 	var input struct {
-		Title   *string  `json:"title"`
-		Year    *int32   `json:"year"`
-		Runtime *int32   `json:"runtime"`
-		Genres  []string `json:"genres"`
+		Title       *string           `json:"title"`
+		Year        *int32            `json:"year"`
+		Runtime     *int32            `json:"runtime"`
+		Genres      []string          `json:"genres"`
+		ExternalIDs map[string]string `json:"external_ids"`
 	}
 
 	// Decode the request body into the input struct
@@ -29,14 +32,16 @@ func (app *application) createMovieHandler(w http.ResponseWriter, r *http.Reques
 
 	//Intermediary input for validation
 	movie := &data.Movie{
-		Title:   input.Title,
-		Year:    input.Year,
-		Runtime: input.Runtime,
-		Genres:  input.Genres,
+		Title:       input.Title,
+		Year:        input.Year,
+		Runtime:     input.Runtime,
+		Genres:      input.Genres,
+		ExternalIDs: input.ExternalIDs,
 	}
 	// Validate the input
 	v := validator.New()
-	if data.ValidateMovie(v, movie); !v.Valid() {
+	data.ValidateMovie(v, movie)
+	if data.ValidateExternalIDs(v, movie.ExternalIDs); !v.Valid() {
 		app.failedValidationResponse(w, r, v.Errors)
 		return
 	}
@@ -44,7 +49,13 @@ func (app *application) createMovieHandler(w http.ResponseWriter, r *http.Reques
 	// Insert the movie into the database using the movie model
 	err = app.models.Movies.Insert(movie)
 	if err != nil {
-		app.serverErrorResponse(w, r, err)
+		switch {
+		case errors.Is(err, data.ErrDuplicateExternalID):
+			v.AddError("external_ids", "already belong to another movie")
+			app.failedValidationResponse(w, r, v.Errors)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
 		return
 	}
 
@@ -74,15 +85,49 @@ func (app *application) showMovieHandler(w http.ResponseWriter, r *http.Request)
 	if err != nil {
 		switch {
 		case errors.Is(err, data.ErrRecordNotFound):
-			app.notFoundResponse(w, r)
+			app.movieNotFoundResponse(w, r, id)
 		default:
 			app.serverErrorResponse(w, r, err)
 		}
 		return
 	}
 
+	// Localizing the movie to the languages preferred by the client
+	movie.Localize(app.readLanguages(r))
+
+	headers := make(http.Header)
+	headers.Set("Vary", "Accept-Language")
+	if movie.Language != "" {
+		headers.Set("Content-Language", movie.Language)
+	}
+
 	// Return a 200 OK status code along with the movie data
-	err = app.writeJson(w, http.StatusOK, envelope{"movie": movie}, nil)
+	err = app.writeJson(w, http.StatusOK, envelope{"movie": movie}, headers)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// Respond to a request for a movie which doesn't exist
+// Movies which were merged into another movie are redirected to it, everything else is not found
+func (app *application) movieNotFoundResponse(w http.ResponseWriter, r *http.Request, id int64) {
+	movieID, err := app.models.Movies.ResolveAlias(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	// Add a Location header to the response containing the URL of the surviving movie
+	headers := make(http.Header)
+	headers.Set("Location", fmt.Sprintf("/v1/movies/%d", movieID))
+
+	// Return a 301 Moved Permanently status code
+	err = app.writeJson(w, http.StatusMovedPermanently, envelope{"message": "movie was merged into another movie"}, headers)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 	}
@@ -119,10 +164,11 @@ func (app *application) updateMovieHandler(w http.ResponseWriter, r *http.Reques
 
 	// Declare an input struct to hold the expected data from the client (Resquest DTO)
 	var input struct {
-		Title   *string  `json:"title"`
-		Year    *int32   `json:"year"`
-		Runtime *int32   `json:"runtime"`
-		Genres  []string `json:"genres"`
+		Title       *string           `json:"title"`
+		Year        *int32            `json:"year"`
+		Runtime     *int32            `json:"runtime"`
+		Genres      []string          `json:"genres"`
+		ExternalIDs map[string]string `json:"external_ids"`
 	}
 
 	// Decode the request body into the input struct
@@ -146,9 +192,20 @@ func (app *application) updateMovieHandler(w http.ResponseWriter, r *http.Reques
 		movie.Genres = input.Genres
 	}
 
+	// Merging the provided external ids into the existing ones, an empty id removes the provider
+	if input.ExternalIDs != nil {
+		if movie.ExternalIDs == nil {
+			movie.ExternalIDs = make(map[string]string)
+		}
+		for provider, id := range input.ExternalIDs {
+			movie.ExternalIDs[provider] = id
+		}
+	}
+
 	// Validate the input
 	v := validator.New()
-	if data.ValidateMovie(v, movie); !v.Valid() {
+	data.ValidateMovie(v, movie)
+	if data.ValidateExternalIDs(v, movie.ExternalIDs); !v.Valid() {
 		app.failedValidationResponse(w, r, v.Errors)
 		return
 	}
@@ -157,6 +214,9 @@ func (app *application) updateMovieHandler(w http.ResponseWriter, r *http.Reques
 	err = app.models.Movies.Update(movie)
 	if err != nil {
 		switch {
+		case errors.Is(err, data.ErrDuplicateExternalID):
+			v.AddError("external_ids", "already belong to another movie")
+			app.failedValidationResponse(w, r, v.Errors)
 		case errors.Is(err, data.ErrEditConflict):
 			app.editConflictResponse(w, r)
 		default:
@@ -200,42 +260,250 @@ func (app *application) deleteMovieHandler(w http.ResponseWriter, r *http.Reques
 	}
 }
 
+// Declare a movieFilters struct to hold the query string filters shared by the movie listing endpoints
+type movieFilters struct {
+	Title    string
+	Genres   []string
+	Fuzzy    bool
+	Releases data.ReleaseFilter
+	data.Filters
+}
+
+// method to read the movie listing filters from the query string
+func (app *application) readMovieFilters(qs url.Values, v *validator.Validator) movieFilters {
+	var filters movieFilters
+
+	filters.Title = app.readString(qs, "title", "")
+	filters.Genres = app.readCSV(qs, "genres", []string{})
+	filters.Fuzzy = app.readBool(qs, "fuzzy", false, v)
+
+	// Reading the release filters, which narrow the movies down to those released in a country
+	filters.Releases.Country = app.readString(qs, "released_in", "")
+	filters.Releases.CertificationMax = app.readString(qs, "certification_max", "")
+
+	filters.Filters.Page = app.readInt(qs, "page", 1, v)
+	filters.Filters.PageSize = app.readInt(qs, "page_size", 20, v)
+
+	filters.Filters.Sort = app.readString(qs, "sort", "id")
+	filters.Filters.SortSafelist = []string{"id", "title", "year", "runtime", "relevance", "-id", "-title", "-year", "-runtime", "-relevance"}
+
+	// Reading the opaque cursor for keyset pagination, which takes precedence over the page parameter
+	filters.Filters.Cursor = app.readString(qs, "cursor", "")
+
+	// Relevance is measured against the title search term, so sorting by it needs one
+	if filters.Filters.Sort == "relevance" || filters.Filters.Sort == "-relevance" {
+		v.Check(filters.Title != "", "sort", "relevance sort requires a title")
+	}
+
+	data.ValidateReleaseFilter(v, filters.Releases)
+	data.ValidateFilters(v, filters.Filters)
+
+	return filters
+}
+
 // listMoviesHandler for the "GET /v1/movies" endpoint
 func (app *application) listMoviesHandler(w http.ResponseWriter, r *http.Request) {
 	// Declare an input struct to hold the expected data from the client (Resquest DTO)
 	var input struct {
-		Title  string
-		Genres []string
-		data.Filters
+		movieFilters
+		Facets []string
 	}
 
 	// Validating the query string parameters
 	v := validator.New()
 	qs := r.URL.Query()
 
-	input.Title = app.readString(qs, "title", "")
-	input.Genres = app.readCSV(qs, "genres", []string{})
+	input.movieFilters = app.readMovieFilters(qs, v)
+	input.Facets = app.readCSV(qs, "facets", []string{})
+
+	if data.ValidateFacets(v, input.Facets); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	// Retriving the movies from the database, based on the filters
+	movies, metadata, err := app.models.Movies.GetAll(input.Title, input.Genres, input.Fuzzy, input.Releases, input.Filters)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	// Localizing the movies to the languages preferred by the client
+	languages := app.readLanguages(r)
+	for _, movie := range movies {
+		movie.Localize(languages)
+	}
+
+	env := envelope{"movies": movies, "metadata": metadata}
+
+	// Counting the requested facets over the same filtered movies
+	if len(input.Facets) > 0 {
+		facets, err := app.models.Movies.GetFacets(input.Title, input.Genres, input.Fuzzy, input.Releases, input.Facets)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
 
-	input.Filters.Page = app.readInt(qs, "page", 1, v)
-	input.Filters.PageSize = app.readInt(qs, "page_size", 20, v)
+		env["facets"] = facets
+	}
 
-	input.Filters.Sort = app.readString(qs, "sort", "id")
-	input.Filters.SortSafelist = []string{"id", "title", "year", "runtime", "-id", "-title", "-year", "-runtime"}
+	headers := make(http.Header)
+	headers.Set("Vary", "Accept-Language")
+
+	// Return a 200 OK status code along with the movie data
+	err = app.writeJson(w, http.StatusOK, env, headers)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// autocompleteMoviesHandler for the "GET /v1/movies/autocomplete" endpoint
+func (app *application) autocompleteMoviesHandler(w http.ResponseWriter, r *http.Request) {
+	// Declare an input struct to hold the expected data from the client (Resquest DTO)
+	var input struct {
+		Query string
+		Limit int
+	}
+
+	// Validating the query string parameters
+	v := validator.New()
+	qs := r.URL.Query()
+
+	input.Query = strings.TrimSpace(app.readString(qs, "q", ""))
+	input.Limit = app.readInt(qs, "limit", 10, v)
+
+	v.Check(input.Query != "", "q", "must be provided")
+	v.Check(len(input.Query) <= 100, "q", "must not be more than 100 bytes long")
+	v.Check(input.Limit > 0, "limit", "must be greater than zero")
+	v.Check(input.Limit <= 20, "limit", "must be a maximum of 20")
 
 	if !v.Valid() {
 		app.failedValidationResponse(w, r, v.Errors)
 		return
 	}
 
-	// Retriving the movies from the database, based on the filters
-	movies, metadata, err := app.models.Movies.GetAll(input.Title, input.Genres, input.Filters)
+	// Serving recently requested prefixes from the cache, which is keyed case insensitively
+	// The cache is cleared by the movie event listener whenever the movies change, see listenMovieEvents
+	key := fmt.Sprintf("%d:%s", input.Limit, strings.ToLower(input.Query))
+	suggestions, ok := app.autocompleteCache.Get(key)
+	if !ok {
+		// Retriving the suggestions from the database
+		var err error
+		suggestions, err = app.models.Movies.Autocomplete(input.Query, input.Limit)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+
+		app.autocompleteCache.Set(key, suggestions)
+	}
+
+	// Return a 200 OK status code along with the suggestions
+	err := app.writeJson(w, http.StatusOK, envelope{"suggestions": suggestions}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// movieStatsHandler for the "GET /v1/movies/stats" endpoint
+func (app *application) movieStatsHandler(w http.ResponseWriter, r *http.Request) {
+	// Serving the statistics from the cache, entries expire immediately when caching is disabled
+	stats, ok := app.statsCache.Get("stats")
+	if !ok {
+		// Aggregating the statistics from the database
+		var err error
+		stats, err = app.models.Movies.GetStats()
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+
+		app.statsCache.Set("stats", stats)
+	}
+
+	// Return a 200 OK status code along with the statistics
+	err := app.writeJson(w, http.StatusOK, envelope{"stats": stats}, nil)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// lookupMovieHandler for the "GET /v1/movies/lookup" endpoint
+// The movie is found by its id in an outside dataset, such as ?provider=imdb&id=tt0111161
+func (app *application) lookupMovieHandler(w http.ResponseWriter, r *http.Request) {
+	// Declare an input struct to hold the expected data from the client (Resquest DTO)
+	var input struct {
+		Provider string
+		ID       string
+	}
+
+	// Validating the query string parameters
+	v := validator.New()
+	qs := r.URL.Query()
+
+	input.Provider = app.readString(qs, "provider", "")
+	input.ID = app.readString(qs, "id", "")
+
+	v.Check(input.Provider != "", "provider", "must be provided")
+	v.Check(input.ID != "", "id", "must be provided")
+	if data.ValidateExternalIDs(v, map[string]string{input.Provider: input.ID}); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	// Retriving the movie which has the external id
+	movie, err := app.models.Movies.Lookup(input.Provider, input.ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
 		return
 	}
 
 	// Return a 200 OK status code along with the movie data
-	err = app.writeJson(w, http.StatusOK, envelope{"movies": movies, "metadata": metadata}, nil)
+	err = app.writeJson(w, http.StatusOK, envelope{"movie": movie}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// similarMoviesHandler for the "GET /v1/movies/:id/similar" endpoint
+func (app *application) similarMoviesHandler(w http.ResponseWriter, r *http.Request) {
+	// Extract the id from the URL
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	// Validating the query string parameters
+	v := validator.New()
+	limit := app.readInt(r.URL.Query(), "limit", 10, v)
+
+	v.Check(limit > 0, "limit", "must be greater than zero")
+	v.Check(limit <= 50, "limit", "must be a maximum of 50")
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	// Retriving the similar movies from the database
+	similar, err := app.models.Movies.GetSimilar(id, limit)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.movieNotFoundResponse(w, r, id)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	// Return a 200 OK status code along with the similar movies
+	err = app.writeJson(w, http.StatusOK, envelope{"similar": similar}, nil)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 	}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"moviego.madhav.net/internal/cache"
+	"moviego.madhav.net/internal/data"
+	"moviego.madhav.net/internal/logs"
+)
+
+// Return an application backed by the mock models, for testing the handlers
+func newTestApplication() *application {
+	return &application{
+		logger:     logs.New(io.Discard, logs.LevelInfo),
+		models:     data.NewMockModels(),
+		statsCache: cache.New[string, *data.MovieStats](1, time.Minute),
+	}
+}
+
+func TestMovieStatsHandler(t *testing.T) {
+	tests := []struct {
+		name   string
+		cached *data.MovieStats // Statistics already in the cache, if any
+		want   data.MovieStats
+	}{
+		{
+			name: "From the model",
+			want: data.MovieStats{
+				ByGenre:         []data.FacetCount{},
+				ByYear:          []data.FacetCount{},
+				ByDecade:        []data.FacetCount{},
+				RecentAdditions: []data.FacetCount{},
+			},
+		},
+		{
+			name:   "From the cache",
+			cached: &data.MovieStats{TotalMovies: 3, AverageRuntime: 112.5},
+			want:   data.MovieStats{TotalMovies: 3, AverageRuntime: 112.5},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := newTestApplication()
+			if tt.cached != nil {
+				app.statsCache.Set("stats", tt.cached)
+			}
+
+			rr := httptest.NewRecorder()
+			app.movieStatsHandler(rr, httptest.NewRequest(http.MethodGet, "/v1/movies/stats", nil))
+
+			if rr.Code != http.StatusOK {
+				t.Fatalf("got status %d; want %d", rr.Code, http.StatusOK)
+			}
+			if contentType := rr.Header().Get("Content-Type"); contentType != "application/json" {
+				t.Errorf("got Content-Type %q; want %q", contentType, "application/json")
+			}
+
+			var body struct {
+				Stats *data.MovieStats `json:"stats"`
+			}
+			err := json.NewDecoder(rr.Body).Decode(&body)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if body.Stats == nil {
+				t.Fatal("got no stats in the body")
+			}
+
+			// Comparing through JSON, so that empty and missing lists are told apart
+			got, _ := json.Marshal(body.Stats)
+			want, _ := json.Marshal(tt.want)
+			if string(got) != string(want) {
+				t.Errorf("got %s; want %s", got, want)
+			}
+
+			// The statistics are cached for the next request
+			if _, ok := app.statsCache.Get("stats"); !ok {
+				t.Error("got no cached statistics after the request")
+			}
+		})
+	}
+}
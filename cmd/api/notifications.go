@@ -0,0 +1,211 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"moviego.madhav.net/internal/data"
+	"moviego.madhav.net/internal/validator"
+)
+
+// listNotificationsHandler for the "GET /v1/users/me/notifications" endpoint
+// Only the unread notifications are listed when the unread query string parameter is true
+func (app *application) listNotificationsHandler(w http.ResponseWriter, r *http.Request) {
+	// Declare an input struct to hold the expected data from the client (Resquest DTO)
+	var input struct {
+		Unread bool
+		data.Filters
+	}
+
+	// Validating the query string parameters
+	v := validator.New()
+	qs := r.URL.Query()
+
+	input.Unread = app.readBool(qs, "unread", false, v)
+	input.Filters.Page = app.readInt(qs, "page", 1, v)
+	input.Filters.PageSize = app.readInt(qs, "page_size", 20, v)
+
+	// Notifications are always ordered from the most recent
+	input.Filters.Sort = "-id"
+	input.Filters.SortSafelist = []string{"-id"}
+
+	if data.ValidateFilters(v, input.Filters); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	// Retriving the notifications of the authenticated user
+	notifications, metadata, err := app.models.Notifications.GetForUser(app.contextGetUser(r).ID, input.Unread, input.Filters)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	// Return a 200 OK status code along with the notifications
+	err = app.writeJson(w, http.StatusOK, envelope{"notifications": notifications, "metadata": metadata}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// unreadNotificationsHandler for the "GET /v1/users/me/notifications/unread" endpoint
+func (app *application) unreadNotificationsHandler(w http.ResponseWriter, r *http.Request) {
+	// Counting the unread notifications of the authenticated user
+	count, err := app.models.Notifications.CountUnread(app.contextGetUser(r).ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	// Return a 200 OK status code along with the count
+	err = app.writeJson(w, http.StatusOK, envelope{"unread": count}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// readNotificationHandler for the "POST /v1/notifications/:id/read" endpoint
+func (app *application) readNotificationHandler(w http.ResponseWriter, r *http.Request) {
+	// Extract the id from the URL
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	// Marking the notification as read, which fails when it belongs to another user
+	err = app.models.Notifications.MarkRead(id, app.contextGetUser(r).ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	// Return a 200 OK status code along with a success message
+	err = app.writeJson(w, http.StatusOK, envelope{"message": "notification marked as read"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// readAllNotificationsHandler for the "POST /v1/users/me/notifications/read" endpoint
+func (app *application) readAllNotificationsHandler(w http.ResponseWriter, r *http.Request) {
+	// Marking every unread notification of the authenticated user as read
+	count, err := app.models.Notifications.MarkAllRead(app.contextGetUser(r).ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	// Return a 200 OK status code along with the number of notifications marked
+	err = app.writeJson(w, http.StatusOK, envelope{"marked": count}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// showNotificationPreferencesHandler for the "GET /v1/users/me/notification_preferences" endpoint
+func (app *application) showNotificationPreferencesHandler(w http.ResponseWriter, r *http.Request) {
+	// Retriving the preferences of the authenticated user
+	preferences, err := app.models.NotificationPreferences.GetForUser(app.contextGetUser(r).ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	// Return a 200 OK status code along with the preferences
+	err = app.writeJson(w, http.StatusOK, envelope{"preferences": preferences}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// updateNotificationPreferencesHandler for the "PUT /v1/users/me/notification_preferences" endpoint
+// The kinds which aren't given keep their current preference
+func (app *application) updateNotificationPreferencesHandler(w http.ResponseWriter, r *http.Request) {
+	// Declare an input struct to hold the expected data from the client (Resquest DTO)
+	var input struct {
+		Preferences []*data.NotificationPreference `json:"preferences"`
+	}
+
+	// Decode the request body into the input struct
+	err := app.readJson(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	// Validate the input
+	v := validator.New()
+	if data.ValidateNotificationPreferences(v, input.Preferences); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	// Storing the preferences
+	user := app.contextGetUser(r)
+	err = app.models.NotificationPreferences.Upsert(user.ID, input.Preferences)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	// Retriving every preference of the user, including the ones left unchanged
+	preferences, err := app.models.NotificationPreferences.GetForUser(user.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	// Return a 200 OK status code along with the preferences
+	err = app.writeJson(w, http.StatusOK, envelope{"preferences": preferences}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// Notify a user as a background task, through the channels they chose for the kind of notification
+// The email uses the template named after the kind, with the name of the user added to the data
+func (app *application) notify(userID int64, kind string, details map[string]any) {
+	app.background(func() {
+		props := map[string]string{"user_id": fmt.Sprint(userID), "kind": kind}
+
+		preference, err := app.models.NotificationPreferences.Get(userID, kind)
+		if err != nil {
+			app.logger.PrintError(err, props)
+			return
+		}
+
+		// Storing the notification for the app
+		if preference.InApp {
+			err = app.models.Notifications.Insert(&data.Notification{UserID: userID, Kind: kind, Data: details})
+			if err != nil {
+				app.logger.PrintError(err, props)
+			}
+		}
+
+		// Sending the email
+		if preference.Email {
+			user, err := app.models.Users.Get(userID)
+			if err != nil {
+				app.logger.PrintError(err, props)
+				return
+			}
+
+			data := map[string]any{"name": user.Name}
+			for key, value := range details {
+				data[key] = value
+			}
+
+			err = app.mailer.Send(user.Email, kind+".tmpl", data)
+			if err != nil {
+				app.logger.PrintError(err, props)
+			}
+		}
+	})
+}
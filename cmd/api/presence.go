@@ -0,0 +1,350 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/lib/pq"
+	"moviego.madhav.net/internal/data"
+	"moviego.madhav.net/internal/presence"
+)
+
+// Timings of the presence connections
+const (
+	presenceWriteWait  = 10 * time.Second     // Time allowed to write a message
+	presencePongWait   = 60 * time.Second     // Time allowed to read the next pong, or any other message
+	presencePingPeriod = presencePongWait / 2 // Interval between the pings, which must be less than the pong wait
+)
+
+// Maximum size in bytes of a message from a client
+const presenceReadLimit = 4096
+
+// Number of messages queued for a client before it is considered too slow and disconnected
+const presenceClientBuffer = 32
+
+// Time a ticket for opening a presence connection can be used for
+const presenceTicketTTL = 30 * time.Second
+
+// Timings of the presence shared between the API instances
+const (
+	presenceAnnouncePeriod = 30 * time.Second           // Interval at which an instance announces all its editors again
+	presenceRemoteTTL      = 3 * presenceAnnouncePeriod // Time the editors of another instance are kept without being announced again
+)
+
+// Types of message the clients send
+const (
+	presenceJoin  = "join"
+	presenceLeave = "leave"
+)
+
+// createPresenceTicketHandler for the "POST /v1/presence/tickets" endpoint
+// Browsers can't send the Authorization header on a WebSocket handshake, so they first get a ticket here and open
+// the connection with ?ticket=<ticket>. A ticket only opens a single connection, within a short time
+func (app *application) createPresenceTicketHandler(w http.ResponseWriter, r *http.Request) {
+	user := app.contextGetUser(r)
+
+	// Create a new ticket for the user
+	ticket, err := app.models.Tokens.New(user.ID, presenceTicketTTL, data.ScopeWebSocket)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	// Return a 201 Created status code along with the ticket
+	err = app.writeJson(w, http.StatusCreated, envelope{"presence_ticket": ticket}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// presenceHandler for the "GET /v1/presence" endpoint
+// Clients authenticate with the Authorization header, or with a ticket from "POST /v1/presence/tickets"
+// The connection is upgraded to a WebSocket, on which the client sends {"type":"join","movie_id":1,"version":2}
+// when it opens a movie for editing and {"type":"leave","movie_id":1} when it closes it. Everyone editing a movie
+// is sent the list of its editors whenever it changes, and a notice when the movie is saved or deleted
+// Each instance keeps the editors connected to it in memory, and announces them to the other instances through
+// Postgres NOTIFY whenever they change, while the notices reach every instance through the movie events
+func (app *application) presenceHandler(w http.ResponseWriter, r *http.Request) {
+	upgrader := websocket.Upgrader{
+		CheckOrigin: app.checkWebSocketOrigin,
+	}
+
+	// Upgrading the connection, the upgrader sends the error response itself when it fails
+	conn, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		return
+	}
+
+	user := app.contextGetUser(r)
+	client := app.presence.Register(presence.Editor{UserID: user.ID, Name: user.Name})
+	defer func() {
+		for _, movieID := range app.presence.Unregister(client) {
+			app.announcePresence(app.presence.Announce(movieID))
+		}
+	}()
+
+	// The writer owns the writes to the connection, and closes it once the client is closed
+	go app.writePresence(conn, client)
+
+	// Dropping the connection when neither a message nor a pong arrives in time
+	conn.SetReadLimit(presenceReadLimit)
+	conn.SetReadDeadline(time.Now().Add(presencePongWait))
+	conn.SetPongHandler(func(string) error {
+		return conn.SetReadDeadline(time.Now().Add(presencePongWait))
+	})
+
+	// Reading the messages of the client until the connection is closed
+	for {
+		var input struct {
+			Type    string `json:"type"`
+			MovieID int64  `json:"movie_id"`
+			Version int32  `json:"version"`
+		}
+
+		err := conn.ReadJSON(&input)
+		if err != nil {
+			// A message which isn't valid JSON is rejected, anything else means the connection is gone
+			var syntaxError *json.SyntaxError
+			var unmarshalTypeError *json.UnmarshalTypeError
+			if errors.As(err, &syntaxError) || errors.As(err, &unmarshalTypeError) {
+				app.presence.Send(client, presence.Message{Type: presence.TypeError, Error: "message must be a valid JSON object"})
+				conn.SetReadDeadline(time.Now().Add(presencePongWait))
+				continue
+			}
+			return
+		}
+		conn.SetReadDeadline(time.Now().Add(presencePongWait))
+
+		switch input.Type {
+		case presenceJoin:
+			// Checking that the movie exists before joining it
+			movie, err := app.models.Movies.Get(input.MovieID)
+			if err != nil {
+				switch {
+				case errors.Is(err, data.ErrRecordNotFound):
+					app.presence.Send(client, presence.Message{Type: presence.TypeError, MovieID: input.MovieID, Error: "movie not found"})
+				default:
+					app.logError(r, err)
+					app.presence.Send(client, presence.Message{Type: presence.TypeError, MovieID: input.MovieID, Error: "the server could not look up the movie"})
+				}
+				continue
+			}
+
+			app.presence.Join(client, movie.ID)
+			app.announcePresence(app.presence.Announce(movie.ID))
+
+			// Warning the client straight away when the version it opened is already outdated
+			if input.Version != 0 && input.Version != movie.Version {
+				app.presence.Send(client, presence.Message{Type: presence.TypeVersion, MovieID: movie.ID, Version: movie.Version})
+			}
+
+		case presenceLeave:
+			if app.presence.Leave(client, input.MovieID) {
+				app.announcePresence(app.presence.Announce(input.MovieID))
+			}
+
+		default:
+			app.presence.Send(client, presence.Message{Type: presence.TypeError, Error: `type must be "join" or "leave"`})
+		}
+	}
+}
+
+// Write the messages queued for the client to the connection, pinging it in between
+// Once the client is closed, by the reader, for being too slow or by the shutdown, the connection is closed too
+func (app *application) writePresence(conn *websocket.Conn, client *presence.Client) {
+	ticker := time.NewTicker(presencePingPeriod)
+	defer func() {
+		ticker.Stop()
+		conn.Close()
+	}()
+
+	for {
+		select {
+		case msg, ok := <-client.Messages():
+			conn.SetWriteDeadline(time.Now().Add(presenceWriteWait))
+			if !ok {
+				conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseGoingAway, ""))
+				return
+			}
+
+			if conn.WriteJSON(msg) != nil {
+				return
+			}
+
+		case <-ticker.C:
+			conn.SetWriteDeadline(time.Now().Add(presenceWriteWait))
+			if conn.WriteMessage(websocket.PingMessage, nil) != nil {
+				return
+			}
+		}
+	}
+}
+
+// Check the origin of a WebSocket handshake, which isn't covered by CORS
+// Requests without an origin don't come from a browser, and same origin requests are always allowed
+func (app *application) checkWebSocketOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+
+	u, err := url.Parse(origin)
+	if err == nil && u.Host == r.Host {
+		return true
+	}
+
+	for i := range app.config.cors.trustedOrigins {
+		if origin == app.config.cors.trustedOrigins[i] {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Send the announcement to the other API instances
+// A failed announcement is only logged, the editors are announced again periodically anyway
+func (app *application) announcePresence(announcement presence.Announcement) {
+	payload, err := json.Marshal(announcement)
+	if err != nil {
+		app.logger.PrintError(err, nil)
+		return
+	}
+
+	err = app.models.Presence.Notify(payload)
+	if err != nil {
+		app.logger.PrintError(err, map[string]string{"movie_id": strconv.FormatInt(announcement.MovieID, 10)})
+	}
+}
+
+// Share the editors with the other API instances in the background, until the server shuts down
+// Each instance announces the editors connected to it when they change and periodically, and asks the others
+// for theirs once it is listening, and again after reconnecting. The editors of an instance which stopped
+// without announcing their leave are forgotten once they weren't announced again in time
+func (app *application) listenPresence() {
+	app.background(func() {
+		listener := pq.NewListener(app.config.db.dsn, 10*time.Second, time.Minute, func(_ pq.ListenerEventType, err error) {
+			if err != nil {
+				app.logger.PrintError(err, nil)
+			}
+		})
+		defer listener.Close()
+
+		err := listener.Listen(data.PresenceChannel)
+		if err != nil {
+			app.logger.PrintError(err, nil)
+			return
+		}
+
+		// Catching up with the other instances, which may have missed the announcements of this one as well
+		sync := func() {
+			app.announcePresence(app.presence.SyncRequest())
+			for _, announcement := range app.presence.AnnounceAll() {
+				app.announcePresence(announcement)
+			}
+		}
+		sync()
+
+		ticker := time.NewTicker(presenceAnnouncePeriod)
+		defer ticker.Stop()
+
+		for {
+			select {
+			// A nil notification is sent after reconnecting
+			case notification := <-listener.Notify:
+				if notification == nil {
+					sync()
+					continue
+				}
+
+				var announcement presence.Announcement
+				err := json.Unmarshal([]byte(notification.Extra), &announcement)
+				if err != nil {
+					app.logger.PrintError(err, nil)
+					continue
+				}
+
+				// Answering the sync requests of the other instances with the editors of this one
+				if app.presence.Receive(announcement, time.Now().Add(presenceRemoteTTL)) {
+					for _, announcement := range app.presence.AnnounceAll() {
+						app.announcePresence(announcement)
+					}
+				}
+
+			// Announcing the editors of this instance again, forgetting those of the others which weren't,
+			// and checking the connection
+			case <-ticker.C:
+				for _, announcement := range app.presence.AnnounceAll() {
+					app.announcePresence(announcement)
+				}
+				app.presence.Expire(time.Now())
+				listener.Ping()
+
+			// Returning once the shutdown has started
+			case <-app.shutdown:
+				return
+			}
+		}
+	})
+}
+
+// Pass the saves and deletions of movies on to their editors in the background, until the server shuts down
+func (app *application) watchMovieVersions() {
+	app.background(func() {
+		for {
+			events, unsubscribe := app.movieEvents.Subscribe()
+			for event := range events {
+				app.announceMovieEvent(event)
+			}
+			unsubscribe()
+
+			// The subscription ends when the shutdown starts, or when this falls behind, in which case it subscribes again
+			// Notices missed in the meantime are made up for by the version check when editors join again
+			select {
+			case <-app.shutdown:
+				return
+			case <-time.After(time.Second):
+			}
+		}
+	})
+}
+
+// Send a notice to the editors of the movie the event is about
+func (app *application) announceMovieEvent(event *data.MovieEvent) {
+	// Reading the movie out of the payload, movies are encoded without json tags and deletions only carry the id
+	var payload struct {
+		Data struct {
+			Movie *struct {
+				ID      int64
+				Version int32
+			} `json:"movie"`
+			ID int64 `json:"id"`
+		} `json:"data"`
+	}
+
+	err := json.Unmarshal(event.Payload, &payload)
+	if err != nil {
+		app.logger.PrintError(err, map[string]string{"event": event.Event})
+		return
+	}
+
+	switch {
+	case (event.Event == data.EventMovieUpdated || event.Event == data.EventMovieRestored) && payload.Data.Movie != nil:
+		app.presence.Broadcast(payload.Data.Movie.ID, presence.Message{
+			Type:    presence.TypeVersion,
+			MovieID: payload.Data.Movie.ID,
+			Version: payload.Data.Movie.Version,
+		})
+
+	case event.Event == data.EventMovieDeleted:
+		app.presence.Broadcast(payload.Data.ID, presence.Message{
+			Type:    presence.TypeDeleted,
+			MovieID: payload.Data.ID,
+		})
+	}
+}
@@ -0,0 +1,153 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"moviego.madhav.net/internal/data"
+	"moviego.madhav.net/internal/validator"
+)
+
+// rateMovieHandler for the "PUT /v1/movies/:id/rating" endpoint
+// The rating of the authenticated user for the movie is created, or replaced when it already exists
+func (app *application) rateMovieHandler(w http.ResponseWriter, r *http.Request) {
+	// Extract the id from the URL
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	// Declare an input struct to hold the expected data from the client (Resquest DTO)
+	var input struct {
+		Rating     int32  `json:"rating"`
+		Visibility string `json:"visibility"`
+	}
+
+	// Decode the request body into the input struct
+	err = app.readJson(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	user := app.contextGetUser(r)
+	rating := &data.Rating{UserID: user.ID, MovieID: id, Rating: input.Rating}
+
+	// Ratings show up in the feed of the followers of the user, unless they choose otherwise
+	if input.Visibility == "" {
+		input.Visibility = data.VisibilityPublic
+	}
+
+	// Validate the input
+	v := validator.New()
+	v.Check(validator.In(input.Visibility, data.VisibilityPublic, data.VisibilityFollowers, data.VisibilityPrivate), "visibility", "must be public, followers or private")
+	if data.ValidateRating(v, rating); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	// Storing the rating along with recording it in the activity of the user, which fails when the movie doesn't exist
+	err = app.models.Ratings.Upsert(rating, input.Visibility)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	// Updating the taste profile of the user with the new rating
+	app.rebuildTasteProfile(user.ID)
+
+	// Return a 200 OK status code along with the rating
+	err = app.writeJson(w, http.StatusOK, envelope{"rating": rating}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// deleteRatingHandler for the "DELETE /v1/movies/:id/rating" endpoint
+func (app *application) deleteRatingHandler(w http.ResponseWriter, r *http.Request) {
+	// Extract the id from the URL
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	user := app.contextGetUser(r)
+
+	// Deleting the rating from the database
+	err = app.models.Ratings.Delete(user.ID, id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	// Updating the taste profile of the user without the rating
+	app.rebuildTasteProfile(user.ID)
+
+	// Return a 200 OK status code along with a success message
+	err = app.writeJson(w, http.StatusOK, envelope{"message": "rating successfully deleted"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// listRecommendationsHandler for the "GET /v1/users/me/recommendations" endpoint
+func (app *application) listRecommendationsHandler(w http.ResponseWriter, r *http.Request) {
+	// Declare an input struct to hold the expected data from the client (Resquest DTO)
+	var input struct {
+		data.Filters
+	}
+
+	// Validating the query string parameters
+	v := validator.New()
+	qs := r.URL.Query()
+
+	input.Filters.Page = app.readInt(qs, "page", 1, v)
+	input.Filters.PageSize = app.readInt(qs, "page_size", 20, v)
+
+	// Recommendations are always ordered by how well they fit
+	input.Filters.Sort = "id"
+	input.Filters.SortSafelist = []string{"id"}
+
+	if data.ValidateFilters(v, input.Filters); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	// Retriving the recommendations for the authenticated user
+	user := app.contextGetUser(r)
+	recommendations, metadata, err := app.models.Recommendations.GetForUser(user.ID, input.Filters)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	// Return a 200 OK status code along with the recommendations
+	err = app.writeJson(w, http.StatusOK, envelope{"recommendations": recommendations, "metadata": metadata}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// Rebuild the taste profile of the user in the background, once their ratings changed
+// Rebuilds for the same user can run at the same time, the model makes sure the last one to commit is up to date
+func (app *application) rebuildTasteProfile(userID int64) {
+	app.background(func() {
+		err := app.models.Recommendations.RebuildProfile(userID)
+		if err != nil {
+			app.logger.PrintError(err, map[string]string{"user_id": fmt.Sprint(userID)})
+		}
+	})
+}
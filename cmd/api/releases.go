@@ -0,0 +1,224 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"moviego.madhav.net/internal/data"
+	"moviego.madhav.net/internal/validator"
+)
+
+// listMovieReleasesHandler for the "GET /v1/movies/:id/releases" endpoint
+func (app *application) listMovieReleasesHandler(w http.ResponseWriter, r *http.Request) {
+	// Extract the id from the URL
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	// Retriving the movie record from the database, which carries its releases
+	movie, err := app.models.Movies.Get(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.movieNotFoundResponse(w, r, id)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	// Return a 200 OK status code along with the releases
+	err = app.writeJson(w, http.StatusOK, envelope{"releases": movie.Releases}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// createMovieReleaseHandler for the "POST /v1/movies/:id/releases" endpoint
+func (app *application) createMovieReleaseHandler(w http.ResponseWriter, r *http.Request) {
+	// Extract the id from the URL
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	// Declare an input struct to hold the expected data from the client (Resquest DTO)
+	var input struct {
+		Country       string `json:"country"`
+		Type          string `json:"type"`
+		Date          string `json:"date"`
+		Certification string `json:"certification"`
+	}
+
+	// Decode the request body into the input struct
+	err = app.readJson(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	release := &data.MovieRelease{
+		MovieID:       id,
+		Country:       input.Country,
+		Type:          input.Type,
+		Date:          input.Date,
+		Certification: input.Certification,
+	}
+
+	// Validate the input
+	v := validator.New()
+	if data.ValidateRelease(v, release); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	// Insert the release into the database, which fails when the movie doesn't exist
+	err = app.models.Releases.Insert(release)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrDuplicateRelease):
+			v.AddError("type", "the movie already has a release of this type in this country")
+			app.failedValidationResponse(w, r, v.Errors)
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	// Add a Location header to the response containing the URL of the new release
+	headers := make(http.Header)
+	headers.Set("Location", fmt.Sprintf("/v1/movies/%d/releases/%d", id, release.ID))
+
+	// Return a 201 Created status code along with the release
+	err = app.writeJson(w, http.StatusCreated, envelope{"release": release}, headers)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// updateMovieReleaseHandler for the "PATCH /v1/movies/:id/releases/:release_id" endpoint
+func (app *application) updateMovieReleaseHandler(w http.ResponseWriter, r *http.Request) {
+	// Extract the ids from the URL
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	releaseID, err := app.readIntParam(r, "release_id")
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	// Retriving the release record from the database
+	release, err := app.models.Releases.Get(id, releaseID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	// Declare an input struct to hold the expected data from the client (Resquest DTO)
+	var input struct {
+		Country       *string `json:"country"`
+		Type          *string `json:"type"`
+		Date          *string `json:"date"`
+		Certification *string `json:"certification"`
+	}
+
+	// Decode the request body into the input struct
+	err = app.readJson(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	// Copy the new data across to the release record if it is provided
+	if input.Country != nil {
+		release.Country = *input.Country
+	}
+	if input.Type != nil {
+		release.Type = *input.Type
+	}
+	if input.Date != nil {
+		release.Date = *input.Date
+	}
+	if input.Certification != nil {
+		release.Certification = *input.Certification
+	}
+
+	// Validate the input
+	v := validator.New()
+	if data.ValidateRelease(v, release); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	// Update the release record in the database
+	err = app.models.Releases.Update(release)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrDuplicateRelease):
+			v.AddError("type", "the movie already has a release of this type in this country")
+			app.failedValidationResponse(w, r, v.Errors)
+		case errors.Is(err, data.ErrEditConflict):
+			app.editConflictResponse(w, r)
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	// Return a 200 OK status code along with the release
+	err = app.writeJson(w, http.StatusOK, envelope{"release": release}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// deleteMovieReleaseHandler for the "DELETE /v1/movies/:id/releases/:release_id" endpoint
+func (app *application) deleteMovieReleaseHandler(w http.ResponseWriter, r *http.Request) {
+	// Extract the ids from the URL
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	releaseID, err := app.readIntParam(r, "release_id")
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	// Deleting the release from the database
+	err = app.models.Releases.Delete(id, releaseID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	// Return a 200 OK status code along with a success message
+	err = app.writeJson(w, http.StatusOK, envelope{"message": "release successfully deleted"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
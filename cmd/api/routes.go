@@ -5,6 +5,8 @@ import (
 	"net/http"
 
 	"github.com/julienschmidt/httprouter"
+
+	"moviego.madhav.net/internal/storage"
 )
 
 // routes method which returns a httprouter.Router instance containing the application routes
@@ -28,10 +30,144 @@ func (app *application) routes() http.Handler {
 		app.requirePermission("movies:write", app.createMovieHandler),
 	)
 
+	router.HandlerFunc(
+		http.MethodPost,
+		"/v1/movies/:id",
+		app.dispatchStatic(
+			map[string]http.HandlerFunc{
+				"import": app.requirePermission("movies:write", app.importMoviesHandler),
+				"batch":  app.requirePermission("movies:write", app.batchMoviesHandler),
+			},
+			app.methodNotAllowedResponse,
+		),
+	)
+
+	// Static routes sharing the :id position are dispatched by dispatchStatic()
 	router.HandlerFunc(
 		http.MethodGet,
 		"/v1/movies/:id",
-		app.requirePermission("movies:read", app.showMovieHandler),
+		app.dispatchStatic(
+			map[string]http.HandlerFunc{
+				"autocomplete": app.rateLimitWith(
+					app.config.limiter.autocompleteRPS,
+					app.config.limiter.autocompleteBurst,
+					app.requirePermission("movies:read", app.autocompleteMoviesHandler),
+				).ServeHTTP,
+				"stats":      app.requirePermission("movies:read", app.movieStatsHandler),
+				"export":     app.requirePermission("movies:export", app.exportMoviesHandler),
+				"trash":      app.requirePermission("movies:write", app.listTrashHandler),
+				"duplicates": app.requirePermission("movies:admin", app.listDuplicatesHandler),
+				"lookup":     app.requirePermission("movies:read", app.lookupMovieHandler),
+			},
+			app.requirePermission("movies:read", app.showMovieHandler),
+		),
+	)
+
+	router.HandlerFunc(
+		http.MethodPost,
+		"/v1/movies/:id/restore",
+		app.requirePermission("movies:write", app.restoreMovieHandler),
+	)
+
+	router.HandlerFunc(
+		http.MethodPost,
+		"/v1/movies/:id/merge",
+		app.requirePermission("movies:admin", app.mergeMovieHandler),
+	)
+
+	// Endpoints for the images of a movie
+	router.HandlerFunc(
+		http.MethodPost,
+		"/v1/movies/:id/images",
+		app.requirePermission("movies:write", app.uploadMovieImageHandler),
+	)
+
+	router.HandlerFunc(
+		http.MethodDelete,
+		"/v1/movies/:id/images/:image_id",
+		app.requirePermission("movies:write", app.deleteMovieImageHandler),
+	)
+
+	// Endpoint for the movies similar to a movie
+	router.HandlerFunc(
+		http.MethodGet,
+		"/v1/movies/:id/similar",
+		app.requirePermission("movies:read", app.similarMoviesHandler),
+	)
+
+	// Endpoints for the rating of a movie by the authenticated user
+	router.HandlerFunc(
+		http.MethodPut,
+		"/v1/movies/:id/rating",
+		app.requirePermission("movies:read", app.rateMovieHandler),
+	)
+
+	router.HandlerFunc(
+		http.MethodDelete,
+		"/v1/movies/:id/rating",
+		app.requirePermission("movies:read", app.deleteRatingHandler),
+	)
+
+	// Endpoint for recording that the authenticated user watched a movie
+	router.HandlerFunc(
+		http.MethodPost,
+		"/v1/movies/:id/watched",
+		app.requirePermission("movies:read", app.watchMovieHandler),
+	)
+
+	// Endpoints for the discussion of a movie, where posting is rate limited for each user
+	router.HandlerFunc(
+		http.MethodGet,
+		"/v1/movies/:id/comments",
+		app.requirePermission("movies:read", app.listMovieCommentsHandler),
+	)
+
+	router.HandlerFunc(
+		http.MethodPost,
+		"/v1/movies/:id/comments",
+		app.requirePermission("movies:read", app.rateLimitUser(
+			app.config.limiter.commentRPS,
+			app.config.limiter.commentBurst,
+			http.HandlerFunc(app.createMovieCommentHandler),
+		).ServeHTTP),
+	)
+
+	// Endpoints for the release dates and certifications of a movie
+	router.HandlerFunc(
+		http.MethodGet,
+		"/v1/movies/:id/releases",
+		app.requirePermission("movies:read", app.listMovieReleasesHandler),
+	)
+
+	router.HandlerFunc(
+		http.MethodPost,
+		"/v1/movies/:id/releases",
+		app.requirePermission("movies:write", app.createMovieReleaseHandler),
+	)
+
+	router.HandlerFunc(
+		http.MethodPatch,
+		"/v1/movies/:id/releases/:release_id",
+		app.requirePermission("movies:write", app.updateMovieReleaseHandler),
+	)
+
+	router.HandlerFunc(
+		http.MethodDelete,
+		"/v1/movies/:id/releases/:release_id",
+		app.requirePermission("movies:write", app.deleteMovieReleaseHandler),
+	)
+
+	// Endpoints for the localized titles and synopses of a movie
+	router.HandlerFunc(
+		http.MethodPut,
+		"/v1/movies/:id/translations/:language",
+		app.requirePermission("movies:write", app.putMovieTranslationHandler),
+	)
+
+	router.HandlerFunc(
+		http.MethodDelete,
+		"/v1/movies/:id/translations/:language",
+		app.requirePermission("movies:write", app.deleteMovieTranslationHandler),
 	)
 
 	router.HandlerFunc(
@@ -52,18 +188,258 @@ func (app *application) routes() http.Handler {
 		app.requirePermission("movies:read", app.listMoviesHandler),
 	)
 
+	// Stream of the changes to movies, as Server-Sent Events
+	router.HandlerFunc(
+		http.MethodGet,
+		"/v1/events/movies",
+		app.requirePermission("movies:read", app.movieEventsHandler),
+	)
+
+	// WebSocket for seeing who else is editing a movie, and when it is saved
+	router.HandlerFunc(
+		http.MethodGet,
+		"/v1/presence",
+		app.requirePermission("movies:write", app.presenceHandler),
+	)
+	router.HandlerFunc(
+		http.MethodPost,
+		"/v1/presence/tickets",
+		app.requirePermission("movies:write", app.createPresenceTicketHandler),
+	)
+
+	// Status endpoint for movie imports processed in the background
+	router.HandlerFunc(
+		http.MethodGet,
+		"/v1/imports/:id",
+		app.requirePermission("movies:write", app.showImportHandler),
+	)
+
 	// CRUD endpoints for the users resource
 	router.HandlerFunc(http.MethodPost, "/v1/users", app.registerUserHandler)
 	router.HandlerFunc(http.MethodPut, "/v1/users/activated", app.activateUserHandler)
 
+	// Endpoint for the movies recommended to the authenticated user
+	router.HandlerFunc(
+		http.MethodGet,
+		"/v1/users/me/recommendations",
+		app.requirePermission("movies:read", app.listRecommendationsHandler),
+	)
+
+	// Endpoints for the watch history of the authenticated user
+	router.HandlerFunc(
+		http.MethodGet,
+		"/v1/users/me/history",
+		app.requirePermission("movies:read", app.listWatchHistoryHandler),
+	)
+
+	router.HandlerFunc(
+		http.MethodGet,
+		"/v1/users/me/history/summary",
+		app.requirePermission("movies:read", app.watchSummaryHandler),
+	)
+
+	// Endpoints for the notifications of the authenticated user
+	router.HandlerFunc(
+		http.MethodGet,
+		"/v1/users/me/notifications",
+		app.requireActivatedUser(app.listNotificationsHandler),
+	)
+
+	router.HandlerFunc(
+		http.MethodGet,
+		"/v1/users/me/notifications/unread",
+		app.requireActivatedUser(app.unreadNotificationsHandler),
+	)
+
+	router.HandlerFunc(
+		http.MethodPost,
+		"/v1/users/me/notifications/read",
+		app.requireActivatedUser(app.readAllNotificationsHandler),
+	)
+
+	router.HandlerFunc(
+		http.MethodPost,
+		"/v1/notifications/:id/read",
+		app.requireActivatedUser(app.readNotificationHandler),
+	)
+
+	router.HandlerFunc(
+		http.MethodGet,
+		"/v1/users/me/notification_preferences",
+		app.requireActivatedUser(app.showNotificationPreferencesHandler),
+	)
+
+	router.HandlerFunc(
+		http.MethodPut,
+		"/v1/users/me/notification_preferences",
+		app.requireActivatedUser(app.updateNotificationPreferencesHandler),
+	)
+
+	// Endpoints for following users and reading the activity of the followed users
+	router.HandlerFunc(
+		http.MethodPost,
+		"/v1/follows",
+		app.requireActivatedUser(app.followUserHandler),
+	)
+
+	router.HandlerFunc(
+		http.MethodDelete,
+		"/v1/follows/:id",
+		app.requireActivatedUser(app.unfollowUserHandler),
+	)
+
+	router.HandlerFunc(
+		http.MethodGet,
+		"/v1/users/me/feed",
+		app.requireActivatedUser(app.feedHandler),
+	)
+
+	// Endpoints for the comments of the authenticated user, and for reporting comments
+	router.HandlerFunc(
+		http.MethodPatch,
+		"/v1/comments/:id",
+		app.requirePermission("movies:read", app.updateCommentHandler),
+	)
+
+	router.HandlerFunc(
+		http.MethodDelete,
+		"/v1/comments/:id",
+		app.requirePermission("movies:read", app.deleteCommentHandler),
+	)
+
+	router.HandlerFunc(
+		http.MethodPost,
+		"/v1/comments/:id/report",
+		app.requirePermission("movies:read", app.reportCommentHandler),
+	)
+
+	// Endpoints for suggesting movies, which are applied once a moderator approves them
+	router.HandlerFunc(
+		http.MethodPost,
+		"/v1/submissions",
+		app.requirePermission("movies:suggest", app.createSubmissionHandler),
+	)
+
+	router.HandlerFunc(
+		http.MethodGet,
+		"/v1/users/me/submissions",
+		app.requirePermission("movies:suggest", app.listMySubmissionsHandler),
+	)
+
+	// Moderation endpoints for reviewing the suggested movies
+	router.HandlerFunc(
+		http.MethodGet,
+		"/v1/moderation/submissions",
+		app.requirePermission("movies:moderate", app.listModerationQueueHandler),
+	)
+
+	router.HandlerFunc(
+		http.MethodPost,
+		"/v1/moderation/submissions/:id/approve",
+		app.requirePermission("movies:moderate", app.approveSubmissionHandler),
+	)
+
+	router.HandlerFunc(
+		http.MethodPost,
+		"/v1/moderation/submissions/:id/reject",
+		app.requirePermission("movies:moderate", app.rejectSubmissionHandler),
+	)
+
+	// Moderation endpoints for the reported comments
+	router.HandlerFunc(
+		http.MethodGet,
+		"/v1/moderation/comments",
+		app.requirePermission("movies:moderate", app.listReportedCommentsHandler),
+	)
+
+	router.HandlerFunc(
+		http.MethodPost,
+		"/v1/moderation/comments/:id/hide",
+		app.requirePermission("movies:moderate", app.hideCommentHandler),
+	)
+
+	// Endpoints for the webhooks notified of changes to the catalogue, and their deliveries
+	router.HandlerFunc(
+		http.MethodPost,
+		"/v1/webhooks",
+		app.requirePermission("movies:admin", app.createWebhookHandler),
+	)
+
+	router.HandlerFunc(
+		http.MethodGet,
+		"/v1/webhooks",
+		app.requirePermission("movies:admin", app.listWebhooksHandler),
+	)
+
+	router.HandlerFunc(
+		http.MethodGet,
+		"/v1/webhooks/:id",
+		app.requirePermission("movies:admin", app.showWebhookHandler),
+	)
+
+	router.HandlerFunc(
+		http.MethodPatch,
+		"/v1/webhooks/:id",
+		app.requirePermission("movies:admin", app.updateWebhookHandler),
+	)
+
+	router.HandlerFunc(
+		http.MethodDelete,
+		"/v1/webhooks/:id",
+		app.requirePermission("movies:admin", app.deleteWebhookHandler),
+	)
+
+	router.HandlerFunc(
+		http.MethodGet,
+		"/v1/webhooks/:id/deliveries",
+		app.requirePermission("movies:admin", app.listWebhookDeliveriesHandler),
+	)
+
+	router.HandlerFunc(
+		http.MethodPost,
+		"/v1/webhooks/:id/deliveries/:delivery_id/redeliver",
+		app.requirePermission("movies:admin", app.redeliverWebhookHandler),
+	)
+
+	// Endpoints for the background job queue, to look into and retry the dead jobs
+	router.HandlerFunc(
+		http.MethodGet,
+		"/v1/jobs",
+		app.requirePermission("movies:admin", app.listJobsHandler),
+	)
+	router.HandlerFunc(
+		http.MethodPost,
+		"/v1/jobs/:id/retry",
+		app.requirePermission("movies:admin", app.retryJobHandler),
+	)
+
 	// Authentication and Authorization endpoints
 	router.HandlerFunc(
 		http.MethodPost, "/v1/tokens/authentication", app.createAuthenticationTokenHandler,
 	)
 
+	// Uploaded files kept in the local storage directory, without listing its directories
+	router.ServeFiles("/images/*filepath", storage.FilesOnly(http.Dir(app.config.storage.dir)))
+
 	// Metrics endpoint
 	router.Handler(http.MethodGet, "/debug/vars", expvar.Handler())
 
 	// Return the httprouter instance
 	return app.metrics(app.recoverPanic(app.enableCORS(app.rateLimit(app.authenticate(router)))))
 }
+
+// httprouter doesn't allow a static path segment in the same position as a wildcard, so static routes
+// such as "/v1/movies/autocomplete" are registered on the "/v1/movies/:id" route and dispatched here
+func (app *application) dispatchStatic(routes map[string]http.HandlerFunc, fallback http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// Checking whether the id segment names one of the static routes
+		params := httprouter.ParamsFromContext(r.Context())
+		if handler, ok := routes[params.ByName("id")]; ok {
+			handler(w, r)
+			return
+		}
+
+		// Calling the wildcard handler otherwise
+		fallback(w, r)
+	}
+}
@@ -12,6 +12,18 @@ import (
 	"time"
 )
 
+// Time allowed for writing a response, which long lived responses such as event streams have to work around
+const serverWriteTimeout = 30 * time.Second
+
+// Extend the deadlines of a request whose body can take longer to upload than the server read timeout allows for
+// The write deadline runs from the start of the request, so the response is given its usual time on top of the upload
+// This is best effort, and is not supported by every response writer
+func extendUploadDeadlines(w http.ResponseWriter, upload time.Duration) {
+	rc := http.NewResponseController(w)
+	rc.SetReadDeadline(time.Now().Add(upload))
+	rc.SetWriteDeadline(time.Now().Add(upload + serverWriteTimeout))
+}
+
 func (app *application) serve() error {
 	// Declare a HTTP server with necessary settings
 	srv := &http.Server{
@@ -20,9 +32,15 @@ func (app *application) serve() error {
 		ErrorLog:     log.New(app.logger, "", 0),
 		IdleTimeout:  time.Minute,
 		ReadTimeout:  10 * time.Second,
-		WriteTimeout: 30 * time.Second,
+		WriteTimeout: serverWriteTimeout,
 	}
 
+	// Ending the event streams when the shutdown starts, since they would otherwise keep it waiting
+	srv.RegisterOnShutdown(app.movieEvents.Close)
+
+	// Closing the presence connections too, which the server doesn't track once they are upgraded
+	srv.RegisterOnShutdown(app.presence.Close)
+
 	// Creating a shutdownError channel to carry error values given by the server.Shutdown() method
 	shutdownError := make(chan error)
 
@@ -57,6 +75,13 @@ func (app *application) serve() error {
 			"addr": srv.Addr,
 		})
 
+		// Signalling the periodic background tasks and the job workers to stop
+		close(app.shutdown)
+
+		// Waiting for the job workers to finish the jobs they are running
+		app.logger.PrintInfo("draining job workers", nil)
+		app.drainJobs()
+
 		// Blocking until the all the background goroutines have completed
 		app.wg.Wait()
 
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestExtendUploadDeadlines(t *testing.T) {
+	tests := []struct {
+		name   string
+		extend bool
+		wantOK bool
+	}{
+		{name: "Server timeout", extend: false, wantOK: false},
+		{name: "Extended", extend: true, wantOK: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Starting a server which reads bodies for a lot less time than the upload below takes
+			ts := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if tt.extend {
+					extendUploadDeadlines(w, 5*time.Second)
+				}
+
+				_, err := io.Copy(io.Discard, r.Body)
+				if err != nil {
+					w.WriteHeader(http.StatusRequestTimeout)
+					return
+				}
+				w.WriteHeader(http.StatusOK)
+			}))
+			ts.Config.ReadTimeout = 100 * time.Millisecond
+			ts.Config.WriteTimeout = 100 * time.Millisecond
+			ts.Start()
+			defer ts.Close()
+
+			// Uploading the body slowly, a chunk at a time
+			body, pw := io.Pipe()
+			go func() {
+				for i := 0; i < 10; i++ {
+					time.Sleep(50 * time.Millisecond)
+					if _, err := io.Copy(pw, strings.NewReader("title,year\n")); err != nil {
+						return
+					}
+				}
+				pw.Close()
+			}()
+
+			res, err := http.Post(ts.URL, "text/csv", body)
+			ok := err == nil && res.StatusCode == http.StatusOK
+			if res != nil {
+				res.Body.Close()
+			}
+
+			if ok != tt.wantOK {
+				t.Errorf("got upload succeeding %t (error %v); want %t", ok, err, tt.wantOK)
+			}
+		})
+	}
+}
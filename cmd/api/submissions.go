@@ -0,0 +1,295 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+
+	"moviego.madhav.net/internal/data"
+	"moviego.madhav.net/internal/validator"
+)
+
+// createSubmissionHandler for the "POST /v1/submissions" endpoint
+// A submission without a movie_id suggests a new movie, one with a movie_id proposes an edit to that movie
+func (app *application) createSubmissionHandler(w http.ResponseWriter, r *http.Request) {
+	// Declare an input struct to hold the expected data from the client (Resquest DTO)
+	var input struct {
+		MovieID *int64   `json:"movie_id"`
+		Title   *string  `json:"title"`
+		Year    *int32   `json:"year"`
+		Runtime *int32   `json:"runtime"`
+		Genres  []string `json:"genres"`
+	}
+
+	// Decode the request body into the input struct
+	err := app.readJson(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	submission := &data.Submission{
+		UserID:  app.contextGetUser(r).ID,
+		Kind:    data.SubmissionCreate,
+		MovieID: input.MovieID,
+		Title:   input.Title,
+		Year:    input.Year,
+		Runtime: input.Runtime,
+		Genres:  input.Genres,
+	}
+
+	// Building the movie as it would look once the submission is approved
+	var title string
+	var year, runtime int32
+	movie := &data.Movie{Title: &title, Year: &year, Runtime: &runtime}
+
+	v := validator.New()
+	if input.MovieID != nil {
+		submission.Kind = data.SubmissionEdit
+
+		movie, err = app.models.Movies.Get(*input.MovieID)
+		if err != nil {
+			switch {
+			case errors.Is(err, data.ErrRecordNotFound):
+				v.AddError("movie_id", "must be the id of an existing movie")
+				app.failedValidationResponse(w, r, v.Errors)
+			default:
+				app.serverErrorResponse(w, r, err)
+			}
+			return
+		}
+
+		submission.MovieVersion = &movie.Version
+		v.Check(input.Title != nil || input.Year != nil || input.Runtime != nil || input.Genres != nil, "movie", "must propose at least one change")
+	}
+	submission.Apply(movie)
+
+	// Validate the input
+	if data.ValidateMovie(v, movie); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	// Insert the submission into the moderation queue
+	err = app.models.Submissions.Insert(submission)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	// Return a 202 Accepted status code along with the submission, since it is only applied once approved
+	err = app.writeJson(w, http.StatusAccepted, envelope{"submission": submission}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// listMySubmissionsHandler for the "GET /v1/users/me/submissions" endpoint
+func (app *application) listMySubmissionsHandler(w http.ResponseWriter, r *http.Request) {
+	app.listSubmissions(w, r, app.contextGetUser(r).ID, "")
+}
+
+// listModerationQueueHandler for the "GET /v1/moderation/submissions" endpoint
+// The pending submissions are listed unless another status is asked for
+func (app *application) listModerationQueueHandler(w http.ResponseWriter, r *http.Request) {
+	app.listSubmissions(w, r, 0, data.SubmissionPending)
+}
+
+// Respond with the submissions of the given user, or of every user when userID is zero
+// The status query string parameter narrows down the submissions, and defaults to defaultStatus
+func (app *application) listSubmissions(w http.ResponseWriter, r *http.Request, userID int64, defaultStatus string) {
+	// Declare an input struct to hold the expected data from the client (Resquest DTO)
+	var input struct {
+		Status string
+		data.Filters
+	}
+
+	// Validating the query string parameters
+	v := validator.New()
+	qs := r.URL.Query()
+
+	input.Status = app.readString(qs, "status", defaultStatus)
+	input.Filters.Page = app.readInt(qs, "page", 1, v)
+	input.Filters.PageSize = app.readInt(qs, "page_size", 20, v)
+
+	// Submissions are always ordered from the oldest
+	input.Filters.Sort = "id"
+	input.Filters.SortSafelist = []string{"id"}
+
+	if input.Status != "" {
+		v.Check(validator.In(input.Status, data.SubmissionPending, data.SubmissionApproved, data.SubmissionRejected), "status", "must be pending, approved or rejected")
+	}
+
+	if data.ValidateFilters(v, input.Filters); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	// Retriving the submissions from the database
+	submissions, metadata, err := app.models.Submissions.GetAll(input.Status, userID, input.Filters)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	// Return a 200 OK status code along with the submissions
+	err = app.writeJson(w, http.StatusOK, envelope{"submissions": submissions, "metadata": metadata}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// approveSubmissionHandler for the "POST /v1/moderation/submissions/:id/approve" endpoint
+// The submission is applied through the movie model, and the submitter is notified
+func (app *application) approveSubmissionHandler(w http.ResponseWriter, r *http.Request) {
+	// Declare an input struct to hold the expected data from the client (Resquest DTO)
+	var input struct {
+		Reason string `json:"reason"`
+	}
+
+	submission, ok := app.readPendingSubmission(w, r, &input)
+	if !ok {
+		return
+	}
+
+	// Validate the input
+	v := validator.New()
+	if data.ValidateReviewReason(v, input.Reason, false); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	// Applying the submission to a new movie, or to the movie it edits
+	var title string
+	var year, runtime int32
+	movie := &data.Movie{Title: &title, Year: &year, Runtime: &runtime}
+
+	if submission.Kind == data.SubmissionEdit {
+		var err error
+		movie, err = app.models.Movies.Get(*submission.MovieID)
+		if err != nil {
+			switch {
+			case errors.Is(err, data.ErrRecordNotFound):
+				app.notFoundResponse(w, r)
+			default:
+				app.serverErrorResponse(w, r, err)
+			}
+			return
+		}
+
+		// The edit was proposed against an earlier version, so it could undo later changes
+		if movie.Version != *submission.MovieVersion {
+			app.editConflictResponse(w, r)
+			return
+		}
+	}
+	submission.Apply(movie)
+
+	// Validating the movie again, since the rules may have changed since the submission
+	if data.ValidateMovie(v, movie); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	// Applying the submission and recording the approval
+	app.reviewSubmission(w, r, submission, input.Reason, movie)
+}
+
+// rejectSubmissionHandler for the "POST /v1/moderation/submissions/:id/reject" endpoint
+// A reason is required, and is passed on to the submitter
+func (app *application) rejectSubmissionHandler(w http.ResponseWriter, r *http.Request) {
+	// Declare an input struct to hold the expected data from the client (Resquest DTO)
+	var input struct {
+		Reason string `json:"reason"`
+	}
+
+	submission, ok := app.readPendingSubmission(w, r, &input)
+	if !ok {
+		return
+	}
+
+	// Validate the input
+	v := validator.New()
+	if data.ValidateReviewReason(v, input.Reason, true); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	// Recording the rejection
+	submission.Status = data.SubmissionRejected
+	app.reviewSubmission(w, r, submission, input.Reason, nil)
+}
+
+// Read the pending submission named in the URL along with the request body
+// A response has already been sent when ok is false
+func (app *application) readPendingSubmission(w http.ResponseWriter, r *http.Request, dst any) (*data.Submission, bool) {
+	// Extract the id from the URL
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return nil, false
+	}
+
+	// Decode the request body into the input struct
+	err = app.readJson(w, r, dst)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return nil, false
+	}
+
+	// Retriving the submission from the database
+	submission, err := app.models.Submissions.Get(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return nil, false
+	}
+
+	// Only pending submissions can be reviewed
+	if submission.Status != data.SubmissionPending {
+		v := validator.New()
+		v.AddError("status", "the submission has already been reviewed")
+		app.failedValidationResponse(w, r, v.Errors)
+		return nil, false
+	}
+
+	return submission, true
+}
+
+// Record the review of the submission, respond with it and notify the submitter
+// An approval is given the movie the submission was applied to, which is saved along with the review
+func (app *application) reviewSubmission(w http.ResponseWriter, r *http.Request, submission *data.Submission, reason string, movie *data.Movie) {
+	moderatorID := app.contextGetUser(r).ID
+	submission.Reason = reason
+	submission.ReviewedBy = &moderatorID
+
+	var err error
+	if movie != nil {
+		err = app.models.Submissions.Approve(submission, movie)
+	} else {
+		err = app.models.Submissions.Review(submission)
+	}
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		case errors.Is(err, data.ErrEditConflict):
+			app.editConflictResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	// Telling the submitter about the outcome
+	app.notify(submission.UserID, data.NotificationSubmissionReviewed, map[string]any{"submission": submission})
+
+	// Return a 200 OK status code along with the submission
+	err = app.writeJson(w, http.StatusOK, envelope{"submission": submission}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
@@ -3,6 +3,7 @@ package main
 import (
 	"errors"
 	"net/http"
+	"strconv"
 	"time"
 
 	"moviego.madhav.net/internal/data"
@@ -71,3 +72,18 @@ func (app *application) createAuthenticationTokenHandler(w http.ResponseWriter,
 		app.serverErrorResponse(w, r, err)
 	}
 }
+
+// Periodic task which deletes the expired tokens
+func (app *application) pruneTokens() {
+	pruned, err := app.models.Tokens.DeleteExpired()
+	if err != nil {
+		app.logger.PrintError(err, nil)
+		return
+	}
+
+	if pruned > 0 {
+		app.logger.PrintInfo("pruned expired tokens", map[string]string{
+			"count": strconv.FormatInt(pruned, 10),
+		})
+	}
+}
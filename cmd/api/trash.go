@@ -0,0 +1,93 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"moviego.madhav.net/internal/data"
+	"moviego.madhav.net/internal/validator"
+)
+
+// listTrashHandler for the "GET /v1/movies/trash" endpoint
+func (app *application) listTrashHandler(w http.ResponseWriter, r *http.Request) {
+	// Declare an input struct to hold the expected data from the client (Resquest DTO)
+	var input struct {
+		data.Filters
+	}
+
+	// Validating the query string parameters
+	v := validator.New()
+	qs := r.URL.Query()
+
+	input.Filters.Page = app.readInt(qs, "page", 1, v)
+	input.Filters.PageSize = app.readInt(qs, "page_size", 20, v)
+
+	// The trash is always listed with the most recently deleted movies first
+	input.Filters.Sort = "-deleted_at"
+	input.Filters.SortSafelist = []string{"-deleted_at"}
+
+	if data.ValidateFilters(v, input.Filters); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	// Retriving the deleted movies from the database
+	movies, metadata, err := app.models.Movies.GetDeleted(input.Filters)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	// Return a 200 OK status code along with the movie data
+	err = app.writeJson(w, http.StatusOK, envelope{"movies": movies, "metadata": metadata}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// restoreMovieHandler for the "POST /v1/movies/:id/restore" endpoint
+func (app *application) restoreMovieHandler(w http.ResponseWriter, r *http.Request) {
+	// Extract the id from the URL
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	// Restoring the movie from the trash
+	movie, err := app.models.Movies.Restore(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	// Return a 200 OK status code along with the movie data
+	err = app.writeJson(w, http.StatusOK, envelope{"movie": movie}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// Periodic task which permanently deletes the movies kept in the trash beyond the retention period
+func (app *application) purgeTrash() {
+	purged, keys, err := app.models.Movies.PurgeDeleted(app.config.trash.retention)
+	if err != nil {
+		app.logger.PrintError(err, nil)
+		return
+	}
+
+	// Removing the stored images of the purged movies, now that their records are gone
+	app.deleteStoredFiles(keys)
+
+	if purged > 0 {
+		app.logger.PrintInfo("purged movies from the trash", map[string]string{
+			"count": strconv.FormatInt(purged, 10),
+		})
+	}
+}
@@ -2,8 +2,8 @@ package main
 
 import (
 	"errors"
+	"fmt"
 	"net/http"
-	"time"
 
 	"moviego.madhav.net/internal/data"
 	"moviego.madhav.net/internal/validator"
@@ -45,8 +45,19 @@ func (app *application) registerUserHandler(w http.ResponseWriter, r *http.Reque
 		return
 	}
 
-	// Insert the user into the database using the user model
-	err = app.models.Users.Insert(user)
+	// Insert the user into the database using the user model, along with the movies:read and movies:suggest
+	// permissions given by default, and the welcome email job which carries the activation token
+	// They are all written in one transaction, so that a user is never left without their permissions or welcome email
+	err = app.models.Users.Register(user, []string{"movies:read", "movies:suggest"}, func(user *data.User) ([]*data.Job, error) {
+		job, err := app.newJob(data.JobWelcomeEmail, welcomeEmailJob{UserID: user.ID}, jobOptions{
+			UniqueKey: fmt.Sprintf("welcome:%d", user.ID),
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		return []*data.Job{job}, nil
+	})
 	if err != nil {
 		switch {
 		case errors.Is(err, data.ErrDuplicateEmail):
@@ -58,35 +69,6 @@ func (app *application) registerUserHandler(w http.ResponseWriter, r *http.Reque
 		return
 	}
 
-	// Adding the movies:read permission to the user as default
-	err = app.models.Permissions.AddForUser(user.ID, "movies:read")
-	if err != nil {
-		app.serverErrorResponse(w, r, err)
-		return
-	}
-
-	// Create a new activation token for the user
-	token, err := app.models.Tokens.New(user.ID, 3*24*time.Hour, data.ScopeActivation)
-	if err != nil {
-		app.serverErrorResponse(w, r, err)
-		return
-	}
-
-	// Send a welcome email to the user as a background task
-	app.background(func() {
-		// Define the data for the welcome email
-		data := map[string]any{
-			"activationToken": token.Plaintext,
-			"userID":          user.ID,
-		}
-
-		// Sending the welcome email
-		err = app.mailer.Send(user.Email, "user_welcome.tmpl", data)
-		if err != nil {
-			app.logger.PrintError(err, nil)
-		}
-	})
-
 	// Return a 201 Created status code along with the user data
 	err = app.writeJson(w, http.StatusCreated, envelope{"user": user}, nil)
 	if err != nil {
@@ -128,11 +110,8 @@ func (app *application) activateUserHandler(w http.ResponseWriter, r *http.Reque
 		return
 	}
 
-	// Updating the user's activation status to true
-	user.Activated = true
-
-	// Updating the user record in the database
-	err = app.models.Users.Update(user)
+	// Activating the user, which also deletes all the activation tokens for the user and tells the webhooks
+	err = app.models.Users.Activate(user)
 	if err != nil {
 		switch {
 		// If there is a edit conflict, then we return a 409 Conflict status code
@@ -144,13 +123,6 @@ func (app *application) activateUserHandler(w http.ResponseWriter, r *http.Reque
 		return
 	}
 
-	// If the user is successfully activated, then we delete all the activation tokens for the user
-	err = app.models.Tokens.DeleteAllForUser(data.ScopeActivation, user.ID)
-	if err != nil {
-		app.serverErrorResponse(w, r, err)
-		return
-	}
-
 	// Return a 200 OK status code along with the user data
 	err = app.writeJson(w, http.StatusOK, envelope{"user": user}, nil)
 	if err != nil {
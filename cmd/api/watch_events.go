@@ -0,0 +1,165 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"moviego.madhav.net/internal/data"
+	"moviego.madhav.net/internal/validator"
+)
+
+// watchMovieHandler for the "POST /v1/movies/:id/watched" endpoint
+// The progress defaults to the whole runtime of the movie, and the time to now
+func (app *application) watchMovieHandler(w http.ResponseWriter, r *http.Request) {
+	// Extract the id from the URL
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	// Declare an input struct to hold the expected data from the client (Resquest DTO)
+	var input struct {
+		Progress  *int32     `json:"progress"`
+		WatchedAt *time.Time `json:"watched_at"`
+	}
+
+	// Decode the request body into the input struct
+	err = app.readJson(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	// Retriving the movie, whose runtime bounds the progress
+	movie, err := app.models.Movies.Get(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	event := &data.WatchEvent{
+		UserID:    app.contextGetUser(r).ID,
+		MovieID:   movie.ID,
+		WatchedAt: time.Now(),
+		Progress:  *movie.Runtime,
+	}
+	if input.Progress != nil {
+		event.Progress = *input.Progress
+	}
+	if input.WatchedAt != nil {
+		event.WatchedAt = *input.WatchedAt
+	}
+
+	// Validate the input
+	v := validator.New()
+	if data.ValidateWatchEvent(v, event, movie); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	// Insert the watch event into the database
+	err = app.models.WatchEvents.Insert(event)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	// Return a 201 Created status code along with the watch event
+	err = app.writeJson(w, http.StatusCreated, envelope{"watch_event": event}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// listWatchHistoryHandler for the "GET /v1/users/me/history" endpoint
+// The history can be narrowed down with the inclusive "from" and "to" dates
+func (app *application) listWatchHistoryHandler(w http.ResponseWriter, r *http.Request) {
+	// Declare an input struct to hold the expected data from the client (Resquest DTO)
+	var input struct {
+		From *time.Time
+		To   *time.Time
+		data.Filters
+	}
+
+	// Validating the query string parameters
+	v := validator.New()
+	qs := r.URL.Query()
+
+	input.From = app.readDate(qs, "from", v)
+	input.To = app.readDate(qs, "to", v)
+
+	input.Filters.Page = app.readInt(qs, "page", 1, v)
+	input.Filters.PageSize = app.readInt(qs, "page_size", 20, v)
+
+	// The history is always ordered from the most recent event
+	input.Filters.Sort = "id"
+	input.Filters.SortSafelist = []string{"id"}
+
+	if input.From != nil && input.To != nil {
+		v.Check(!input.To.Before(*input.From), "to", "must not be before from")
+	}
+
+	if data.ValidateFilters(v, input.Filters); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	// Making the "to" date cover the whole day
+	if input.To != nil {
+		endOfDay := input.To.AddDate(0, 0, 1).Add(-time.Microsecond)
+		input.To = &endOfDay
+	}
+
+	// Retriving the watch events of the authenticated user
+	events, metadata, err := app.models.WatchEvents.GetForUser(app.contextGetUser(r).ID, input.From, input.To, input.Filters)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	// Return a 200 OK status code along with the watch events
+	err = app.writeJson(w, http.StatusOK, envelope{"history": events, "metadata": metadata}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// watchSummaryHandler for the "GET /v1/users/me/history/summary" endpoint
+// The summary covers the calendar year in the "year" parameter, which defaults to the current year
+func (app *application) watchSummaryHandler(w http.ResponseWriter, r *http.Request) {
+	// Validating the query string parameters
+	v := validator.New()
+	year := app.readInt(r.URL.Query(), "year", time.Now().UTC().Year(), v)
+
+	v.Check(year >= 1888, "year", "must be greater than 1888")
+	v.Check(year <= time.Now().UTC().Year(), "year", "must not be in the future")
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	// Summarizing the watch events of the authenticated user
+	summary, err := app.models.WatchEvents.GetSummary(app.contextGetUser(r).ID, year)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	// Return a 200 OK status code along with the summary
+	err = app.writeJson(w, http.StatusOK, envelope{"summary": summary}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
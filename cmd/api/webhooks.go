@@ -0,0 +1,404 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"moviego.madhav.net/internal/data"
+	"moviego.madhav.net/internal/validator"
+	"moviego.madhav.net/internal/webhook"
+)
+
+// Number of deliveries claimed by the worker at once
+const webhookBatchSize = 10
+
+// createWebhookHandler for the "POST /v1/webhooks" endpoint
+// A secret is generated when none is given, and is only shown in this response
+func (app *application) createWebhookHandler(w http.ResponseWriter, r *http.Request) {
+	// Declare an input struct to hold the expected data from the client (Resquest DTO)
+	var input struct {
+		URL    string   `json:"url"`
+		Events []string `json:"events"`
+		Secret string   `json:"secret"`
+		Active *bool    `json:"active"`
+	}
+
+	// Decode the request body into the input struct
+	err := app.readJson(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	hook := &data.Webhook{
+		URL:    input.URL,
+		Events: input.Events,
+		Secret: input.Secret,
+		Active: true,
+	}
+	if input.Active != nil {
+		hook.Active = *input.Active
+	}
+
+	if hook.Secret == "" {
+		hook.Secret, err = data.GenerateWebhookSecret()
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+	}
+
+	// Validate the input
+	v := validator.New()
+	if data.ValidateWebhook(v, hook); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	// Insert the webhook into the database
+	err = app.models.Webhooks.Insert(hook)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	// Add a Location header to the response containing the URL of the new webhook
+	headers := make(http.Header)
+	headers.Set("Location", "/v1/webhooks/"+strconv.FormatInt(hook.ID, 10))
+
+	// Return a 201 Created status code along with the webhook
+	err = app.writeJson(w, http.StatusCreated, envelope{"webhook": hook}, headers)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// listWebhooksHandler for the "GET /v1/webhooks" endpoint
+func (app *application) listWebhooksHandler(w http.ResponseWriter, r *http.Request) {
+	// Declare an input struct to hold the expected data from the client (Resquest DTO)
+	var input struct {
+		data.Filters
+	}
+
+	// Validating the query string parameters
+	v := validator.New()
+	qs := r.URL.Query()
+
+	input.Filters.Page = app.readInt(qs, "page", 1, v)
+	input.Filters.PageSize = app.readInt(qs, "page_size", 20, v)
+
+	// Webhooks are always ordered from the oldest
+	input.Filters.Sort = "id"
+	input.Filters.SortSafelist = []string{"id"}
+
+	if data.ValidateFilters(v, input.Filters); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	// Retriving the webhooks from the database
+	hooks, metadata, err := app.models.Webhooks.GetAll(input.Filters)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	// Return a 200 OK status code along with the webhooks
+	err = app.writeJson(w, http.StatusOK, envelope{"webhooks": hooks, "metadata": metadata}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// showWebhookHandler for the "GET /v1/webhooks/:id" endpoint
+func (app *application) showWebhookHandler(w http.ResponseWriter, r *http.Request) {
+	hook, ok := app.readWebhook(w, r)
+	if !ok {
+		return
+	}
+
+	// Return a 200 OK status code along with the webhook
+	err := app.writeJson(w, http.StatusOK, envelope{"webhook": hook}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// updateWebhookHandler for the "PATCH /v1/webhooks/:id" endpoint
+// The secret is only replaced when a new one is given
+func (app *application) updateWebhookHandler(w http.ResponseWriter, r *http.Request) {
+	hook, ok := app.readWebhook(w, r)
+	if !ok {
+		return
+	}
+
+	// Declare an input struct to hold the expected data from the client (Resquest DTO)
+	var input struct {
+		URL    *string  `json:"url"`
+		Events []string `json:"events"`
+		Secret *string  `json:"secret"`
+		Active *bool    `json:"active"`
+	}
+
+	// Decode the request body into the input struct
+	err := app.readJson(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	// Applying the fields which were given
+	if input.URL != nil {
+		hook.URL = *input.URL
+	}
+	if input.Events != nil {
+		hook.Events = input.Events
+	}
+	if input.Active != nil {
+		hook.Active = *input.Active
+	}
+
+	// Validate the input
+	v := validator.New()
+	if input.Secret != nil {
+		v.Check(*input.Secret != "", "secret", "must not be empty")
+		hook.Secret = *input.Secret
+	}
+	if data.ValidateWebhook(v, hook); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	// Update the webhook in the database
+	err = app.models.Webhooks.Update(hook)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrEditConflict):
+			app.editConflictResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	// The secret isn't shown again once it is set
+	hook.Secret = ""
+
+	// Return a 200 OK status code along with the webhook
+	err = app.writeJson(w, http.StatusOK, envelope{"webhook": hook}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// deleteWebhookHandler for the "DELETE /v1/webhooks/:id" endpoint
+func (app *application) deleteWebhookHandler(w http.ResponseWriter, r *http.Request) {
+	// Extract the id from the URL
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	// Delete the webhook from the database, along with its deliveries
+	err = app.models.Webhooks.Delete(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	// Return a 200 OK status code along with a success message
+	err = app.writeJson(w, http.StatusOK, envelope{"message": "webhook successfully deleted"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// listWebhookDeliveriesHandler for the "GET /v1/webhooks/:id/deliveries" endpoint
+// The status query string parameter narrows down the deliveries
+func (app *application) listWebhookDeliveriesHandler(w http.ResponseWriter, r *http.Request) {
+	hook, ok := app.readWebhook(w, r)
+	if !ok {
+		return
+	}
+
+	// Declare an input struct to hold the expected data from the client (Resquest DTO)
+	var input struct {
+		Status string
+		data.Filters
+	}
+
+	// Validating the query string parameters
+	v := validator.New()
+	qs := r.URL.Query()
+
+	input.Status = app.readString(qs, "status", "")
+	input.Filters.Page = app.readInt(qs, "page", 1, v)
+	input.Filters.PageSize = app.readInt(qs, "page_size", 20, v)
+
+	// Deliveries are always ordered from the most recent
+	input.Filters.Sort = "-id"
+	input.Filters.SortSafelist = []string{"-id"}
+
+	if input.Status != "" {
+		v.Check(validator.In(input.Status, data.DeliveryPending, data.DeliverySucceeded, data.DeliveryFailed), "status", "must be pending, succeeded or failed")
+	}
+
+	if data.ValidateFilters(v, input.Filters); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	// Retriving the deliveries from the database
+	deliveries, metadata, err := app.models.WebhookDeliveries.GetForWebhook(hook.ID, input.Status, input.Filters)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	// Return a 200 OK status code along with the deliveries
+	err = app.writeJson(w, http.StatusOK, envelope{"deliveries": deliveries, "metadata": metadata}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// redeliverWebhookHandler for the "POST /v1/webhooks/:id/deliveries/:delivery_id/redeliver" endpoint
+// The event is queued again as a new delivery, leaving the log of the original one untouched
+func (app *application) redeliverWebhookHandler(w http.ResponseWriter, r *http.Request) {
+	// Extract the ids from the URL
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	deliveryID, err := app.readIntParam(r, "delivery_id")
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	// Queuing the delivery again
+	delivery, err := app.models.WebhookDeliveries.Redeliver(id, deliveryID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	// Return a 202 Accepted status code along with the delivery, since it is sent by the worker
+	err = app.writeJson(w, http.StatusAccepted, envelope{"delivery": delivery}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// Read the webhook named in the URL
+// A response has already been sent when ok is false
+func (app *application) readWebhook(w http.ResponseWriter, r *http.Request) (*data.Webhook, bool) {
+	// Extract the id from the URL
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return nil, false
+	}
+
+	// Retriving the webhook from the database
+	hook, err := app.models.Webhooks.Get(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return nil, false
+	}
+
+	return hook, true
+}
+
+// Periodic task which sends the deliveries which are due, until none are left
+func (app *application) deliverWebhooks() {
+	for {
+		// Claiming a batch, leasing it for long enough to try every delivery in it
+		lease := webhookBatchSize * (app.config.webhooks.timeout + time.Second)
+		deliveries, err := app.models.WebhookDeliveries.Claim(webhookBatchSize, lease)
+		if err != nil {
+			app.logger.PrintError(err, nil)
+			return
+		}
+
+		for _, delivery := range deliveries {
+			app.attemptDelivery(delivery)
+		}
+
+		// Stopping once the queue is drained, or the application is shutting down
+		if len(deliveries) < webhookBatchSize {
+			return
+		}
+		select {
+		case <-app.shutdown:
+			return
+		default:
+		}
+	}
+}
+
+// Send a claimed delivery and record the outcome
+// Failed deliveries are retried with an exponential backoff, until they run out of attempts
+func (app *application) attemptDelivery(delivery *data.WebhookDelivery) {
+	status, err := app.webhooks.Send(context.Background(), webhook.Delivery{
+		ID:      delivery.ID,
+		Event:   delivery.Event,
+		URL:     delivery.URL,
+		Secret:  delivery.Secret,
+		Payload: delivery.Payload,
+	})
+
+	now := time.Now()
+	delivery.NextAttemptAt = nil
+	delivery.ResponseStatus = nil
+	delivery.LastError = ""
+	if status != 0 {
+		delivery.ResponseStatus = &status
+	}
+
+	switch {
+	case err == nil:
+		delivery.Status = data.DeliverySucceeded
+		delivery.DeliveredAt = &now
+	case delivery.Attempts >= app.config.webhooks.maxAttempts:
+		delivery.Status = data.DeliveryFailed
+		delivery.LastError = err.Error()
+	default:
+		// Doubling the wait after each attempt, up to a day
+		backoff := app.config.webhooks.backoff << (delivery.Attempts - 1)
+		if backoff <= 0 || backoff > 24*time.Hour {
+			backoff = 24 * time.Hour
+		}
+
+		next := now.Add(backoff)
+		delivery.Status = data.DeliveryPending
+		delivery.NextAttemptAt = &next
+		delivery.LastError = err.Error()
+	}
+
+	err = app.models.WebhookDeliveries.RecordAttempt(delivery)
+	if err != nil {
+		app.logger.PrintError(err, map[string]string{"delivery_id": strconv.FormatInt(delivery.ID, 10)})
+	}
+}
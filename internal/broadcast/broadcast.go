@@ -0,0 +1,75 @@
+package broadcast
+
+import (
+	"sync"
+)
+
+// Broker fans out the values published to it to every subscriber
+// Publishing never blocks, a subscriber which falls behind by more than its buffer is dropped instead,
+// and finds out through its channel being closed
+type Broker[T any] struct {
+	mu     sync.Mutex
+	buffer int
+	subs   map[chan T]struct{}
+	closed bool
+}
+
+// Factory function for creating a new broker, giving each subscriber a channel of the given buffer size
+func New[T any](buffer int) *Broker[T] {
+	return &Broker[T]{
+		buffer: buffer,
+		subs:   make(map[chan T]struct{}),
+	}
+}
+
+// Subscribe returns a channel receiving the values published from now on, and a function to unsubscribe
+// The channel is already closed when the broker is
+func (b *Broker[T]) Subscribe() (<-chan T, func()) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	ch := make(chan T, b.buffer)
+	if b.closed {
+		close(ch)
+		return ch, func() {}
+	}
+	b.subs[ch] = struct{}{}
+
+	return ch, func() {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+
+		// The channel may already have been closed by a drop or by Close()
+		if _, ok := b.subs[ch]; ok {
+			delete(b.subs, ch)
+			close(ch)
+		}
+	}
+}
+
+// Publish sends the value to every subscriber, dropping the ones whose buffer is full
+func (b *Broker[T]) Publish(v T) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for ch := range b.subs {
+		select {
+		case ch <- v:
+		default:
+			delete(b.subs, ch)
+			close(ch)
+		}
+	}
+}
+
+// Close closes the channel of every subscriber, and of the ones subscribing afterwards
+func (b *Broker[T]) Close() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for ch := range b.subs {
+		delete(b.subs, ch)
+		close(ch)
+	}
+	b.closed = true
+}
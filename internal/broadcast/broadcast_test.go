@@ -0,0 +1,110 @@
+package broadcast
+
+import (
+	"testing"
+)
+
+// Receive every value queued on the channel without blocking, and whether it is still open
+func drain(ch <-chan int) ([]int, bool) {
+	var values []int
+	for {
+		select {
+		case v, ok := <-ch:
+			if !ok {
+				return values, false
+			}
+			values = append(values, v)
+		default:
+			return values, true
+		}
+	}
+}
+
+func TestBroker(t *testing.T) {
+	tests := []struct {
+		name     string
+		buffer   int
+		publish  []int
+		want     []int
+		wantOpen bool
+	}{
+		{name: "Nothing published", buffer: 2, publish: nil, want: nil, wantOpen: true},
+		{name: "Within the buffer", buffer: 2, publish: []int{1, 2}, want: []int{1, 2}, wantOpen: true},
+		{name: "Falls behind", buffer: 2, publish: []int{1, 2, 3}, want: []int{1, 2}, wantOpen: false},
+		{name: "No buffer", buffer: 0, publish: []int{1}, want: nil, wantOpen: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := New[int](tt.buffer)
+			ch, unsubscribe := b.Subscribe()
+			defer unsubscribe()
+
+			for _, v := range tt.publish {
+				b.Publish(v)
+			}
+
+			got, open := drain(ch)
+			if !equal(got, tt.want) {
+				t.Errorf("got %v; want %v", got, tt.want)
+			}
+			if open != tt.wantOpen {
+				t.Errorf("got open %t; want %t", open, tt.wantOpen)
+			}
+		})
+	}
+}
+
+func TestBrokerFanOut(t *testing.T) {
+	b := New[int](4)
+	first, unsubscribeFirst := b.Subscribe()
+	second, unsubscribeSecond := b.Subscribe()
+	defer unsubscribeSecond()
+
+	b.Publish(1)
+	unsubscribeFirst()
+	b.Publish(2)
+
+	// The first subscriber only got the value published before it unsubscribed, and its channel is closed
+	if got, open := drain(first); !equal(got, []int{1}) || open {
+		t.Errorf("got %v, open %t for the first subscriber; want [1], closed", got, open)
+	}
+	if got, open := drain(second); !equal(got, []int{1, 2}) || !open {
+		t.Errorf("got %v, open %t for the second subscriber; want [1 2], open", got, open)
+	}
+
+	// Unsubscribing again is harmless
+	unsubscribeFirst()
+}
+
+func TestBrokerClose(t *testing.T) {
+	b := New[int](4)
+	before, unsubscribe := b.Subscribe()
+
+	b.Close()
+
+	if _, open := drain(before); open {
+		t.Error("got an open channel for a subscriber of a closed broker; want closed")
+	}
+
+	// Unsubscribing after the close, and subscribing to a closed broker, are both harmless
+	unsubscribe()
+	after, _ := b.Subscribe()
+	if _, open := drain(after); open {
+		t.Error("got an open channel when subscribing to a closed broker; want closed")
+	}
+
+	b.Publish(1)
+}
+
+func equal(a, b []int) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,101 @@
+package cache
+
+import (
+	"container/list"
+	"sync"
+	"time"
+)
+
+// Cache is an in-memory, size bounded cache which evicts the least recently used entry when full
+// Entries also expire after a fixed time to live, so that stale values are eventually refreshed
+type Cache[K comparable, V any] struct {
+	mu       sync.Mutex
+	capacity int
+	ttl      time.Duration
+	items    map[K]*list.Element
+	order    *list.List
+}
+
+// Entry struct held by each element of the recency list
+type entry[K comparable, V any] struct {
+	key    K
+	value  V
+	expiry time.Time
+}
+
+// Factory function for creating a new cache
+func New[K comparable, V any](capacity int, ttl time.Duration) *Cache[K, V] {
+	return &Cache[K, V]{
+		capacity: capacity,
+		ttl:      ttl,
+		items:    make(map[K]*list.Element),
+		order:    list.New(),
+	}
+}
+
+// Get the value for a key, reporting whether a live entry was found
+func (c *Cache[K, V]) Get(key K) (V, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var zero V
+
+	// Checking if the key is present in the cache
+	element, ok := c.items[key]
+	if !ok {
+		return zero, false
+	}
+
+	// Removing the entry if it has expired
+	e := element.Value.(*entry[K, V])
+	if time.Now().After(e.expiry) {
+		c.order.Remove(element)
+		delete(c.items, key)
+		return zero, false
+	}
+
+	// Marking the entry as the most recently used
+	c.order.MoveToFront(element)
+
+	return e.value, true
+}
+
+// Set the value for a key, evicting the least recently used entry if the cache is full
+func (c *Cache[K, V]) Set(key K, value V) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	// A cache with no capacity never holds anything
+	if c.capacity < 1 {
+		return
+	}
+
+	expiry := time.Now().Add(c.ttl)
+
+	// Updating the entry in place if the key is already present
+	if element, ok := c.items[key]; ok {
+		e := element.Value.(*entry[K, V])
+		e.value = value
+		e.expiry = expiry
+		c.order.MoveToFront(element)
+		return
+	}
+
+	// Evicting the least recently used entry to make room
+	if c.order.Len() >= c.capacity {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.items, oldest.Value.(*entry[K, V]).key)
+	}
+
+	c.items[key] = c.order.PushFront(&entry[K, V]{key: key, value: value, expiry: expiry})
+}
+
+// Clear removes every entry from the cache
+func (c *Cache[K, V]) Clear() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.items = make(map[K]*list.Element)
+	c.order.Init()
+}
@@ -0,0 +1,129 @@
+package cache
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCache(t *testing.T) {
+	type op struct {
+		set    bool   // Set the key to the value rather than getting it
+		key    string // Key to set or get
+		value  int    // Value to set, or expected value of a get
+		wantOK bool   // Whether a get is expected to find the key
+	}
+
+	tests := []struct {
+		name     string
+		capacity int
+		ops      []op
+	}{
+		{
+			name:     "Miss",
+			capacity: 2,
+			ops: []op{
+				{key: "a"},
+			},
+		},
+		{
+			name:     "Hit",
+			capacity: 2,
+			ops: []op{
+				{set: true, key: "a", value: 1},
+				{key: "a", value: 1, wantOK: true},
+			},
+		},
+		{
+			name:     "Overwrite",
+			capacity: 2,
+			ops: []op{
+				{set: true, key: "a", value: 1},
+				{set: true, key: "a", value: 2},
+				{key: "a", value: 2, wantOK: true},
+			},
+		},
+		{
+			name:     "Evicts the least recently set",
+			capacity: 2,
+			ops: []op{
+				{set: true, key: "a", value: 1},
+				{set: true, key: "b", value: 2},
+				{set: true, key: "c", value: 3},
+				{key: "a"},
+				{key: "b", value: 2, wantOK: true},
+				{key: "c", value: 3, wantOK: true},
+			},
+		},
+		{
+			name:     "Evicts the least recently read",
+			capacity: 2,
+			ops: []op{
+				{set: true, key: "a", value: 1},
+				{set: true, key: "b", value: 2},
+				{key: "a", value: 1, wantOK: true},
+				{set: true, key: "c", value: 3},
+				{key: "a", value: 1, wantOK: true},
+				{key: "b"},
+				{key: "c", value: 3, wantOK: true},
+			},
+		},
+		{
+			name:     "No capacity",
+			capacity: 0,
+			ops: []op{
+				{set: true, key: "a", value: 1},
+				{key: "a"},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := New[string, int](tt.capacity, time.Hour)
+
+			for i, op := range tt.ops {
+				if op.set {
+					c.Set(op.key, op.value)
+					continue
+				}
+
+				value, ok := c.Get(op.key)
+				if ok != op.wantOK || value != op.value {
+					t.Errorf("op %d: got Get(%q) = %d, %t; want %d, %t", i, op.key, value, ok, op.value, op.wantOK)
+				}
+			}
+		})
+	}
+}
+
+func TestCacheExpiry(t *testing.T) {
+	c := New[string, int](2, time.Millisecond)
+	c.Set("a", 1)
+
+	time.Sleep(5 * time.Millisecond)
+
+	if value, ok := c.Get("a"); ok {
+		t.Errorf("got %d from an expired entry; want a miss", value)
+	}
+}
+
+func TestCacheClear(t *testing.T) {
+	c := New[string, int](2, time.Hour)
+	c.Set("a", 1)
+	c.Set("b", 2)
+
+	c.Clear()
+
+	for _, key := range []string{"a", "b"} {
+		if value, ok := c.Get(key); ok {
+			t.Errorf("got %d for %q after clearing; want a miss", value, key)
+		}
+	}
+
+	// The cache is still usable, and holds its full capacity again
+	c.Set("c", 3)
+	c.Set("d", 4)
+	if _, ok := c.Get("c"); !ok {
+		t.Error("got a miss for \"c\" after clearing; want a hit")
+	}
+}
@@ -0,0 +1,233 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"time"
+)
+
+// Define the kinds of activity recorded for the feed
+// Reviews and lists aren't modelled yet, their kinds can be added here once they are
+const (
+	ActivityMovieRated = "movie_rated"
+)
+
+// Define who can see an activity event, mirroring the visibility of the thing the event is about
+const (
+	VisibilityPublic    = "public"
+	VisibilityFollowers = "followers"
+	VisibilityPrivate   = "private"
+)
+
+// Defining custom errors for follows
+var (
+	ErrSelfFollow = errors.New("cannot follow yourself")
+)
+
+// ActivityEvent struct which holds something a user did, as shown in the feed of their followers
+type ActivityEvent struct {
+	ID         int64          `json:"id"`
+	CreatedAt  time.Time      `json:"created_at"`
+	UserID     int64          `json:"user_id"`
+	UserName   string         `json:"user_name,omitempty"` // Name of the user, set by GetFeed
+	Kind       string         `json:"kind"`
+	MovieID    *int64         `json:"movie_id,omitempty"`
+	MovieTitle *string        `json:"movie_title,omitempty"` // Title of the movie, set by GetFeed
+	Data       map[string]any `json:"data,omitempty"`        // Details of the event, such as the rating given
+	Visibility string         `json:"visibility"`
+}
+
+// Defining the ActivityModel struct to hold the database connection pool
+type ActivityModel struct {
+	DB *sql.DB
+}
+
+// Record the rating of a movie in the activity of the user using the given transaction
+// A user has a single movie_rated event for each movie, which a new rating replaces and moves back to the top of
+// the feed with a new id. Nothing changes when the rating and its visibility are the same as before
+func upsertRatingActivity(ctx context.Context, db dbtx, rating *Rating, visibility string) error {
+	// Encoding the details to be stored as JSON
+	js, err := json.Marshal(map[string]any{"rating": rating.Rating})
+	if err != nil {
+		return err
+	}
+
+	// Defining the SQL query for inserting or replacing the record
+	query := `
+		INSERT INTO activity_events (user_id, kind, movie_id, data, visibility)
+		VALUES ($1, $2, $3, $4, $5)
+		ON CONFLICT (user_id, kind, movie_id) WHERE kind = 'movie_rated' DO UPDATE
+		SET id = nextval('activity_events_id_seq'), created_at = now(), data = EXCLUDED.data, visibility = EXCLUDED.visibility
+		WHERE activity_events.data <> EXCLUDED.data OR activity_events.visibility <> EXCLUDED.visibility`
+
+	// Executing the query
+	_, err = db.ExecContext(ctx, query, rating.UserID, ActivityMovieRated, rating.MovieID, js, visibility)
+	return err
+}
+
+// Remove the rating of a movie from the activity of the user using the given transaction
+func deleteRatingActivity(ctx context.Context, db dbtx, userID, movieID int64) error {
+	query := `
+		DELETE FROM activity_events
+		WHERE user_id = $1 AND kind = $2 AND movie_id = $3`
+
+	_, err := db.ExecContext(ctx, query, userID, ActivityMovieRated, movieID)
+	return err
+}
+
+// List the events of the users followed by the given user, most recent first
+// Private events are never shown, and the events of movies in the trash are left out
+// The feed is paginated by keyset, a cursor holding the id of the last event seen
+func (m ActivityModel) GetFeed(userID int64, filters Filters) ([]*ActivityEvent, Metadata, error) {
+	// Decoding the cursor, which is nil for the first page
+	c, err := filters.keyset()
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+
+	before := int64(0)
+	if c != nil {
+		before = c.ID
+	}
+
+	// Defining the SQL query for retrieving the events, fetching one extra row to find out whether there is another page
+	query := `
+		SELECT e.id, e.created_at, e.user_id, u.name, e.kind, e.movie_id, m.title, e.data, e.visibility
+		FROM activity_events e
+		INNER JOIN follows f ON f.followed_id = e.user_id AND f.follower_id = $1
+		INNER JOIN users u ON u.id = e.user_id
+		LEFT JOIN movies m ON m.id = e.movie_id
+		WHERE e.visibility IN ('public', 'followers')
+		AND (e.movie_id IS NULL OR m.deleted_at IS NULL)
+		AND (e.id < $2 OR $2 = 0)
+		ORDER BY e.id DESC
+		LIMIT $3`
+
+	// Creating a new context with a 3 second timeout
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	// Executing the query using the DB connection pool
+	rows, err := m.DB.QueryContext(ctx, query, userID, before, filters.limit()+1)
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+	defer rows.Close()
+
+	// Looping through the rows in the result set
+	events := []*ActivityEvent{}
+	for rows.Next() {
+		var event ActivityEvent
+		var js []byte
+
+		err := rows.Scan(
+			&event.ID,
+			&event.CreatedAt,
+			&event.UserID,
+			&event.UserName,
+			&event.Kind,
+			&event.MovieID,
+			&event.MovieTitle,
+			&js,
+			&event.Visibility,
+		)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+
+		err = json.Unmarshal(js, &event.Data)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+
+		events = append(events, &event)
+	}
+
+	// Handling the errors encountered during the rows.Next() loop
+	if err = rows.Err(); err != nil {
+		return nil, Metadata{}, err
+	}
+
+	// Handing out a cursor for the next page when there is one
+	metadata := Metadata{PageSize: filters.PageSize}
+	if len(events) > filters.limit() {
+		events = events[:filters.limit()]
+		metadata.NextCursor = cursor{Sort: filters.Sort, ID: events[len(events)-1].ID}.encode()
+	}
+
+	return events, metadata, nil
+}
+
+// Defining the FollowModel struct to hold the database connection pool
+type FollowModel struct {
+	DB *sql.DB
+}
+
+// Make a user follow another user, which does nothing when they already follow them
+// Whether the follow is new is returned, so that the followed user is only told once
+func (m FollowModel) Insert(followerID, followedID int64) (bool, error) {
+	if followerID == followedID {
+		return false, ErrSelfFollow
+	}
+
+	// Defining the SQL query for inserting the follow
+	query := `
+		INSERT INTO follows (follower_id, followed_id)
+		VALUES ($1, $2)
+		ON CONFLICT DO NOTHING`
+
+	// Creating a new context with a 3 second timeout
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	// Executing the query using the DB connection pool
+	result, err := m.DB.ExecContext(ctx, query, followerID, followedID)
+	if err != nil {
+		switch {
+		// If the followed user doesn't exist, return the ErrRecordNotFound error
+		case err.Error() == `pq: insert or update on table "follows" violates foreign key constraint "follows_followed_id_fkey"`:
+			return false, ErrRecordNotFound
+		default:
+			return false, err
+		}
+	}
+
+	// Checking if the follow was inserted
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+
+	return rowsAffected > 0, nil
+}
+
+// Make a user stop following another user
+func (m FollowModel) Delete(followerID, followedID int64) error {
+	// Defining the SQL query for deleting the follow
+	query := `
+		DELETE FROM follows
+		WHERE follower_id = $1 AND followed_id = $2`
+
+	// Creating a new context with a 3 second timeout
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	// Executing the query using the DB connection pool
+	result, err := m.DB.ExecContext(ctx, query, followerID, followedID)
+	if err != nil {
+		return err
+	}
+
+	// Checking if the follow was found
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+
+	return nil
+}
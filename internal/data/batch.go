@@ -0,0 +1,191 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"moviego.madhav.net/internal/validator"
+)
+
+// Define the different kinds of operation in a movie batch
+const (
+	OpCreate = "create"
+	OpPatch  = "patch"
+	OpDelete = "delete"
+)
+
+// Defining a custom error for operations which failed validation, the errors are held in the result
+var ErrFailedValidation = errors.New("failed validation")
+
+// MovieOperation struct which holds a single create, patch or delete operation of a batch
+// The movie fields are only used by create and patch operations, and nil fields are left unchanged by a patch
+type MovieOperation struct {
+	Op              string
+	ID              int64
+	ExpectedVersion *int32
+	Title           *string
+	Year            *int32
+	Runtime         *int32
+	Genres          []string
+}
+
+// MovieOperationResult struct which holds the outcome of a single operation of a batch
+type MovieOperationResult struct {
+	Movie  *Movie            // Movie as created or patched, or as it was before being deleted
+	Errors map[string]string // Validation errors, when Err is ErrFailedValidation
+	Err    error             // Error of the operation, or nil if it succeeded
+}
+
+// Validate the operations of a batch before they are applied
+func ValidateMovieOperations(v *validator.Validator, ops []MovieOperation) {
+	v.Check(len(ops) >= 1, "operations", "must contain at least 1 operation")
+	v.Check(len(ops) <= 100, "operations", "must not contain more than 100 operations")
+
+	for _, op := range ops {
+		if !validator.In(op.Op, OpCreate, OpPatch, OpDelete) {
+			v.AddError("operations", "must only contain create, patch or delete operations")
+		}
+		if op.Op != OpCreate && op.ID < 1 {
+			v.AddError("operations", "patch and delete operations must have an id")
+		}
+	}
+}
+
+// Apply a batch of operations on the movies table within a single transaction
+// In atomic mode the whole batch is rolled back as soon as one operation fails, and ErrBatchAborted is returned
+// Otherwise every operation is guarded by a savepoint, so that a failing operation doesn't affect the others
+func (m MovieModel) ApplyOperations(ops []MovieOperation, atomic bool) ([]MovieOperationResult, error) {
+	// Creating a new context with a timeout which grows with the size of the batch
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second+time.Duration(len(ops))*10*time.Millisecond)
+	defer cancel()
+
+	// Starting the transaction, which is rolled back unless it is committed below
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	results := make([]MovieOperationResult, len(ops))
+	_, err = runBatch(ctx, tx, len(ops), atomic, func(i int) error {
+		results[i] = applyOperation(ctx, tx, ops[i])
+		return results[i].Err
+	})
+	if err != nil {
+		return results, err
+	}
+
+	// Committing the transaction
+	err = tx.Commit()
+	if err != nil {
+		return nil, err
+	}
+
+	return results, nil
+}
+
+// Apply a single operation of a batch within the transaction
+func applyOperation(ctx context.Context, tx *sql.Tx, op MovieOperation) MovieOperationResult {
+	var movie *Movie
+
+	switch op.Op {
+	case OpCreate:
+		// Starting from zero values, so that missing fields fail validation
+		var title string
+		var year, runtime int32
+		movie = &Movie{Title: &title, Year: &year, Runtime: &runtime}
+
+	default:
+		// Retrieving the movie the operation applies to
+		var err error
+		movie, err = getMovie(ctx, tx, op.ID)
+		if err != nil {
+			return MovieOperationResult{Err: err}
+		}
+
+		// Checking the version the client expected to be working on
+		if op.ExpectedVersion != nil && *op.ExpectedVersion != movie.Version {
+			return MovieOperationResult{Err: ErrEditConflict}
+		}
+
+		if op.Op == OpDelete {
+			return MovieOperationResult{Movie: movie, Err: deleteMovie(ctx, tx, op.ID)}
+		}
+	}
+
+	// Copying the provided fields across to the movie
+	if op.Title != nil {
+		movie.Title = op.Title
+	}
+	if op.Year != nil {
+		movie.Year = op.Year
+	}
+	if op.Runtime != nil {
+		movie.Runtime = op.Runtime
+	}
+	if op.Genres != nil {
+		movie.Genres = op.Genres
+	}
+
+	// Validating the resulting movie
+	v := validator.New()
+	if ValidateMovie(v, movie); !v.Valid() {
+		return MovieOperationResult{Errors: v.Errors, Err: ErrFailedValidation}
+	}
+
+	// Writing the movie
+	var err error
+	if op.Op == OpCreate {
+		err = insertMovie(ctx, tx, movie)
+	} else {
+		err = updateMovie(ctx, tx, movie)
+	}
+	if err != nil {
+		return MovieOperationResult{Err: err}
+	}
+
+	return MovieOperationResult{Movie: movie}
+}
+
+// Run fn for each of the n items of a batch within the transaction
+// In atomic mode the batch stops at the first error and ErrBatchAborted is returned
+// Otherwise every item is guarded by a savepoint, so that its failure only rolls back its own changes
+// The returned slice holds the error for each item which was run
+func runBatch(ctx context.Context, tx *sql.Tx, n int, atomic bool, fn func(i int) error) ([]error, error) {
+	errs := make([]error, n)
+	for i := 0; i < n; i++ {
+		// Aborting the whole batch on the first failure in atomic mode
+		if atomic {
+			errs[i] = fn(i)
+			if errs[i] != nil {
+				return errs, ErrBatchAborted
+			}
+			continue
+		}
+
+		// Setting a savepoint to roll back to if this item fails
+		_, err := tx.ExecContext(ctx, "SAVEPOINT batch_item")
+		if err != nil {
+			return nil, err
+		}
+
+		errs[i] = fn(i)
+		if errs[i] != nil {
+			_, err = tx.ExecContext(ctx, "ROLLBACK TO SAVEPOINT batch_item")
+		} else {
+			_, err = tx.ExecContext(ctx, "RELEASE SAVEPOINT batch_item")
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return errs, nil
+}
+
+// Apply a batch of operations on the movies table
+func (m MockMovieModel) ApplyOperations(ops []MovieOperation, atomic bool) ([]MovieOperationResult, error) {
+	return make([]MovieOperationResult, len(ops)), nil
+}
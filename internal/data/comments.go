@@ -0,0 +1,399 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"moviego.madhav.net/internal/validator"
+)
+
+// Defining custom errors for comments
+var (
+	ErrInvalidParent   = errors.New("invalid parent comment")
+	ErrDuplicateReport = errors.New("duplicate report")
+)
+
+// Comment struct which holds a comment on a movie, along with the replies to it
+// The body of deleted and hidden comments is left out, their place in the thread is kept for the replies
+type Comment struct {
+	ID        int64      `json:"id"`
+	CreatedAt time.Time  `json:"created_at"`
+	EditedAt  *time.Time `json:"edited_at,omitempty"`
+	MovieID   int64      `json:"movie_id"`
+	UserID    int64      `json:"user_id"`
+	UserName  string     `json:"user_name,omitempty"`
+	ParentID  *int64     `json:"parent_id,omitempty"`
+	Body      string     `json:"body"`
+	Deleted   bool       `json:"deleted,omitempty"`
+	Hidden    bool       `json:"hidden,omitempty"`
+	Reports   int        `json:"reports,omitempty"` // Number of times the comment was reported, only set for moderators
+	Version   int32      `json:"version"`
+	Replies   []*Comment `json:"replies,omitempty"`
+}
+
+// Validate method which validates the body of the comment
+func ValidateComment(v *validator.Validator, comment *Comment) {
+	v.Check(comment.Body != "", "body", "must be provided")
+	v.Check(len(comment.Body) <= 2000, "body", "must not be more than 2000 bytes long")
+	v.Check(validator.NotBlocked(comment.Body), "body", "must not contain blocked words")
+}
+
+// Defining the CommentModel struct to hold the database connection pool
+type CommentModel struct {
+	DB *sql.DB
+}
+
+// Insert a new comment into the comments table, which fails for movies in the trash
+// A reply must belong to the same movie as its parent, and can't reply to a deleted or hidden comment
+func (m CommentModel) Insert(comment *Comment) error {
+	// Creating a new context with a 3 second timeout
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	// Checking the parent comment
+	if comment.ParentID != nil {
+		query := `
+			SELECT EXISTS (
+				SELECT 1 FROM comments
+				WHERE id = $1 AND movie_id = $2 AND deleted_at IS NULL AND hidden_at IS NULL
+			)`
+
+		var ok bool
+		err := m.DB.QueryRowContext(ctx, query, *comment.ParentID, comment.MovieID).Scan(&ok)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return ErrInvalidParent
+		}
+	}
+
+	// Defining the SQL query for inserting a new record
+	query := `
+		INSERT INTO comments (movie_id, user_id, parent_id, body)
+		SELECT id, $2, $3, $4
+		FROM movies
+		WHERE id = $1 AND deleted_at IS NULL
+		RETURNING id, created_at, version`
+
+	// Creating an args slice to store the values for the placeholder parameters
+	args := []any{comment.MovieID, comment.UserID, comment.ParentID, comment.Body}
+
+	// Executing the query using the DB connection pool
+	err := m.DB.QueryRowContext(ctx, query, args...).Scan(&comment.ID, &comment.CreatedAt, &comment.Version)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrRecordNotFound
+		default:
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Get a specific comment based on its id, which isn't found once it is deleted
+func (m CommentModel) Get(id int64) (*Comment, error) {
+	// Validating the id parameter
+	if id < 1 {
+		return nil, ErrRecordNotFound
+	}
+
+	// Defining the SQL query for retrieving the comment record
+	query := `
+		SELECT c.id, c.created_at, c.edited_at, c.movie_id, c.user_id, u.name, c.parent_id, c.body,
+			c.deleted_at IS NOT NULL, c.hidden_at IS NOT NULL, c.version
+		FROM comments c
+		INNER JOIN users u ON u.id = c.user_id
+		WHERE c.id = $1 AND c.deleted_at IS NULL`
+
+	// Creating a new context with a 3 second timeout
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	// Executing the query using the DB connection pool
+	comment, err := scanComment(m.DB.QueryRowContext(ctx, query, id))
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return comment, nil
+}
+
+// Update the body of a comment, as long as it didn't change since it was read
+func (m CommentModel) Update(comment *Comment) error {
+	// Defining the SQL query for updating the comment record
+	query := `
+		UPDATE comments
+		SET body = $1, edited_at = now(), version = version + 1
+		WHERE id = $2 AND version = $3 AND deleted_at IS NULL AND hidden_at IS NULL
+		RETURNING edited_at, version`
+
+	// Creating a new context with a 3 second timeout
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	// Executing the query using the DB connection pool
+	err := m.DB.QueryRowContext(ctx, query, comment.Body, comment.ID, comment.Version).Scan(&comment.EditedAt, &comment.Version)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrEditConflict
+		default:
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Delete a comment of the given user
+// The comment is only marked as deleted, so that the replies to it keep their place in the thread
+func (m CommentModel) Delete(id, userID int64) error {
+	// Validating the id parameter
+	if id < 1 {
+		return ErrRecordNotFound
+	}
+
+	// Defining the SQL query for soft deleting the comment record
+	query := `
+		UPDATE comments
+		SET deleted_at = now(), version = version + 1
+		WHERE id = $1 AND user_id = $2 AND deleted_at IS NULL`
+
+	// Creating a new context with a 3 second timeout
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	// Executing the query using the DB connection pool
+	result, err := m.DB.ExecContext(ctx, query, id, userID)
+	if err != nil {
+		return err
+	}
+
+	// Checking if the comment record was found
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+
+	return nil
+}
+
+// Hide a comment on behalf of a moderator, recording who hid it and why
+func (m CommentModel) Hide(id, moderatorID int64, reason string) error {
+	// Validating the id parameter
+	if id < 1 {
+		return ErrRecordNotFound
+	}
+
+	// Defining the SQL query for hiding the comment record
+	query := `
+		UPDATE comments
+		SET hidden_at = now(), hidden_by = $2, hidden_reason = $3, version = version + 1
+		WHERE id = $1 AND deleted_at IS NULL AND hidden_at IS NULL`
+
+	// Creating a new context with a 3 second timeout
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	// Executing the query using the DB connection pool
+	result, err := m.DB.ExecContext(ctx, query, id, moderatorID, reason)
+	if err != nil {
+		return err
+	}
+
+	// Checking if the comment record was found
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+
+	return nil
+}
+
+// Report a comment to the moderators, once per user
+func (m CommentModel) Report(id, userID int64, reason string) error {
+	// Defining the SQL query for inserting the report, which only inserts for visible comments
+	query := `
+		INSERT INTO comment_reports (comment_id, user_id, reason)
+		SELECT id, $2, $3
+		FROM comments
+		WHERE id = $1 AND deleted_at IS NULL AND hidden_at IS NULL`
+
+	// Creating a new context with a 3 second timeout
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	// Executing the query using the DB connection pool
+	result, err := m.DB.ExecContext(ctx, query, id, userID, reason)
+	if err != nil {
+		switch {
+		case err.Error() == `pq: duplicate key value violates unique constraint "comment_reports_pkey"`:
+			return ErrDuplicateReport
+		default:
+			return err
+		}
+	}
+
+	// Checking if the comment record was found
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+
+	return nil
+}
+
+// List the threads of comments on a movie, oldest first
+// The top level comments are paginated, and each of them comes with all of its replies nested below it
+func (m CommentModel) GetForMovie(movieID int64, filters Filters) ([]*Comment, Metadata, error) {
+	// Creating a new context with a 3 second timeout
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	// Defining the SQL query for retrieving the top level comments of the page and all of their replies
+	query := `
+		WITH RECURSIVE roots AS (
+			SELECT count(*) OVER() AS total, id
+			FROM comments
+			WHERE movie_id = $1 AND parent_id IS NULL
+			ORDER BY id ASC
+			LIMIT $2 OFFSET $3
+		), thread AS (
+			SELECT c.* FROM comments c INNER JOIN roots ON roots.id = c.id
+			UNION ALL
+			SELECT c.* FROM comments c INNER JOIN thread t ON c.parent_id = t.id
+		)
+		SELECT coalesce((SELECT max(total) FROM roots), 0),
+			t.id, t.created_at, t.edited_at, t.movie_id, t.user_id, u.name, t.parent_id,
+			CASE WHEN t.deleted_at IS NULL AND t.hidden_at IS NULL THEN t.body ELSE '' END,
+			t.deleted_at IS NOT NULL, t.hidden_at IS NOT NULL, t.version
+		FROM thread t
+		INNER JOIN users u ON u.id = t.user_id
+		ORDER BY t.id ASC`
+
+	// Executing the query using the DB connection pool
+	rows, err := m.DB.QueryContext(ctx, query, movieID, filters.limit(), filters.offset())
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+	defer rows.Close()
+
+	// Looping through the rows, which come in creation order so that every parent comes before its replies
+	totalRecords := 0
+	roots := []*Comment{}
+	byID := make(map[int64]*Comment)
+	for rows.Next() {
+		comment, err := scanComment(rows, &totalRecords)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+
+		byID[comment.ID] = comment
+		if comment.ParentID == nil {
+			roots = append(roots, comment)
+		} else if parent, ok := byID[*comment.ParentID]; ok {
+			parent.Replies = append(parent.Replies, comment)
+		}
+	}
+
+	// Handling the errors encountered during the rows.Next() loop
+	if err = rows.Err(); err != nil {
+		return nil, Metadata{}, err
+	}
+
+	return roots, calculateMetadata(totalRecords, filters.Page, filters.PageSize), nil
+}
+
+// List the comments which were reported and are still visible, most reported first
+func (m CommentModel) GetReported(filters Filters) ([]*Comment, Metadata, error) {
+	// Defining the SQL query for retrieving the reported comments
+	query := `
+		SELECT count(*) OVER(), r.reports, c.id, c.created_at, c.edited_at, c.movie_id, c.user_id, u.name, c.parent_id, c.body,
+			false, false, c.version
+		FROM comments c
+		INNER JOIN users u ON u.id = c.user_id
+		INNER JOIN (
+			SELECT comment_id, count(*) AS reports FROM comment_reports GROUP BY comment_id
+		) AS r ON r.comment_id = c.id
+		WHERE c.deleted_at IS NULL AND c.hidden_at IS NULL
+		ORDER BY r.reports DESC, c.id ASC
+		LIMIT $1 OFFSET $2`
+
+	// Creating a new context with a 3 second timeout
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	// Executing the query using the DB connection pool
+	rows, err := m.DB.QueryContext(ctx, query, filters.limit(), filters.offset())
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+	defer rows.Close()
+
+	// Looping through the rows in the result set
+	totalRecords := 0
+	comments := []*Comment{}
+	for rows.Next() {
+		var reports int
+		comment, err := scanComment(rows, &totalRecords, &reports)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+
+		comment.Reports = reports
+		comments = append(comments, comment)
+	}
+
+	// Handling the errors encountered during the rows.Next() loop
+	if err = rows.Err(); err != nil {
+		return nil, Metadata{}, err
+	}
+
+	return comments, calculateMetadata(totalRecords, filters.Page, filters.PageSize), nil
+}
+
+// Scan a comment from a row holding its columns in the order used by the queries above
+// Any leading columns, such as the total count, are scanned into prefix
+func scanComment(row interface{ Scan(dest ...any) error }, prefix ...any) (*Comment, error) {
+	var comment Comment
+
+	dest := append(prefix,
+		&comment.ID,
+		&comment.CreatedAt,
+		&comment.EditedAt,
+		&comment.MovieID,
+		&comment.UserID,
+		&comment.UserName,
+		&comment.ParentID,
+		&comment.Body,
+		&comment.Deleted,
+		&comment.Hidden,
+		&comment.Version,
+	)
+
+	err := row.Scan(dest...)
+	if err != nil {
+		return nil, err
+	}
+
+	return &comment, nil
+}
@@ -0,0 +1,187 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"regexp"
+	"time"
+
+	"github.com/lib/pq"
+	"moviego.madhav.net/internal/validator"
+)
+
+// Define the outside datasets a movie can be identified in
+const (
+	ProviderIMDb     = "imdb"
+	ProviderTMDB     = "tmdb"
+	ProviderWikidata = "wikidata"
+)
+
+// Defining a custom error for an external id which already belongs to another movie
+var ErrDuplicateExternalID = errors.New("duplicate external id")
+
+// Regexes matching the identifiers of each provider, such as "tt0111161", "278" and "Q172241"
+var externalIDRX = map[string]*regexp.Regexp{
+	ProviderIMDb:     regexp.MustCompile(`^tt[0-9]{7,10}$`),
+	ProviderTMDB:     regexp.MustCompile(`^[1-9][0-9]{0,9}$`),
+	ProviderWikidata: regexp.MustCompile(`^Q[1-9][0-9]*$`),
+}
+
+// Validate the external ids of a movie, keyed by provider
+// An empty id is allowed, and removes the id of that provider when the movie is saved
+func ValidateExternalIDs(v *validator.Validator, ids map[string]string) {
+	for provider, id := range ids {
+		rx, ok := externalIDRX[provider]
+		if !ok {
+			v.AddError("external_ids", "must only contain imdb, tmdb or wikidata ids")
+			continue
+		}
+
+		v.Check(id == "" || validator.Matches(id, rx), "external_ids", "must contain a valid "+provider+" id")
+	}
+}
+
+// Lookup the movie which has the given id in the given provider
+func (m MovieModel) Lookup(provider, externalID string) (*Movie, error) {
+	// Defining the SQL query for finding the movie id
+	query := `
+		SELECT movie_id
+		FROM external_ids
+		WHERE provider = $1 AND external_id = $2`
+
+	// Creating a new context with a 3 second timeout
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	// Executing the query using the DB connection pool
+	var id int64
+	err := m.DB.QueryRowContext(ctx, query, provider, externalID).Scan(&id)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	// Retrieving the movie, which isn't found when it is in the trash
+	return m.Get(id)
+}
+
+// Insert the movie, or update the movie which already has one of its external ids
+// Repeated imports of the same movie update it rather than creating a duplicate
+// The external ids of a movie in the trash are still taken, so such a movie is restored and then updated,
+// and a movie outside the trash is preferred when the ids match several movies
+func upsertMovie(ctx context.Context, db dbtx, movie *Movie) error {
+	if len(movie.ExternalIDs) > 0 {
+		// Pairing up the providers and the ids to match them in one query
+		var providers, ids []string
+		for provider, id := range movie.ExternalIDs {
+			if id != "" {
+				providers = append(providers, provider)
+				ids = append(ids, id)
+			}
+		}
+
+		query := `
+			SELECT m.id, m.created_at, m.version, m.deleted_at IS NOT NULL
+			FROM external_ids e
+			INNER JOIN movies m ON m.id = e.movie_id
+			WHERE (e.provider, e.external_id) IN (SELECT * FROM unnest($1::text[], $2::text[]))
+			ORDER BY m.deleted_at IS NOT NULL, m.id ASC
+			LIMIT 1`
+
+		var trashed bool
+		err := db.QueryRowContext(ctx, query, pq.Array(providers), pq.Array(ids)).Scan(&movie.ID, &movie.CreatedAt, &movie.Version, &trashed)
+		switch {
+		case err == nil:
+			// Taking the movie out of the trash first, which bumps its version
+			if trashed {
+				restored, err := restoreMovie(ctx, db, movie.ID)
+				if err != nil {
+					return err
+				}
+				movie.Version = restored.Version
+			}
+
+			return updateMovie(ctx, db, movie)
+		case !errors.Is(err, sql.ErrNoRows):
+			return err
+		}
+	}
+
+	return insertMovie(ctx, db, movie)
+}
+
+// Save the external ids of the movie, removing the providers whose id is empty
+func saveExternalIDs(ctx context.Context, db dbtx, movie *Movie) error {
+	for provider, id := range movie.ExternalIDs {
+		var err error
+		if id == "" {
+			_, err = db.ExecContext(ctx, `DELETE FROM external_ids WHERE movie_id = $1 AND provider = $2`, movie.ID, provider)
+			delete(movie.ExternalIDs, provider)
+		} else {
+			_, err = db.ExecContext(ctx, `
+				INSERT INTO external_ids (movie_id, provider, external_id)
+				VALUES ($1, $2, $3)
+				ON CONFLICT (movie_id, provider) DO UPDATE
+				SET external_id = EXCLUDED.external_id`, movie.ID, provider, id)
+		}
+
+		if err != nil {
+			switch {
+			case isUniqueViolation(err, "external_ids_provider_external_id_key"):
+				return ErrDuplicateExternalID
+			default:
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// Attach the external ids of each of the given movies, keyed by provider
+func attachExternalIDs(ctx context.Context, db dbtx, movies ...*Movie) error {
+	if len(movies) == 0 {
+		return nil
+	}
+
+	// Indexing the movies by id
+	ids := make([]int64, len(movies))
+	byID := make(map[int64]*Movie, len(movies))
+	for i, movie := range movies {
+		ids[i] = movie.ID
+		byID[movie.ID] = movie
+		movie.ExternalIDs = map[string]string{}
+	}
+
+	// Defining the SQL query for retrieving the external ids of all the movies at once
+	query := `
+		SELECT movie_id, provider, external_id
+		FROM external_ids
+		WHERE movie_id = ANY($1)`
+
+	rows, err := db.QueryContext(ctx, query, pq.Array(ids))
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	// Looping through the rows and adding each id to its movie
+	for rows.Next() {
+		var movieID int64
+		var provider, id string
+
+		err := rows.Scan(&movieID, &provider, &id)
+		if err != nil {
+			return err
+		}
+
+		byID[movieID].ExternalIDs[provider] = id
+	}
+
+	return rows.Err()
+}
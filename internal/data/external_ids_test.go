@@ -0,0 +1,92 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"os"
+	"testing"
+	"time"
+
+	_ "github.com/lib/pq"
+)
+
+// Open the database named by MOVIEGO_TEST_DB_DSN, which must have every migration applied
+// The tests which need a database are skipped when it isn't set, and roll back everything they write
+func newTestDB(t *testing.T) *sql.DB {
+	t.Helper()
+
+	dsn := os.Getenv("MOVIEGO_TEST_DB_DSN")
+	if dsn == "" {
+		t.Skip("MOVIEGO_TEST_DB_DSN is not set")
+	}
+
+	db, err := sql.Open("postgres", dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	return db
+}
+
+func TestUpsertMovie(t *testing.T) {
+	tests := []struct {
+		name    string
+		trashed bool // Whether the existing movie is in the trash when it is imported again
+	}{
+		{name: "Existing movie"},
+		{name: "Movie in the trash", trashed: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := newTestDB(t)
+
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+
+			tx, err := db.BeginTx(ctx, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer tx.Rollback()
+
+			// Inserting the movie the import matches, trashing it if needed
+			title, year, runtime := "Stalker", int32(1979), int32(162)
+			existing := &Movie{Title: &title, Year: &year, Runtime: &runtime, Genres: []string{"drama"}, ExternalIDs: map[string]string{ProviderIMDb: "tt0079944"}}
+			err = insertMovie(ctx, tx, existing)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tt.trashed {
+				err = deleteMovie(ctx, tx, existing.ID)
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			// Importing the movie again under a new title
+			newTitle := "Сталкер"
+			imported := &Movie{Title: &newTitle, Year: &year, Runtime: &runtime, Genres: []string{"drama", "sci-fi"}, ExternalIDs: map[string]string{ProviderIMDb: "tt0079944"}}
+			err = upsertMovie(ctx, tx, imported)
+			if err != nil {
+				t.Fatalf("got error %v; want none", err)
+			}
+			if imported.ID != existing.ID {
+				t.Fatalf("got movie %d; want the existing movie %d", imported.ID, existing.ID)
+			}
+
+			// The existing movie holds the imported fields, outside the trash
+			got, err := getMovie(ctx, tx, existing.ID)
+			if err != nil {
+				t.Fatalf("got error %v retrieving the movie; want none", err)
+			}
+			if *got.Title != newTitle {
+				t.Errorf("got title %q; want %q", *got.Title, newTitle)
+			}
+			if got.Version != imported.Version {
+				t.Errorf("got version %d; want %d", got.Version, imported.Version)
+			}
+		})
+	}
+}
@@ -1,6 +1,9 @@
 package data
 
 import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
 	"math"
 	"strings"
 
@@ -12,6 +15,43 @@ type Filters struct {
 	PageSize     int
 	Sort         string
 	SortSafelist []string
+	Cursor       string
+}
+
+// Cursor struct which holds the position of the last seen row for keyset pagination
+// It is handed to clients as an opaque base64 encoded string
+type cursor struct {
+	Sort     string `json:"s"`           // Sort parameter the cursor was issued for
+	Value    string `json:"v"`           // Value of the sort column for the row
+	ID       int64  `json:"id"`          // ID of the row, used as the tie breaker
+	Backward bool   `json:"b,omitempty"` // Whether the cursor points to the previous page
+}
+
+// Encode the cursor into an opaque string
+func (c cursor) encode() string {
+	js, err := json.Marshal(c)
+	if err != nil {
+		// The cursor only holds plain values, so this can never fail
+		panic(err)
+	}
+
+	return base64.RawURLEncoding.EncodeToString(js)
+}
+
+// Decode an opaque cursor string back into the cursor struct
+func decodeCursor(s string) (*cursor, error) {
+	js, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, errors.New("invalid cursor")
+	}
+
+	var c cursor
+	err = json.Unmarshal(js, &c)
+	if err != nil || c.ID < 1 {
+		return nil, errors.New("invalid cursor")
+	}
+
+	return &c, nil
 }
 
 // Check if the sort parameter is in the safelist and then return the sort parameter
@@ -45,24 +85,48 @@ func (f Filters) offset() int {
 	return (f.Page - 1) * f.PageSize
 }
 
+// Return the decoded cursor, or nil if the filters use page based pagination
+func (f Filters) keyset() (*cursor, error) {
+	if f.Cursor == "" {
+		return nil, nil
+	}
+
+	return decodeCursor(f.Cursor)
+}
+
 // Validate method to validate the filters struct
 func ValidateFilters(v *validator.Validator, f Filters) {
 	// Check that the page and page size parameters contain sensible values
-	v.Check(f.Page > 0, "page", "must be greater than zero")
-	v.Check(f.Page <= 10_000_000, "page", "must be a maximum of 10 million")
+	// The page parameter is ignored when a cursor is provided
+	if f.Cursor == "" {
+		v.Check(f.Page > 0, "page", "must be greater than zero")
+		v.Check(f.Page <= 10_000_000, "page", "must be a maximum of 10 million")
+	}
 	v.Check(f.PageSize > 0, "page_size", "must be greater than zero")
 	v.Check(f.PageSize <= 100, "page_size", "must be a maximum of 100")
 
 	v.Check(validator.In(f.Sort, f.SortSafelist...), "sort", "invalid sort value")
+
+	// Check that the cursor is well formed and was issued for the same sort order
+	if f.Cursor != "" {
+		c, err := decodeCursor(f.Cursor)
+		if err != nil {
+			v.AddError("cursor", "must be a valid cursor")
+			return
+		}
+		v.Check(c.Sort == f.Sort, "cursor", "does not match the sort parameter")
+	}
 }
 
 // Define a new Metadata struct for holding the pagination metadata.
 type Metadata struct {
-	CurrentPage  int `json:"current_page,omitempty"`
-	PageSize     int `json:"page_size,omitempty"`
-	FirstPage    int `json:"first_page,omitempty"`
-	LastPage     int `json:"last_page,omitempty"`
-	TotalRecords int `json:"total_records,omitempty"`
+	CurrentPage  int    `json:"current_page,omitempty"`
+	PageSize     int    `json:"page_size,omitempty"`
+	FirstPage    int    `json:"first_page,omitempty"`
+	LastPage     int    `json:"last_page,omitempty"`
+	TotalRecords int    `json:"total_records,omitempty"`
+	NextCursor   string `json:"next_cursor,omitempty"`
+	PrevCursor   string `json:"prev_cursor,omitempty"`
 }
 
 // Calculating the metadata for the response
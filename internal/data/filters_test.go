@@ -0,0 +1,53 @@
+package data
+
+import (
+	"encoding/base64"
+	"testing"
+)
+
+func TestCursorRoundTrip(t *testing.T) {
+	tests := []struct {
+		name   string
+		cursor cursor
+	}{
+		{name: "Forward", cursor: cursor{Sort: "title", Value: "Casablanca", ID: 1}},
+		{name: "Backward", cursor: cursor{Sort: "-year", Value: "1942", ID: 27, Backward: true}},
+		{name: "Empty value", cursor: cursor{Sort: "id", Value: "", ID: 3}},
+		{name: "Unicode value", cursor: cursor{Sort: "title", Value: "Amélie \"Le fabuleux\"", ID: 9}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := decodeCursor(tt.cursor.encode())
+			if err != nil {
+				t.Fatalf("got error %v; want none", err)
+			}
+			if *got != tt.cursor {
+				t.Errorf("got %+v; want %+v", *got, tt.cursor)
+			}
+		})
+	}
+}
+
+func TestDecodeCursorInvalid(t *testing.T) {
+	tests := []struct {
+		name  string
+		value string
+	}{
+		{name: "Empty", value: ""},
+		{name: "Not base64", value: "not a cursor!"},
+		{name: "Not JSON", value: base64.RawURLEncoding.EncodeToString([]byte("title:1"))},
+		{name: "Missing id", value: base64.RawURLEncoding.EncodeToString([]byte(`{"s":"title","v":"Up"}`))},
+		{name: "Negative id", value: base64.RawURLEncoding.EncodeToString([]byte(`{"s":"title","v":"Up","id":-1}`))},
+		{name: "Padded", value: base64.URLEncoding.EncodeToString([]byte(`{"s":"title","v":"Up","id":1}`))},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := decodeCursor(tt.value)
+			if err == nil {
+				t.Errorf("got %+v; want an error", *got)
+			}
+		})
+	}
+}
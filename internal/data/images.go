@@ -0,0 +1,200 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// Define the different kinds of image a movie can have
+const (
+	ImagePoster   = "poster"
+	ImageBackdrop = "backdrop"
+)
+
+// MovieImage struct which holds an uploaded image of a movie and the URLs of its sizes
+type MovieImage struct {
+	ID          int64             `json:"id"`
+	CreatedAt   time.Time         `json:"created_at"`
+	MovieID     int64             `json:"-"`
+	Kind        string            `json:"kind"`
+	ContentType string            `json:"content_type"`
+	Width       int               `json:"width"`
+	Height      int               `json:"height"`
+	URLs        map[string]string `json:"urls"` // URL of each size, keyed by "original" or the width such as "w185"
+	Keys        []string          `json:"-"`    // Storage keys of every size, used to delete the files
+}
+
+// Defining the ImageModel struct to hold the database connection pool
+type ImageModel struct {
+	DB *sql.DB
+}
+
+// Insert a new image record into the movie_images table
+// The movie is published as updated in the same transaction
+func (m ImageModel) Insert(image *MovieImage) error {
+	// Encoding the URLs to be stored as JSON
+	urls, err := json.Marshal(image.URLs)
+	if err != nil {
+		return err
+	}
+
+	// Defining the SQL query for inserting a new record
+	query := `
+		INSERT INTO movie_images (movie_id, kind, content_type, width, height, urls, keys)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		RETURNING id, created_at`
+
+	// Creating an args slice to store the values for the placeholder parameters
+	args := []any{image.MovieID, image.Kind, image.ContentType, image.Width, image.Height, urls, pq.Array(image.Keys)}
+
+	// Creating a new context with a 3 second timeout
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	// Starting a transaction, so that the movie is published along with the change
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// Executing the query within the transaction
+	err = tx.QueryRowContext(ctx, query, args...).Scan(&image.ID, &image.CreatedAt)
+	if err != nil {
+		return err
+	}
+
+	// Publishing the movie, whose images are part of it
+	err = touchMovie(ctx, tx, image.MovieID)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// Delete a specific image of a movie, returning the deleted record so that its files can be removed
+// The movie is published as updated in the same transaction
+func (m ImageModel) Delete(movieID, id int64) (*MovieImage, error) {
+	// Validating the id parameters
+	if movieID < 1 || id < 1 {
+		return nil, ErrRecordNotFound
+	}
+
+	// Defining the SQL query for deleting the image record
+	query := `
+		DELETE FROM movie_images
+		WHERE id = $1 AND movie_id = $2
+		RETURNING id, created_at, movie_id, kind, content_type, width, height, urls, keys`
+
+	// Creating a new context with a 3 second timeout
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	// Starting a transaction, so that the movie is published along with the change
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	// Executing the query within the transaction
+	image, err := scanImage(tx.QueryRowContext(ctx, query, id, movieID))
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	// Publishing the movie, whose images are part of it
+	err = touchMovie(ctx, tx, movieID)
+	if err != nil {
+		return nil, err
+	}
+
+	// Committing the transaction
+	err = tx.Commit()
+	if err != nil {
+		return nil, err
+	}
+
+	return image, nil
+}
+
+// Attach the images of each of the given movies, keeping the upload order
+func attachImages(ctx context.Context, db dbtx, movies ...*Movie) error {
+	if len(movies) == 0 {
+		return nil
+	}
+
+	// Indexing the movies by id
+	ids := make([]int64, len(movies))
+	byID := make(map[int64]*Movie, len(movies))
+	for i, movie := range movies {
+		ids[i] = movie.ID
+		byID[movie.ID] = movie
+		movie.Images = []*MovieImage{}
+	}
+
+	// Defining the SQL query for retrieving the images of all the movies at once
+	query := `
+		SELECT id, created_at, movie_id, kind, content_type, width, height, urls, keys
+		FROM movie_images
+		WHERE movie_id = ANY($1)
+		ORDER BY id ASC`
+
+	rows, err := db.QueryContext(ctx, query, pq.Array(ids))
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	// Looping through the rows and adding each image to its movie
+	for rows.Next() {
+		image, err := scanImage(rows)
+		if err != nil {
+			return err
+		}
+
+		movie := byID[image.MovieID]
+		movie.Images = append(movie.Images, image)
+	}
+
+	return rows.Err()
+}
+
+// Scan an image record from a row holding its columns in the order used by the queries above
+func scanImage(row interface{ Scan(dest ...any) error }) (*MovieImage, error) {
+	var image MovieImage
+	var urls []byte
+
+	err := row.Scan(
+		&image.ID,
+		&image.CreatedAt,
+		&image.MovieID,
+		&image.Kind,
+		&image.ContentType,
+		&image.Width,
+		&image.Height,
+		&urls,
+		pq.Array(&image.Keys),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	err = json.Unmarshal(urls, &image.URLs)
+	if err != nil {
+		return nil, err
+	}
+
+	return &image, nil
+}
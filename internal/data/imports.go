@@ -0,0 +1,190 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"time"
+)
+
+// Define the different statuses of a background import
+const (
+	ImportPending   = "pending"
+	ImportRunning   = "running"
+	ImportCompleted = "completed"
+	ImportFailed    = "failed"
+)
+
+// ImportRowError struct which holds the validation errors for a single imported row
+type ImportRowError struct {
+	Row    int               `json:"row"`
+	Errors map[string]string `json:"errors"`
+}
+
+// ImportReport struct which holds the outcome of an import
+type ImportReport struct {
+	TotalRows int              `json:"total_rows"`
+	Imported  int              `json:"imported"`
+	Updated   int              `json:"updated"` // Imported rows which updated an existing movie with the same external id
+	Failed    int              `json:"failed"`
+	DryRun    bool             `json:"dry_run"`
+	Atomic    bool             `json:"atomic"`
+	Errors    []ImportRowError `json:"errors"`
+}
+
+// Import struct which holds the details of an import processed in the background
+type Import struct {
+	ID         int64         `json:"id"`
+	CreatedAt  time.Time     `json:"created_at"`
+	UserID     int64         `json:"-"`
+	Status     string        `json:"status"`
+	Format     string        `json:"format"`
+	DryRun     bool          `json:"dry_run"`
+	Atomic     bool          `json:"atomic"`
+	Report     *ImportReport `json:"report,omitempty"`
+	FinishedAt *time.Time    `json:"finished_at,omitempty"`
+}
+
+// Defining the ImportModel struct to hold the database connection pool
+type ImportModel struct {
+	DB *sql.DB
+}
+
+// Insert a new import record into the movie_imports table
+func (m ImportModel) Insert(imp *Import) error {
+	// Defining the SQL query for inserting a new record
+	query := `
+		INSERT INTO movie_imports (user_id, status, format, dry_run, atomic)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING id, created_at`
+
+	// Creating an args slice to store the values for the placeholder parameters
+	args := []any{imp.UserID, imp.Status, imp.Format, imp.DryRun, imp.Atomic}
+
+	// Creating a new context with a 3 second timeout
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	// Executing the query using the DB connection pool
+	return m.DB.QueryRowContext(ctx, query, args...).Scan(&imp.ID, &imp.CreatedAt)
+}
+
+// Get a specific import based on its id
+func (m ImportModel) Get(id int64) (*Import, error) {
+	// Validating the id parameter
+	if id < 1 {
+		return nil, ErrRecordNotFound
+	}
+
+	// Defining the SQL query for retrieving the import record
+	query := `
+		SELECT id, created_at, user_id, status, format, dry_run, atomic, report, finished_at
+		FROM movie_imports
+		WHERE id = $1`
+
+	// Creating a new context with a 3 second timeout
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	// Executing the query using the DB connection pool
+	var imp Import
+	var report []byte
+	err := m.DB.QueryRowContext(ctx, query, id).Scan(
+		&imp.ID,
+		&imp.CreatedAt,
+		&imp.UserID,
+		&imp.Status,
+		&imp.Format,
+		&imp.DryRun,
+		&imp.Atomic,
+		&report,
+		&imp.FinishedAt,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	// Decoding the report, which is only present once the import has finished
+	if report != nil {
+		err = json.Unmarshal(report, &imp.Report)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return &imp, nil
+}
+
+// Update the status and report of an import
+func (m ImportModel) Update(imp *Import) error {
+	// Encoding the report to be stored as JSON
+	var report []byte
+	if imp.Report != nil {
+		var err error
+		report, err = json.Marshal(imp.Report)
+		if err != nil {
+			return err
+		}
+	}
+
+	// Defining the SQL query for updating the import record
+	query := `
+		UPDATE movie_imports
+		SET status = $1, report = $2, finished_at = $3
+		WHERE id = $4`
+
+	// Creating a new context with a 3 second timeout
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	// Executing the query using the DB connection pool
+	result, err := m.DB.ExecContext(ctx, query, imp.Status, report, imp.FinishedAt, imp.ID)
+	if err != nil {
+		return err
+	}
+
+	// Checking if the import record was found
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+
+	return nil
+}
+
+// Mark the imports which have been pending or running for longer than the given time as failed, returning how many
+// An import runs in the background of the instance which received it, so it is never finished when that instance stops
+func (m ImportModel) FailStale(after time.Duration) (int64, error) {
+	// Defining the SQL query for failing the import records, with a report like the one of an unreadable file
+	query := `
+		UPDATE movie_imports
+		SET status = $1, finished_at = now(), report = jsonb_build_object(
+			'total_rows', 0, 'imported', 0, 'updated', 0, 'failed', 0, 'dry_run', dry_run, 'atomic', atomic,
+			'errors', jsonb_build_array(jsonb_build_object('row', 0, 'errors', jsonb_build_object('file', $2::text)))
+		)
+		WHERE status IN ($3, $4) AND created_at < $5`
+
+	// Creating an args slice to store the values for the placeholder parameters
+	args := []any{ImportFailed, "the server stopped before the import finished", ImportPending, ImportRunning, time.Now().Add(-after)}
+
+	// Creating a new context with a 3 second timeout
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	// Executing the query using the DB connection pool
+	result, err := m.DB.ExecContext(ctx, query, args...)
+	if err != nil {
+		return 0, err
+	}
+
+	return result.RowsAffected()
+}
@@ -0,0 +1,299 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"time"
+)
+
+// Define the kinds of job run by the workers
+const (
+	JobWelcomeEmail = "user.welcome_email"
+)
+
+// Define the statuses a job goes through
+// A job stays pending while it is queued, running or waiting for a retry, and is dead once it runs out of attempts
+const (
+	JobPending   = "pending"
+	JobSucceeded = "succeeded"
+	JobDead      = "dead"
+)
+
+// Define a custom ErrDuplicateJob error
+var ErrDuplicateJob = errors.New("duplicate job")
+
+// Job struct which holds a unit of work queued for the background workers
+// A job with a unique key isn't queued again while another one with the same key is pending
+type Job struct {
+	ID          int64           `json:"id"`
+	CreatedAt   time.Time       `json:"created_at"`
+	Kind        string          `json:"kind"`
+	Payload     json.RawMessage `json:"payload"`
+	UniqueKey   string          `json:"unique_key,omitempty"`
+	Status      string          `json:"status"`
+	Attempts    int             `json:"attempts"`
+	MaxAttempts int             `json:"max_attempts"`
+	RunAt       time.Time       `json:"run_at"`
+	LastError   string          `json:"last_error,omitempty"`
+	FinishedAt  *time.Time      `json:"finished_at,omitempty"`
+}
+
+// Defining the JobModel struct to hold the database connection pool
+type JobModel struct {
+	DB *sql.DB
+}
+
+// Insert a new job into the jobs table, to be run once its run_at time has come, or straight away when it is zero
+// Returns false when a pending job with the same unique key is already queued, in which case nothing is inserted
+func (m JobModel) Insert(job *Job) (bool, error) {
+	// Creating a new context with a 3 second timeout
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	// Executing the query using the DB connection pool
+	return insertJob(ctx, m.DB, job)
+}
+
+// Insert a new job using the given connection pool or transaction
+// Queuing a job in the transaction of the change it follows from means that neither is kept without the other
+func insertJob(ctx context.Context, db dbtx, job *Job) (bool, error) {
+	// Defining the SQL query for inserting a new record
+	query := `
+		INSERT INTO jobs (kind, payload, unique_key, max_attempts, run_at)
+		VALUES ($1, $2, NULLIF($3, ''), $4, $5)
+		ON CONFLICT (unique_key) WHERE status = 'pending' DO NOTHING
+		RETURNING id, created_at, status, attempts`
+
+	if job.RunAt.IsZero() {
+		job.RunAt = time.Now()
+	}
+
+	// Creating an args slice to store the values for the placeholder parameters
+	args := []any{job.Kind, []byte(job.Payload), job.UniqueKey, job.MaxAttempts, job.RunAt}
+
+	// Executing the query
+	err := db.QueryRowContext(ctx, query, args...).Scan(&job.ID, &job.CreatedAt, &job.Status, &job.Attempts)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return false, nil
+		default:
+			return false, err
+		}
+	}
+
+	return true, nil
+}
+
+// Claim up to limit pending jobs which are due
+// The attempt is counted and the job is pushed back by the lease, so that a job claimed by a worker which
+// crashed is run again once the lease runs out, and other workers skip the claimed rows
+func (m JobModel) Claim(limit int, lease time.Duration) ([]*Job, error) {
+	// Defining the SQL query for claiming the jobs
+	query := `
+		UPDATE jobs
+		SET attempts = attempts + 1, run_at = now() + make_interval(secs => $2)
+		WHERE id IN (
+			SELECT id FROM jobs
+			WHERE status = 'pending' AND run_at <= now()
+			ORDER BY run_at ASC
+			LIMIT $1
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING id, created_at, kind, payload, coalesce(unique_key, ''), status, attempts, max_attempts, run_at, last_error`
+
+	// Creating a new context with a 3 second timeout
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	// Executing the query using the DB connection pool
+	rows, err := m.DB.QueryContext(ctx, query, limit, lease.Seconds())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	// Looping through the rows in the result set
+	jobs := []*Job{}
+	for rows.Next() {
+		var job Job
+
+		err := rows.Scan(
+			&job.ID,
+			&job.CreatedAt,
+			&job.Kind,
+			&job.Payload,
+			&job.UniqueKey,
+			&job.Status,
+			&job.Attempts,
+			&job.MaxAttempts,
+			&job.RunAt,
+			&job.LastError,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		jobs = append(jobs, &job)
+	}
+
+	// Handling the errors encountered during the rows.Next() loop
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return jobs, nil
+}
+
+// Record the outcome of an attempt, as set on the job by the caller
+func (m JobModel) RecordAttempt(job *Job) error {
+	// Defining the SQL query for updating the job record
+	query := `
+		UPDATE jobs
+		SET status = $1, run_at = $2, last_error = $3, finished_at = $4
+		WHERE id = $5`
+
+	// Creating an args slice to store the values for the placeholder parameters
+	args := []any{
+		job.Status,
+		job.RunAt,
+		job.LastError,
+		job.FinishedAt,
+		job.ID,
+	}
+
+	// Creating a new context with a 3 second timeout
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	// Executing the query using the DB connection pool
+	_, err := m.DB.ExecContext(ctx, query, args...)
+	return err
+}
+
+// List the jobs, most recent first, only the ones with the given status and kind when they aren't empty
+func (m JobModel) GetAll(status, kind string, filters Filters) ([]*Job, Metadata, error) {
+	// Defining the SQL query for retrieving the job records
+	query := `
+		SELECT count(*) OVER(), id, created_at, kind, payload, coalesce(unique_key, ''), status, attempts,
+			max_attempts, run_at, last_error, finished_at
+		FROM jobs
+		WHERE (status = $1 OR $1 = '')
+		AND (kind = $2 OR $2 = '')
+		ORDER BY id DESC
+		LIMIT $3 OFFSET $4`
+
+	// Creating a new context with a 3 second timeout
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	// Executing the query using the DB connection pool
+	rows, err := m.DB.QueryContext(ctx, query, status, kind, filters.limit(), filters.offset())
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+	defer rows.Close()
+
+	// Looping through the rows in the result set
+	totalRecords := 0
+	jobs := []*Job{}
+	for rows.Next() {
+		var job Job
+
+		err := rows.Scan(
+			&totalRecords,
+			&job.ID,
+			&job.CreatedAt,
+			&job.Kind,
+			&job.Payload,
+			&job.UniqueKey,
+			&job.Status,
+			&job.Attempts,
+			&job.MaxAttempts,
+			&job.RunAt,
+			&job.LastError,
+			&job.FinishedAt,
+		)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+
+		jobs = append(jobs, &job)
+	}
+
+	// Handling the errors encountered during the rows.Next() loop
+	if err = rows.Err(); err != nil {
+		return nil, Metadata{}, err
+	}
+
+	return jobs, calculateMetadata(totalRecords, filters.Page, filters.PageSize), nil
+}
+
+// Queue a dead job again, with a fresh set of attempts
+func (m JobModel) Retry(id int64) (*Job, error) {
+	// Validating the id parameter
+	if id < 1 {
+		return nil, ErrRecordNotFound
+	}
+
+	// Defining the SQL query for reviving the job
+	query := `
+		UPDATE jobs
+		SET status = 'pending', attempts = 0, run_at = now(), last_error = '', finished_at = NULL
+		WHERE id = $1 AND status = 'dead'
+		RETURNING id, created_at, kind, payload, coalesce(unique_key, ''), status, attempts, max_attempts, run_at, last_error`
+
+	// Creating a new context with a 3 second timeout
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	// Executing the query using the DB connection pool
+	var job Job
+	err := m.DB.QueryRowContext(ctx, query, id).Scan(
+		&job.ID,
+		&job.CreatedAt,
+		&job.Kind,
+		&job.Payload,
+		&job.UniqueKey,
+		&job.Status,
+		&job.Attempts,
+		&job.MaxAttempts,
+		&job.RunAt,
+		&job.LastError,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		case err.Error() == `pq: duplicate key value violates unique constraint "jobs_unique_key_idx"`:
+			return nil, ErrDuplicateJob
+		default:
+			return nil, err
+		}
+	}
+
+	return &job, nil
+}
+
+// Delete the jobs which succeeded before the retention period, returning how many were deleted
+// Dead jobs are kept until they are dealt with
+func (m JobModel) Prune(retention time.Duration) (int64, error) {
+	// Defining the SQL query for deleting the old job records
+	query := `
+		DELETE FROM jobs
+		WHERE status = 'succeeded' AND finished_at < $1`
+
+	// Creating a new context with a 3 second timeout
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	// Executing the query using the DB connection pool
+	result, err := m.DB.ExecContext(ctx, query, time.Now().Add(-retention))
+	if err != nil {
+		return 0, err
+	}
+
+	return result.RowsAffected()
+}
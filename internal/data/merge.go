@@ -0,0 +1,308 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// Defining a custom error for merging a movie into itself
+var ErrSelfMerge = errors.New("self merge")
+
+// Statements moving the rows which belong to the merged movie ($2) over to the surviving movie ($1)
+// Tables referencing movies should add a statement here, so that their rows survive a merge
+var movieMergeStatements = []string{
+	`UPDATE movie_aliases SET movie_id = $1 WHERE movie_id = $2`,
+	`UPDATE movie_images SET movie_id = $1 WHERE movie_id = $2`,
+	`UPDATE activity_events SET movie_id = $1 WHERE movie_id = $2 AND NOT (kind = 'movie_rated' AND user_id IN (SELECT user_id FROM activity_events WHERE movie_id = $1 AND kind = 'movie_rated'))`,
+	`UPDATE comments SET movie_id = $1 WHERE movie_id = $2`,
+	`UPDATE external_ids SET movie_id = $1 WHERE movie_id = $2 AND provider NOT IN (SELECT provider FROM external_ids WHERE movie_id = $1)`,
+	`UPDATE movie_ratings SET movie_id = $1 WHERE movie_id = $2 AND user_id NOT IN (SELECT user_id FROM movie_ratings WHERE movie_id = $1)`,
+	`UPDATE movie_releases SET movie_id = $1 WHERE movie_id = $2 AND (country, type) NOT IN (SELECT country, type FROM movie_releases WHERE movie_id = $1)`,
+	`UPDATE watch_events SET movie_id = $1 WHERE movie_id = $2`,
+	`UPDATE movie_submissions SET movie_id = $1 WHERE movie_id = $2`,
+	`UPDATE movie_translations SET movie_id = $1 WHERE movie_id = $2 AND language NOT IN (SELECT language FROM movie_translations WHERE movie_id = $1)`,
+}
+
+// SQL expression normalizing a title for duplicate detection, ignoring case and punctuation
+// Punctuation and spaces are removed rather than everything but ASCII letters and digits, so that titles in other
+// scripts keep their letters whatever the collation of the database
+// It must stay the same as the expression of movie_normalized_title_trgm_idx, which the search relies on
+const normalizedTitle = `trim(regexp_replace(lower(%s), '[[:punct:][:space:]]+', ' ', 'g'))`
+
+// DuplicateCandidate struct which holds a pair of movies which are likely to be the same movie
+type DuplicateCandidate struct {
+	Movie     *Movie  `json:"movie"`
+	Duplicate *Movie  `json:"duplicate"`
+	Score     float64 `json:"score"`
+}
+
+// Find pairs of movies which are likely to be duplicates, most likely first
+// Candidates share the same year, have a similar normalized title and a runtime within 10 minutes
+func (m MovieModel) FindDuplicates(filters Filters) ([]*DuplicateCandidate, Metadata, error) {
+	// Defining the SQL query for retrieving the candidate pairs
+	// The score weighs the title similarity against the difference in runtime
+	query := `
+		SELECT count(*) OVER(), score,
+			a.id, a.created_at, a.title, a.year, a.runtime, a.genres, a.version,
+			b.id, b.created_at, b.title, b.year, b.runtime, b.genres, b.version
+		FROM (
+			SELECT a.id AS a_id, b.id AS b_id,
+				0.8 * similarity(` + normalize("a.title") + `, ` + normalize("b.title") + `)
+				+ 0.2 * (1 - abs(a.runtime - b.runtime) / 10.0) AS score
+			FROM movies a
+			INNER JOIN movies b ON ` + normalize("b.title") + ` % ` + normalize("a.title") + `
+			WHERE a.deleted_at IS NULL AND b.deleted_at IS NULL
+			AND a.year = b.year AND a.id < b.id
+			AND abs(a.runtime - b.runtime) <= 10
+		) AS pairs
+		INNER JOIN movies a ON a.id = pairs.a_id
+		INNER JOIN movies b ON b.id = pairs.b_id
+		ORDER BY score DESC, a.id ASC, b.id ASC
+		LIMIT $1 OFFSET $2`
+
+	// Creating a new context with a 3 second timeout
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	// Starting a read only transaction, to hold the similarity threshold of the % operator
+	tx, err := m.DB.BeginTx(ctx, &sql.TxOptions{ReadOnly: true})
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+	defer tx.Rollback()
+
+	// Matching the titles through the % operator, which looks every movie up in the trigram index of the
+	// normalized titles rather than comparing it with every other movie, with a threshold of 0.6
+	_, err = tx.ExecContext(ctx, `SET LOCAL pg_trgm.similarity_threshold = 0.6`)
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+
+	// Executing the query within the transaction
+	rows, err := tx.QueryContext(ctx, query, filters.limit(), filters.offset())
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+	defer rows.Close()
+
+	// Looping through the rows in the result set
+	totalRecords := 0
+	candidates := []*DuplicateCandidate{}
+	for rows.Next() {
+		candidate := DuplicateCandidate{Movie: &Movie{}, Duplicate: &Movie{}}
+
+		err := rows.Scan(
+			&totalRecords,
+			&candidate.Score,
+			&candidate.Movie.ID,
+			&candidate.Movie.CreatedAt,
+			&candidate.Movie.Title,
+			&candidate.Movie.Year,
+			&candidate.Movie.Runtime,
+			pq.Array(&candidate.Movie.Genres),
+			&candidate.Movie.Version,
+			&candidate.Duplicate.ID,
+			&candidate.Duplicate.CreatedAt,
+			&candidate.Duplicate.Title,
+			&candidate.Duplicate.Year,
+			&candidate.Duplicate.Runtime,
+			pq.Array(&candidate.Duplicate.Genres),
+			&candidate.Duplicate.Version,
+		)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+
+		candidates = append(candidates, &candidate)
+	}
+
+	// Handling the errors encountered during the rows.Next() loop
+	if err = rows.Err(); err != nil {
+		return nil, Metadata{}, err
+	}
+
+	// Committing the transaction
+	err = tx.Commit()
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+
+	return candidates, calculateMetadata(totalRecords, filters.Page, filters.PageSize), nil
+}
+
+// Merge the source movie into the target movie
+// The genres of both movies are combined, the rows belonging to the source are moved to the target,
+// the source is deleted and its id is kept as an alias of the target, and a revision is written
+func (m MovieModel) Merge(targetID, sourceID, userID int64) (*Movie, error) {
+	// Validating the id parameters
+	if targetID < 1 || sourceID < 1 {
+		return nil, ErrRecordNotFound
+	}
+	if targetID == sourceID {
+		return nil, ErrSelfMerge
+	}
+
+	// Creating a new context with a 3 second timeout
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	// Starting the transaction, which is rolled back unless it is committed below
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	// Retrieving both movies
+	target, err := getMovie(ctx, tx, targetID)
+	if err != nil {
+		return nil, err
+	}
+	source, err := getMovie(ctx, tx, sourceID)
+	if err != nil {
+		return nil, err
+	}
+
+	// Adding the genres of the source which the target is missing, up to the maximum of 5
+	for _, genre := range source.Genres {
+		if len(target.Genres) >= 5 {
+			break
+		}
+		if !contains(target.Genres, genre) {
+			target.Genres = append(target.Genres, genre)
+		}
+	}
+
+	// Updating the target, which fails with an edit conflict if it changed concurrently
+	err = updateMovie(ctx, tx, target)
+	if err != nil {
+		return nil, err
+	}
+
+	// Moving the rows which belong to the source over to the target
+	for _, statement := range movieMergeStatements {
+		_, err = tx.ExecContext(ctx, statement, targetID, sourceID)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// Deleting the source, as long as it didn't change concurrently
+	result, err := tx.ExecContext(ctx, `DELETE FROM movies WHERE id = $1 AND version = $2`, sourceID, source.Version)
+	if err != nil {
+		return nil, err
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return nil, err
+	}
+	if rowsAffected == 0 {
+		return nil, ErrEditConflict
+	}
+
+	// Telling the webhooks about the source, which is gone in favour of the target
+	err = publishEvent(ctx, tx, EventMovieDeleted, map[string]any{"id": sourceID, "merged_into": targetID})
+	if err != nil {
+		return nil, err
+	}
+
+	// Keeping the id of the source as an alias, so that requests for it can be redirected
+	_, err = tx.ExecContext(ctx, `INSERT INTO movie_aliases (old_id, movie_id) VALUES ($1, $2)`, sourceID, targetID)
+	if err != nil {
+		return nil, err
+	}
+
+	// Writing a revision of the target which records the merged movie
+	err = insertRevision(ctx, tx, targetID, userID, "merge", map[string]any{"merged": source})
+	if err != nil {
+		return nil, err
+	}
+
+	// Committing the transaction
+	err = tx.Commit()
+	if err != nil {
+		return nil, err
+	}
+
+	return target, nil
+}
+
+// Resolve the id of a merged movie to the id of the movie it was merged into
+func (m MovieModel) ResolveAlias(id int64) (int64, error) {
+	// Defining the SQL query for retrieving the alias
+	query := `
+		SELECT movie_id
+		FROM movie_aliases
+		WHERE old_id = $1`
+
+	// Creating a new context with a 3 second timeout
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	// Executing the query using the DB connection pool
+	var movieID int64
+	err := m.DB.QueryRowContext(ctx, query, id).Scan(&movieID)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return 0, ErrRecordNotFound
+		default:
+			return 0, err
+		}
+	}
+
+	return movieID, nil
+}
+
+// Insert a revision recording an action on a movie, along with its details
+func insertRevision(ctx context.Context, db dbtx, movieID, userID int64, action string, details any) error {
+	// Encoding the details to be stored as JSON
+	js, err := json.Marshal(details)
+	if err != nil {
+		return err
+	}
+
+	// Defining the SQL query for inserting a new revision
+	query := `
+		INSERT INTO movie_revisions (movie_id, user_id, action, details)
+		VALUES ($1, $2, $3, $4)`
+
+	_, err = db.ExecContext(ctx, query, movieID, userID, action, js)
+	return err
+}
+
+// Return the normalized title expression for the given column
+func normalize(column string) string {
+	return fmt.Sprintf(normalizedTitle, column)
+}
+
+// Check whether a slice of strings contains the given value
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// Find pairs of movies which are likely to be duplicates
+func (m MockMovieModel) FindDuplicates(filters Filters) ([]*DuplicateCandidate, Metadata, error) {
+	return nil, Metadata{}, nil
+}
+
+// Merge the source movie into the target movie
+func (m MockMovieModel) Merge(targetID, sourceID, userID int64) (*Movie, error) {
+	return nil, nil
+}
+
+// Resolve the id of a merged movie to the id of the movie it was merged into
+func (m MockMovieModel) ResolveAlias(id int64) (int64, error) {
+	return 0, ErrRecordNotFound
+}
@@ -0,0 +1,20 @@
+package data
+
+import (
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestNormalizedTitleIndex(t *testing.T) {
+	// The duplicate search only uses the index when it matches on the same expression
+	migration, err := os.ReadFile("../../migrations/000012_add_movie_merging.up.sql")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := "((" + normalize("title") + ") gin_trgm_ops)"
+	if !strings.Contains(string(migration), want) {
+		t.Errorf("got no movie_normalized_title_trgm_idx on %s", want)
+	}
+}
@@ -1,36 +1,104 @@
 package data
 
 import (
+	"context"
 	"database/sql"
 	"errors"
+	"time"
+
+	"github.com/lib/pq"
 )
 
 var (
 	ErrRecordNotFound = errors.New("record not found")
 	ErrEditConflict   = errors.New("edit conflict")
+	ErrBatchAborted   = errors.New("batch aborted")
 )
 
+// Interface satisfied by both sql.DB and sql.Tx, so that queries can run inside or outside a transaction
+type dbtx interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
+// Check whether the error is a violation of the given unique constraint
+func isUniqueViolation(err error, constraint string) bool {
+	var pqErr *pq.Error
+	return errors.As(err, &pqErr) && pqErr.Code == "23505" && pqErr.Constraint == constraint
+}
+
 // Parent Model struct for all the models
 type Models struct {
-	Movies interface {
+	Activity ActivityModel
+	Comments CommentModel
+	Follows  FollowModel
+	Movies   interface {
 		Insert(movie *Movie) error
+		InsertBatch(movies []*Movie, atomic bool) ([]error, error)
+		ApplyOperations(ops []MovieOperation, atomic bool) ([]MovieOperationResult, error)
 		Get(id int64) (*Movie, error)
+		Lookup(provider, externalID string) (*Movie, error)
 		Update(movie *Movie) error
 		Delete(id int64) error
-		GetAll(title string, genres []string, filters Filters) ([]*Movie, Metadata, error)
+		GetDeleted(filters Filters) ([]*Movie, Metadata, error)
+		Restore(id int64) (*Movie, error)
+		PurgeDeleted(retention time.Duration) (int64, []string, error)
+		FindDuplicates(filters Filters) ([]*DuplicateCandidate, Metadata, error)
+		Merge(targetID, sourceID, userID int64) (*Movie, error)
+		ResolveAlias(id int64) (int64, error)
+		GetAll(title string, genres []string, fuzzy bool, releases ReleaseFilter, filters Filters) ([]*Movie, Metadata, error)
+		Export(ctx context.Context, title string, genres []string, fuzzy bool, releases ReleaseFilter, filters Filters, fn func(*Movie) error) error
+		GetFacets(title string, genres []string, fuzzy bool, releases ReleaseFilter, facets []string) (Facets, error)
+		Autocomplete(prefix string, limit int) ([]*MovieSuggestion, error)
+		GetStats() (*MovieStats, error)
+		GetSimilar(id int64, limit int) ([]*SimilarMovie, error)
 	}
-	Permissions PermissionModel
-	Users       UserModel
-	Tokens      TokenModel
+	Images                  ImageModel
+	Imports                 ImportModel
+	Jobs                    JobModel
+	MovieEvents             MovieEventModel
+	Notifications           NotificationModel
+	NotificationPreferences NotificationPreferenceModel
+	Permissions             PermissionModel
+	Presence                PresenceModel
+	Ratings                 RatingModel
+	Recommendations         RecommendationModel
+	Releases                ReleaseModel
+	Submissions             SubmissionModel
+	Translations            TranslationModel
+	Users                   UserModel
+	WatchEvents             WatchEventModel
+	Webhooks                WebhookModel
+	WebhookDeliveries       WebhookDeliveryModel
+	Tokens                  TokenModel
 }
 
 // Factory method to create a new Models struct
 func NewModels(db *sql.DB) Models {
 	return Models{
-		Movies:      MovieModel{DB: db},
-		Permissions: PermissionModel{DB: db},
-		Users:       UserModel{DB: db},
-		Tokens:      TokenModel{DB: db},
+		Activity:                ActivityModel{DB: db},
+		Comments:                CommentModel{DB: db},
+		Follows:                 FollowModel{DB: db},
+		Movies:                  MovieModel{DB: db},
+		Images:                  ImageModel{DB: db},
+		Imports:                 ImportModel{DB: db},
+		Jobs:                    JobModel{DB: db},
+		MovieEvents:             MovieEventModel{DB: db},
+		Notifications:           NotificationModel{DB: db},
+		NotificationPreferences: NotificationPreferenceModel{DB: db},
+		Permissions:             PermissionModel{DB: db},
+		Presence:                PresenceModel{DB: db},
+		Ratings:                 RatingModel{DB: db},
+		Recommendations:         RecommendationModel{DB: db},
+		Releases:                ReleaseModel{DB: db},
+		Submissions:             SubmissionModel{DB: db},
+		Translations:            TranslationModel{DB: db},
+		Users:                   UserModel{DB: db},
+		WatchEvents:             WatchEventModel{DB: db},
+		Webhooks:                WebhookModel{DB: db},
+		WebhookDeliveries:       WebhookDeliveryModel{DB: db},
+		Tokens:                  TokenModel{DB: db},
 	}
 }
 
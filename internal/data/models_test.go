@@ -0,0 +1,52 @@
+package data
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/lib/pq"
+)
+
+func TestIsUniqueViolation(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{
+			name: "Matching constraint",
+			err:  &pq.Error{Code: "23505", Constraint: "external_ids_provider_external_id_key"},
+			want: true,
+		},
+		{
+			name: "Wrapped",
+			err:  fmt.Errorf("saving: %w", &pq.Error{Code: "23505", Constraint: "external_ids_provider_external_id_key"}),
+			want: true,
+		},
+		{
+			name: "Other constraint",
+			err:  &pq.Error{Code: "23505", Constraint: "external_ids_pkey"},
+		},
+		{
+			name: "Other code",
+			err:  &pq.Error{Code: "23503", Constraint: "external_ids_provider_external_id_key"},
+		},
+		{
+			name: "Not a database error",
+			err:  errors.New(`pq: duplicate key value violates unique constraint "external_ids_provider_external_id_key"`),
+		},
+		{
+			name: "No error",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := isUniqueViolation(tt.err, "external_ids_provider_external_id_key")
+			if got != tt.want {
+				t.Errorf("got %t; want %t", got, tt.want)
+			}
+		})
+	}
+}
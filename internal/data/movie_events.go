@@ -0,0 +1,195 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"strconv"
+	"time"
+)
+
+// Channel the ids of new movie events are sent on through Postgres NOTIFY
+const MovieEventsChannel = "movie_events"
+
+// MovieEvent struct which holds a change to a movie, as kept in the event log for the change stream
+// TxID is the id of the transaction which wrote the event, which orders the log along with the event id
+type MovieEvent struct {
+	ID        int64           `json:"id"`
+	CreatedAt time.Time       `json:"created_at"`
+	Event     string          `json:"event"`
+	Payload   json.RawMessage `json:"payload"`
+	TxID      uint64          `json:"-"`
+}
+
+// Cursor returns the position of the event in the log
+func (e *MovieEvent) Cursor() MovieEventCursor {
+	return MovieEventCursor{TxID: e.TxID, ID: e.ID}
+}
+
+// MovieEventCursor is a position in the movie event log
+// Ids are taken from a sequence before the transaction commits, so they can become visible out of order.
+// The log is read in the order of the writing transactions instead, and only up to the oldest transaction
+// still running, so that an event never shows up behind a position which was already read
+// The zero value is the start of the log
+type MovieEventCursor struct {
+	TxID uint64
+	ID   int64
+}
+
+// After reports whether the cursor comes after the other one in the log
+func (c MovieEventCursor) After(other MovieEventCursor) bool {
+	return c.TxID > other.TxID || (c.TxID == other.TxID && c.ID > other.ID)
+}
+
+// Defining the MovieEventModel struct to hold the database connection pool
+type MovieEventModel struct {
+	DB *sql.DB
+}
+
+// Insert a new event into the movie_events table using the given transaction, see publishEvent
+// The listeners of every API instance are notified once the transaction commits
+func insertMovieEvent(ctx context.Context, db dbtx, event *MovieEvent) error {
+	// Defining the SQL query for inserting a new record, notifying once the transaction commits
+	query := `
+		WITH e AS (
+			INSERT INTO movie_events (event, payload)
+			VALUES ($1, $2)
+			RETURNING id, created_at, tx_id
+		)
+		SELECT id, created_at, tx_id, pg_notify($3, id::text)
+		FROM e`
+
+	// Executing the query
+	var notified any
+	return db.QueryRowContext(ctx, query, event.Event, []byte(event.Payload), MovieEventsChannel).Scan(&event.ID, &event.CreatedAt, &event.TxID, &notified)
+}
+
+// List up to limit events which come after the cursor, in log order
+// Events written by transactions newer than the oldest one still running are held back, since an older
+// transaction may still add events in front of them. Reports whether any event was held back
+func (m MovieEventModel) GetSince(after MovieEventCursor, limit int) ([]*MovieEvent, bool, error) {
+	// Defining the SQL query for retrieving the event records, flagging the ones which can't be read yet
+	query := `
+		SELECT id, created_at, event, payload, tx_id, tx_id < pg_snapshot_xmin(pg_current_snapshot())
+		FROM movie_events
+		WHERE (tx_id, id) > ($1::xid8, $2)
+		ORDER BY tx_id ASC, id ASC
+		LIMIT $3`
+
+	// Creating a new context with a 3 second timeout
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	// Executing the query using the DB connection pool
+	rows, err := m.DB.QueryContext(ctx, query, strconv.FormatUint(after.TxID, 10), after.ID, limit)
+	if err != nil {
+		return nil, false, err
+	}
+	defer rows.Close()
+
+	// Looping through the rows in the result set, stopping at the first one which is held back
+	// The held back rows come last, since their transactions are the newest
+	events := []*MovieEvent{}
+	held := false
+	for rows.Next() {
+		var event MovieEvent
+		var readable bool
+
+		err := rows.Scan(&event.ID, &event.CreatedAt, &event.Event, &event.Payload, &event.TxID, &readable)
+		if err != nil {
+			return nil, false, err
+		}
+
+		if !readable {
+			held = true
+			break
+		}
+
+		events = append(events, &event)
+	}
+
+	// Handling the errors encountered during the rows.Next() loop
+	if err = rows.Err(); err != nil {
+		return nil, false, err
+	}
+
+	return events, held, nil
+}
+
+// Get the cursor of the latest event which can be read, or the start of the log when there is none
+func (m MovieEventModel) LatestCursor() (MovieEventCursor, error) {
+	// Defining the SQL query for retrieving the latest position
+	query := `
+		SELECT tx_id, id
+		FROM movie_events
+		WHERE tx_id < pg_snapshot_xmin(pg_current_snapshot())
+		ORDER BY tx_id DESC, id DESC
+		LIMIT 1`
+
+	// Creating a new context with a 3 second timeout
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	// Executing the query using the DB connection pool
+	var cursor MovieEventCursor
+	err := m.DB.QueryRowContext(ctx, query).Scan(&cursor.TxID, &cursor.ID)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return MovieEventCursor{}, err
+	}
+
+	return cursor, nil
+}
+
+// Get the cursor of the event with the given id, the zero id being the start of the log
+// Returns ErrRecordNotFound once the event has been pruned, when the events after it may be gone too
+func (m MovieEventModel) CursorFor(id int64) (MovieEventCursor, error) {
+	if id == 0 {
+		return MovieEventCursor{}, nil
+	}
+
+	// Defining the SQL query for retrieving the position of the event
+	query := `
+		SELECT tx_id, id
+		FROM movie_events
+		WHERE id = $1`
+
+	// Creating a new context with a 3 second timeout
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	// Executing the query using the DB connection pool
+	var cursor MovieEventCursor
+	err := m.DB.QueryRowContext(ctx, query, id).Scan(&cursor.TxID, &cursor.ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return MovieEventCursor{}, ErrRecordNotFound
+		default:
+			return MovieEventCursor{}, err
+		}
+	}
+
+	return cursor, nil
+}
+
+// Delete the events older than the retention period, returning how many were deleted
+// Clients which were disconnected for longer can't resume, and start over from the current state
+func (m MovieEventModel) Prune(retention time.Duration) (int64, error) {
+	// Defining the SQL query for deleting the old event records
+	query := `
+		DELETE FROM movie_events
+		WHERE created_at < $1`
+
+	// Creating a new context with a 3 second timeout
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	// Executing the query using the DB connection pool
+	result, err := m.DB.ExecContext(ctx, query, time.Now().Add(-retention))
+	if err != nil {
+		return 0, err
+	}
+
+	return result.RowsAffected()
+}
@@ -3,8 +3,11 @@ package data
 import (
 	"context"
 	"database/sql"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/lib/pq"
@@ -20,8 +23,23 @@ type Movie struct {
 	Runtime   *int32    // Movie runtime (in minutes)
 	Genres    []string  // Slice of genres for the movie (romance, comedy, etc.)
 	Version   int32     // Counter to track the number of updates to the movie
+
+	DeletedAt *time.Time    `json:",omitempty"` // Timestamp for when the movie was moved to the trash
+	Images    []*MovieImage `json:",omitempty"` // Uploaded posters and backdrops, set by Get and GetAll
+
+	Language     string                       `json:",omitempty"` // Language of the title and synopsis, set by Localize
+	Synopsis     *string                      `json:",omitempty"` // Synopsis in the chosen language, set by Localize
+	Translations map[string]*MovieTranslation `json:",omitempty"` // Localized titles and synopses keyed by language, set by Get and GetAll
+	Releases     []*MovieRelease              `json:",omitempty"` // Release dates and certifications by country, set by Get and GetAll
+	ExternalIDs  map[string]string            `json:",omitempty"` // Identifiers in outside datasets keyed by provider, set by Get and GetAll
+
+	relevance float32 // Rank of the movie against the title search, only set by GetAll
 }
 
+// SQL expression for ranking a movie against the title search term in $1
+// The full text rank of the title is combined with the trigram word similarity
+const movieRelevance = `(ts_rank(to_tsvector('simple', title), plainto_tsquery('simple', $1)) + word_similarity($1, title))`
+
 // Validate method which validates the movie struct
 func ValidateMovie(v *validator.Validator, movie *Movie) {
 	v.Check(*movie.Title != "", "title", "must be provided")
@@ -47,8 +65,30 @@ type MovieModel struct {
 
 // CRUD OPERATIONS for the MovieModel
 
-// Insert a new movie record into the movies table
+// Insert a new movie record into the movies table, along with its external ids
 func (m MovieModel) Insert(movie *Movie) error {
+	// Creating a new context with a 3 second timeout
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	// Starting a transaction, so that the movie isn't left behind when its external ids are refused, and that it is
+	// published along with being inserted
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	err = insertMovie(ctx, tx, movie)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// Insert a new movie record using the given transaction, and publish the movie.created event
+func insertMovie(ctx context.Context, db dbtx, movie *Movie) error {
 	// Defining the SQL query for inserting a new record
 	query := `
 		INSERT INTO movies (title, year, runtime, genres)
@@ -58,12 +98,51 @@ func (m MovieModel) Insert(movie *Movie) error {
 	// Creating an args slice to store the values for the placeholder parameters
 	args := []any{movie.Title, movie.Year, movie.Runtime, pq.Array(movie.Genres)}
 
-	// Creating a new context with a 3 second timeout
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	err := db.QueryRowContext(ctx, query, args...).Scan(&movie.ID, &movie.CreatedAt, &movie.Version)
+	if err != nil {
+		return err
+	}
+
+	// Saving the external ids of the movie
+	err = saveExternalIDs(ctx, db, movie)
+	if err != nil {
+		return err
+	}
+
+	return publishEvent(ctx, db, EventMovieCreated, map[string]any{"movie": movie})
+}
+
+// Insert a batch of movie records within a single transaction
+// A movie carrying the external id of an existing movie updates that movie instead, see upsertMovie
+// In atomic mode the whole batch is rolled back as soon as one insert fails, and ErrBatchAborted is returned
+// Otherwise every insert is guarded by a savepoint, so that a failing movie doesn't affect the others
+// The returned slice holds the error for each movie, which is nil for the movies that were inserted
+func (m MovieModel) InsertBatch(movies []*Movie, atomic bool) ([]error, error) {
+	// Creating a new context with a timeout which grows with the size of the batch
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second+time.Duration(len(movies))*10*time.Millisecond)
 	defer cancel()
 
-	// Executing the query using the DB connection pool
-	return m.DB.QueryRowContext(ctx, query, args...).Scan(&movie.ID, &movie.CreatedAt, &movie.Version)
+	// Starting the transaction, which is rolled back unless it is committed below
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	errs, err := runBatch(ctx, tx, len(movies), atomic, func(i int) error {
+		return upsertMovie(ctx, tx, movies[i])
+	})
+	if err != nil {
+		return errs, err
+	}
+
+	// Committing the transaction
+	err = tx.Commit()
+	if err != nil {
+		return nil, err
+	}
+
+	return errs, nil
 }
 
 // Get a specific movie based on its id
@@ -73,21 +152,53 @@ func (m MovieModel) Get(id int64) (*Movie, error) {
 		return nil, ErrRecordNotFound
 	}
 
+	// Creating a new context with a 3 second timeout
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	// Executing the query using the DB connection pool
+	movie, err := getMovie(ctx, m.DB, id)
+	if err != nil {
+		return nil, err
+	}
+
+	// Attaching the images, the translations, the releases and the external ids of the movie
+	err = attachImages(ctx, m.DB, movie)
+	if err != nil {
+		return nil, err
+	}
+
+	err = attachTranslations(ctx, m.DB, movie)
+	if err != nil {
+		return nil, err
+	}
+
+	err = attachReleases(ctx, m.DB, movie)
+	if err != nil {
+		return nil, err
+	}
+
+	err = attachExternalIDs(ctx, m.DB, movie)
+	if err != nil {
+		return nil, err
+	}
+
+	return movie, nil
+}
+
+// Get a specific movie based on its id using the given connection pool or transaction
+func getMovie(ctx context.Context, db dbtx, id int64) (*Movie, error) {
 	// Defining the SQL query for retrieving the movie record
 	query := `
 		SELECT id, created_at, title, year, runtime, genres, version
 		FROM movies
-		WHERE id = $1`
+		WHERE id = $1 AND deleted_at IS NULL`
 
 	// Declaring a movie struct to hold the data returned by the query
 	var movie Movie
 
-	// Creating a new context with a 3 second timeout
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
-	defer cancel()
-
-	// Executing the query using the DB connection pool
-	err := m.DB.QueryRowContext(ctx, query, id).Scan(
+	// Executing the query
+	err := db.QueryRowContext(ctx, query, id).Scan(
 		&movie.ID,
 		&movie.CreatedAt,
 		&movie.Title,
@@ -111,13 +222,69 @@ func (m MovieModel) Get(id int64) (*Movie, error) {
 	return &movie, nil
 }
 
-// Update a specific movie based on its id
+// Update a specific movie based on its id, along with its external ids
 func (m MovieModel) Update(movie *Movie) error {
+	// Creating a new context with a 3 second timeout
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	// Starting a transaction, so that the update is undone when the external ids are refused, and that it is
+	// published along with being made
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	err = updateMovie(ctx, tx, movie)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// Bump the version of a movie whose related records changed using the given transaction, and publish the
+// movie.updated event, so that consumers notice changes to the movie which don't touch its own row
+// A movie in the trash isn't found
+func touchMovie(ctx context.Context, db dbtx, id int64) error {
+	// Defining the SQL query for bumping the version of the movie record
+	query := `
+		UPDATE movies
+		SET version = version + 1
+		WHERE id = $1 AND deleted_at IS NULL
+		RETURNING id, created_at, title, year, runtime, genres, version`
+
+	// Executing the query
+	var movie Movie
+	err := db.QueryRowContext(ctx, query, id).Scan(
+		&movie.ID,
+		&movie.CreatedAt,
+		&movie.Title,
+		&movie.Year,
+		&movie.Runtime,
+		pq.Array(&movie.Genres),
+		&movie.Version,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrRecordNotFound
+		default:
+			return err
+		}
+	}
+
+	return publishEvent(ctx, db, EventMovieUpdated, map[string]any{"movie": &movie})
+}
+
+// Update a specific movie based on its id using the given transaction, and publish the movie.updated event
+func updateMovie(ctx context.Context, db dbtx, movie *Movie) error {
 	// Defining the SQL query for updating the movie record
 	query := `
 		UPDATE movies
 		SET title = $1, year = $2, runtime = $3, genres = $4, version = version + 1
-		WHERE id = $5 AND version = $6
+		WHERE id = $5 AND version = $6 AND deleted_at IS NULL
 		RETURNING version`
 
 	// Creating an args slice to store the values for the placeholder parameters
@@ -130,12 +297,8 @@ func (m MovieModel) Update(movie *Movie) error {
 		movie.Version,
 	}
 
-	// Creating a new context with a 3 second timeout
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
-	defer cancel()
-
-	// Executing the query using the DB connection pool
-	err := m.DB.QueryRowContext(ctx, query, args...).Scan(&movie.Version)
+	// Executing the query
+	err := db.QueryRowContext(ctx, query, args...).Scan(&movie.Version)
 	if err != nil {
 		switch {
 		case errors.Is(err, sql.ErrNoRows):
@@ -146,27 +309,52 @@ func (m MovieModel) Update(movie *Movie) error {
 		}
 	}
 
-	return nil
+	// Saving the external ids of the movie
+	err = saveExternalIDs(ctx, db, movie)
+	if err != nil {
+		return err
+	}
+
+	return publishEvent(ctx, db, EventMovieUpdated, map[string]any{"movie": movie})
 }
 
 // Delete a specific movie based on its id
+// The movie is moved to the trash, from where it can be restored until it is purged
 func (m MovieModel) Delete(id int64) error {
 	// Validating the id parameter
 	if id < 1 {
 		return ErrRecordNotFound
 	}
 
-	// Defining the SQL query for deleting the movie record
-	query := `
-		DELETE FROM movies
-		WHERE id = $1`
-
 	// Creating a new context with a 3 second timeout
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
-	// Executing the query using the DB connection pool
-	result, err := m.DB.ExecContext(ctx, query, id)
+	// Starting a transaction, so that the movie is published along with being deleted
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	err = deleteMovie(ctx, tx, id)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// Delete a specific movie based on its id using the given transaction, and publish the movie.deleted event
+func deleteMovie(ctx context.Context, db dbtx, id int64) error {
+	// Defining the SQL query for soft deleting the movie record
+	query := `
+		UPDATE movies
+		SET deleted_at = now(), version = version + 1
+		WHERE id = $1 AND deleted_at IS NULL`
+
+	// Executing the query
+	result, err := db.ExecContext(ctx, query, id)
 	if err != nil {
 		return err
 	}
@@ -180,28 +368,284 @@ func (m MovieModel) Delete(id int64) error {
 		return ErrRecordNotFound
 	}
 
-	// Returning nil if the movie record was found
-	return nil
+	return publishEvent(ctx, db, EventMovieDeleted, map[string]any{"id": id})
+}
+
+// List the movies in the trash, most recently deleted first
+func (m MovieModel) GetDeleted(filters Filters) ([]*Movie, Metadata, error) {
+	// Defining the SQL query for retrieving the deleted movie records
+	query := `
+		SELECT count(*) OVER(), id, created_at, title, year, runtime, genres, version, deleted_at
+		FROM movies
+		WHERE deleted_at IS NOT NULL
+		ORDER BY deleted_at DESC, id ASC
+		LIMIT $1 OFFSET $2`
+
+	// Creating a new context with a 3 second timeout
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	// Executing the query using the DB connection pool
+	rows, err := m.DB.QueryContext(ctx, query, filters.limit(), filters.offset())
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+	defer rows.Close()
+
+	// Looping through the rows in the result set
+	totalRecords := 0
+	movies := []*Movie{}
+	for rows.Next() {
+		var movie Movie
+
+		err := rows.Scan(
+			&totalRecords,
+			&movie.ID,
+			&movie.CreatedAt,
+			&movie.Title,
+			&movie.Year,
+			&movie.Runtime,
+			pq.Array(&movie.Genres),
+			&movie.Version,
+			&movie.DeletedAt,
+		)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+
+		movies = append(movies, &movie)
+	}
+
+	// Handling the errors encountered during the rows.Next() loop
+	if err = rows.Err(); err != nil {
+		return nil, Metadata{}, err
+	}
+
+	return movies, calculateMetadata(totalRecords, filters.Page, filters.PageSize), nil
+}
+
+// Restore a movie from the trash based on its id
+func (m MovieModel) Restore(id int64) (*Movie, error) {
+	// Validating the id parameter
+	if id < 1 {
+		return nil, ErrRecordNotFound
+	}
+
+	// Creating a new context with a 3 second timeout
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	// Starting a transaction, so that the movie is published along with being restored
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	movie, err := restoreMovie(ctx, tx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	// Committing the transaction
+	err = tx.Commit()
+	if err != nil {
+		return nil, err
+	}
+
+	return movie, nil
+}
+
+// Restore a specific movie from the trash, and publish it
+func restoreMovie(ctx context.Context, db dbtx, id int64) (*Movie, error) {
+	// Defining the SQL query for restoring the movie record
+	query := `
+		UPDATE movies
+		SET deleted_at = NULL, version = version + 1
+		WHERE id = $1 AND deleted_at IS NOT NULL
+		RETURNING id, created_at, title, year, runtime, genres, version`
+
+	// Executing the query
+	var movie Movie
+	err := db.QueryRowContext(ctx, query, id).Scan(
+		&movie.ID,
+		&movie.CreatedAt,
+		&movie.Title,
+		&movie.Year,
+		&movie.Runtime,
+		pq.Array(&movie.Genres),
+		&movie.Version,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	// Telling the webhooks about the movie, which is back in the catalogue under its old id
+	err = publishEvent(ctx, db, EventMovieRestored, map[string]any{"movie": &movie})
+	if err != nil {
+		return nil, err
+	}
+
+	return &movie, nil
+}
+
+// Permanently delete the movies which have been in the trash for longer than the retention period
+// Returns how many were deleted, along with the storage keys of their images, whose rows are deleted with them
+// and whose files are left for the caller to delete
+func (m MovieModel) PurgeDeleted(retention time.Duration) (int64, []string, error) {
+	// Defining the SQL query for deleting the movie records
+	// The images are read from the snapshot the statement started with, which still holds the deleted rows
+	query := `
+		WITH purged AS (
+			DELETE FROM movies
+			WHERE deleted_at < $1
+			RETURNING id
+		)
+		SELECT p.id, coalesce(i.keys, '{}')
+		FROM purged p
+		LEFT JOIN movie_images i ON i.movie_id = p.id`
+
+	// Creating a new context with a 30 second timeout, since a purge can cover many rows
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	// Executing the query using the DB connection pool
+	rows, err := m.DB.QueryContext(ctx, query, time.Now().Add(-retention))
+	if err != nil {
+		return 0, nil, err
+	}
+	defer rows.Close()
+
+	// Looping through the rows in the result set, one for each image or for each movie without images
+	purged := make(map[int64]bool)
+	keys := []string{}
+	for rows.Next() {
+		var id int64
+		var imageKeys []string
+
+		err := rows.Scan(&id, pq.Array(&imageKeys))
+		if err != nil {
+			return 0, nil, err
+		}
+
+		purged[id] = true
+		keys = append(keys, imageKeys...)
+	}
+
+	// Handling the errors encountered during the rows.Next() loop
+	if err = rows.Err(); err != nil {
+		return 0, nil, err
+	}
+
+	return int64(len(purged)), keys, nil
+}
+
+// Return the WHERE clause matching the title search term in $1 and the genres in $2, excluding deleted movies
+// The release country in $3 and the allowed certifications in $4 come from ReleaseFilter.args
+// The title is matched using full text search, and additionally by the trigram index in fuzzy mode
+// The localized titles of the movie are searched in the same way as the original title
+func movieFilterClause(fuzzy bool) string {
+	match := "to_tsvector('simple', %[1]s) @@ plainto_tsquery('simple', $1)"
+	if fuzzy {
+		match = "(to_tsvector('simple', %[1]s) @@ plainto_tsquery('simple', $1) OR $1 <%% %[1]s)"
+	}
+
+	titleClause := fmt.Sprintf("(%s OR EXISTS (SELECT 1 FROM movie_translations t WHERE t.movie_id = movies.id AND %s) OR $1 = '')",
+		fmt.Sprintf(match, "title"), fmt.Sprintf(match, "t.title"))
+
+	releaseClause := `($3 = '' OR EXISTS (
+			SELECT 1 FROM movie_releases r
+			WHERE r.movie_id = movies.id AND r.country = $3 AND (r.certification = ANY($4) OR $4 = '{}')
+		))`
+
+	return titleClause + " AND (genres @> $2 OR $2 = '{}') AND " + releaseClause + " AND deleted_at IS NULL"
+}
+
+// Return the value of the given sort column for the movie, as used in pagination cursors
+func (movie *Movie) sortValue(column string) string {
+	switch column {
+	case "title":
+		return *movie.Title
+	case "year":
+		return strconv.Itoa(int(*movie.Year))
+	case "runtime":
+		return strconv.Itoa(int(*movie.Runtime))
+	case "relevance":
+		return strconv.FormatFloat(float64(movie.relevance), 'g', -1, 32)
+	default:
+		return strconv.FormatInt(movie.ID, 10)
+	}
 }
 
 // List all movies in the database
-func (m MovieModel) GetAll(title string, genres []string, filters Filters) ([]*Movie, Metadata, error) {
+// The listing is paginated by page number, or by keyset when the filters carry a cursor
+// In fuzzy mode, titles within trigram distance of the search term match as well, which tolerates typos
+func (m MovieModel) GetAll(title string, genres []string, fuzzy bool, releases ReleaseFilter, filters Filters) ([]*Movie, Metadata, error) {
+	// Decoding the cursor, which is nil for page based pagination
+	c, err := filters.keyset()
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+
+	// Defining the pieces of the query which differ between the two pagination modes
+	sortColumn := filters.sortColumn()
+	sortDirection := filters.sortDirection()
+	idDirection := "ASC"
+	countColumn := "count(*) OVER()"
+	keysetClause := ""
+
+	// Relevance is ranked by an expression rather than a column, and the most relevant movies come first
+	if sortColumn == "relevance" {
+		sortColumn = movieRelevance
+		sortDirection = flipDirection(sortDirection)
+	}
+
+	// Creating an args slice to store the values for the placeholder parameters
+	args := append([]any{title, pq.Array(genres)}, releases.args()...)
+	args = append(args, filters.limit(), filters.offset())
+
+	if c != nil {
+		// Counting every matching row defeats the purpose of keyset pagination, so it is skipped
+		countColumn = "0"
+
+		// Fetching one extra row to find out whether there is another page after this one
+		args[4] = filters.limit() + 1
+		args[5] = 0
+
+		// Rows after the cursor come later in the sort order, with the id as the tie breaker
+		comparison, idComparison := ">", ">"
+		if sortDirection == "DESC" {
+			comparison = "<"
+		}
+
+		// Walking backwards flips the comparisons and the ordering, the rows are reversed again below
+		if c.Backward {
+			comparison, idComparison = flipComparison(comparison), "<"
+			sortDirection, idDirection = flipDirection(sortDirection), "DESC"
+		}
+
+		keysetClause = fmt.Sprintf("AND (%s %s $7 OR (%s = $7 AND id %s $8))", sortColumn, comparison, sortColumn, idComparison)
+		args = append(args, c.Value, c.ID)
+	}
+
 	// Defining the SQL query for retrieving the movie records
 	query := fmt.Sprintf(`
-		SELECT count(*) OVER(), id, created_at, title, year, runtime, genres, version
+		SELECT %s, id, created_at, title, year, runtime, genres, version, %s
 		FROM movies
-		WHERE (to_tsvector('simple', title) @@ plainto_tsquery('simple', $1) OR $1 = '')
-		AND (genres @> $2 OR $2 = '{}')
-		ORDER BY %s %s, id ASC
-		LIMIT $3 OFFSET $4`, filters.sortColumn(), filters.sortDirection())
+		WHERE %s
+		%s
+		ORDER BY %s %s, id %s
+		LIMIT $5 OFFSET $6`, countColumn, movieRelevance, movieFilterClause(fuzzy), keysetClause, sortColumn, sortDirection, idDirection)
 
 	// Creating a new context with a 3 second timeout
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
-	// Creating an args slice to store the values for the placeholder parameters
-	args := []any{title, pq.Array(genres), filters.limit(), filters.offset()}
-
 	// Executing the query using the DB connection pool
 	rows, err := m.DB.QueryContext(ctx, query, args...)
 	if err != nil {
@@ -229,6 +673,7 @@ func (m MovieModel) GetAll(title string, genres []string, filters Filters) ([]*M
 			&movie.Runtime,
 			pq.Array(&movie.Genres),
 			&movie.Version,
+			&movie.relevance,
 		)
 		if err != nil {
 			return nil, Metadata{}, err
@@ -243,13 +688,350 @@ func (m MovieModel) GetAll(title string, genres []string, filters Filters) ([]*M
 		return nil, Metadata{}, err
 	}
 
+	// Attaching the images, the translations, the releases and the external ids of the movies on the page
+	err = attachImages(ctx, m.DB, movies...)
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+
+	err = attachTranslations(ctx, m.DB, movies...)
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+
+	err = attachReleases(ctx, m.DB, movies...)
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+
+	err = attachExternalIDs(ctx, m.DB, movies...)
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+
+	// Calculating the metadata for keyset pagination
+	if c != nil {
+		movies, metadata := keysetMetadata(movies, filters, c)
+		return movies, metadata, nil
+	}
+
 	// Declaring a metadata struct to hold the metadata for the response
 	metadata := calculateMetadata(totalRecords, filters.Page, filters.PageSize)
 
+	// Adding cursors to the page based metadata, so that clients can switch to keyset pagination
+	if len(movies) > 0 {
+		if metadata.CurrentPage < metadata.LastPage {
+			metadata.NextCursor = movieCursor(movies[len(movies)-1], filters, false)
+		}
+		if metadata.CurrentPage > 1 {
+			metadata.PrevCursor = movieCursor(movies[0], filters, true)
+		}
+	}
+
 	// Returning the slice of movies
 	return movies, metadata, nil
 }
 
+// Safelist of the facets which can be counted over a movie listing
+var FacetSafelist = []string{"genres", "decade", "runtime_bucket"}
+
+// SQL expressions for the value each facet groups the filtered movies by
+var facetExpressions = map[string]string{
+	"genres": "unnest(genres)",
+	"decade": "((year / 10) * 10)::text || 's'",
+	"runtime_bucket": `CASE
+			WHEN runtime < 90 THEN '0-89'
+			WHEN runtime < 120 THEN '90-119'
+			WHEN runtime < 150 THEN '120-149'
+			ELSE '150+'
+		END`,
+}
+
+// FacetCount struct which holds the number of movies sharing a facet value
+type FacetCount struct {
+	Value string `json:"value"`
+	Count int    `json:"count"`
+}
+
+// Facets type which maps each requested facet to its value counts
+type Facets map[string][]FacetCount
+
+// Validate the requested facets against the safelist
+func ValidateFacets(v *validator.Validator, facets []string) {
+	for _, facet := range facets {
+		v.Check(validator.In(facet, FacetSafelist...), "facets", "invalid facet value")
+	}
+	v.Check(validator.Unique(facets), "facets", "must not contain duplicate values")
+}
+
+// Count the movies matching the same filters as GetAll, grouped by each of the requested facets
+func (m MovieModel) GetFacets(title string, genres []string, fuzzy bool, releases ReleaseFilter, facets []string) (Facets, error) {
+	result := Facets{}
+	if len(facets) == 0 {
+		return result, nil
+	}
+
+	// Building one grouped count for each facet over the filtered movies
+	parts := make([]string, 0, len(facets))
+	for _, facet := range facets {
+		expression, ok := facetExpressions[facet]
+		if !ok {
+			// Panic if the facet is not in the safelist
+			panic("unsafe facet parameter: " + facet)
+		}
+
+		parts = append(parts, fmt.Sprintf(`
+		SELECT '%s' AS facet, value, count(*) AS count
+		FROM (SELECT %s AS value FROM filtered) AS facet_values
+		GROUP BY value`, facet, expression))
+
+		// Returning an empty list rather than null for facets without any values
+		result[facet] = []FacetCount{}
+	}
+
+	// Defining the SQL query, filtering the movies once and counting every facet over them
+	query := fmt.Sprintf(`
+		WITH filtered AS (
+			SELECT genres, year, runtime
+			FROM movies
+			WHERE %s
+		)
+		%s
+		ORDER BY facet, count DESC, value ASC`, movieFilterClause(fuzzy), strings.Join(parts, "\n\t\tUNION ALL"))
+
+	// Creating a new context with a 3 second timeout
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	// Executing the query using the DB connection pool
+	args := append([]any{title, pq.Array(genres)}, releases.args()...)
+	rows, err := m.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	// Looping through the rows and grouping the counts by facet
+	for rows.Next() {
+		var facet string
+		var count FacetCount
+
+		err := rows.Scan(&facet, &count.Value, &count.Count)
+		if err != nil {
+			return nil, err
+		}
+
+		result[facet] = append(result[facet], count)
+	}
+
+	// Handling the errors encountered during the rows.Next() loop
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// MovieSuggestion struct which holds the small subset of a movie returned by autocomplete
+type MovieSuggestion struct {
+	ID    int64  `json:"id"`
+	Title string `json:"title"`
+	Year  int32  `json:"year"`
+}
+
+// Find the movies whose title best completes the given prefix
+// Titles starting with the prefix come first, followed by the closest trigram matches
+func (m MovieModel) Autocomplete(prefix string, limit int) ([]*MovieSuggestion, error) {
+	// Defining the SQL query for retrieving the suggestions
+	query := `
+		SELECT id, title, year
+		FROM movies
+		WHERE (title ILIKE $1 OR $2 <% title) AND deleted_at IS NULL
+		ORDER BY title ILIKE $1 DESC, word_similarity($2, title) DESC, title ASC, id ASC
+		LIMIT $3`
+
+	// Escaping the LIKE wildcards in the prefix, so that they are matched literally
+	pattern := strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(prefix) + "%"
+
+	// Creating a new context with a 3 second timeout
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	// Executing the query using the DB connection pool
+	rows, err := m.DB.QueryContext(ctx, query, pattern, prefix, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	// Looping through the rows and scanning each suggestion
+	suggestions := []*MovieSuggestion{}
+	for rows.Next() {
+		var suggestion MovieSuggestion
+
+		err := rows.Scan(&suggestion.ID, &suggestion.Title, &suggestion.Year)
+		if err != nil {
+			return nil, err
+		}
+
+		suggestions = append(suggestions, &suggestion)
+	}
+
+	// Handling the errors encountered during the rows.Next() loop
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return suggestions, nil
+}
+
+// Number of rows fetched from the export cursor at a time
+const exportFetchSize = 500
+
+// Stream every movie matching the same filters as GetAll to fn, in the sort order of the filters
+// The rows are read in batches through a server side cursor, so the result set is never held in memory
+// The context is taken from the caller, so that the export stops when the client goes away
+func (m MovieModel) Export(ctx context.Context, title string, genres []string, fuzzy bool, releases ReleaseFilter, filters Filters, fn func(*Movie) error) error {
+	// Relevance is ranked by an expression rather than a column, and the most relevant movies come first
+	sortColumn := filters.sortColumn()
+	sortDirection := filters.sortDirection()
+	if sortColumn == "relevance" {
+		sortColumn = movieRelevance
+		sortDirection = flipDirection(sortDirection)
+	}
+
+	// Cursors only live within a transaction
+	tx, err := m.DB.BeginTx(ctx, &sql.TxOptions{ReadOnly: true})
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// Declaring the cursor over the filtered movies, along with their external ids
+	// The ids are aggregated by the cursor, since no other query can run while its rows are being read
+	query := fmt.Sprintf(`
+		DECLARE movie_export NO SCROLL CURSOR FOR
+		SELECT id, created_at, title, year, runtime, genres, version,
+			(SELECT coalesce(jsonb_object_agg(provider, external_id), '{}') FROM external_ids WHERE movie_id = movies.id)
+		FROM movies
+		WHERE %s
+		ORDER BY %s %s, id ASC`, movieFilterClause(fuzzy), sortColumn, sortDirection)
+
+	args := append([]any{title, pq.Array(genres)}, releases.args()...)
+	_, err = tx.ExecContext(ctx, query, args...)
+	if err != nil {
+		return err
+	}
+
+	// Fetching batches from the cursor until it is exhausted
+	for {
+		rows, err := tx.QueryContext(ctx, fmt.Sprintf("FETCH FORWARD %d FROM movie_export", exportFetchSize))
+		if err != nil {
+			return err
+		}
+
+		fetched := 0
+		for rows.Next() {
+			var movie Movie
+			var externalIDs []byte
+
+			err := rows.Scan(
+				&movie.ID,
+				&movie.CreatedAt,
+				&movie.Title,
+				&movie.Year,
+				&movie.Runtime,
+				pq.Array(&movie.Genres),
+				&movie.Version,
+				&externalIDs,
+			)
+			if err == nil {
+				err = json.Unmarshal(externalIDs, &movie.ExternalIDs)
+			}
+			if err == nil {
+				err = fn(&movie)
+			}
+			if err != nil {
+				rows.Close()
+				return err
+			}
+
+			fetched++
+		}
+
+		// Handling the errors encountered during the rows.Next() loop
+		rows.Close()
+		if err = rows.Err(); err != nil {
+			return err
+		}
+
+		if fetched < exportFetchSize {
+			break
+		}
+	}
+
+	return tx.Commit()
+}
+
+// Build the cursor pointing before or after the given movie for the current sort order
+func movieCursor(movie *Movie, filters Filters, backward bool) string {
+	return cursor{
+		Sort:     filters.Sort,
+		Value:    movie.sortValue(filters.sortColumn()),
+		ID:       movie.ID,
+		Backward: backward,
+	}.encode()
+}
+
+// Trim the extra row fetched by a keyset query and calculate the cursors for the neighbouring pages
+func keysetMetadata(movies []*Movie, filters Filters, c *cursor) ([]*Movie, Metadata) {
+	// An extra row means there are more rows in the direction we are walking
+	hasMore := len(movies) > filters.limit()
+	if hasMore {
+		movies = movies[:filters.limit()]
+	}
+
+	// Rows fetched backwards are in reverse order
+	if c.Backward {
+		for i, j := 0, len(movies)-1; i < j; i, j = i+1, j-1 {
+			movies[i], movies[j] = movies[j], movies[i]
+		}
+	}
+
+	metadata := Metadata{PageSize: filters.PageSize}
+	if len(movies) == 0 {
+		return movies, metadata
+	}
+
+	// The page we came from always exists, the page we are heading to only if there were more rows
+	if !c.Backward || hasMore {
+		metadata.PrevCursor = movieCursor(movies[0], filters, true)
+	}
+	if c.Backward || hasMore {
+		metadata.NextCursor = movieCursor(movies[len(movies)-1], filters, false)
+	}
+
+	return movies, metadata
+}
+
+// Return the opposite of the given comparison operator
+func flipComparison(comparison string) string {
+	if comparison == ">" {
+		return "<"
+	}
+
+	return ">"
+}
+
+// Return the opposite of the given sort direction
+func flipDirection(direction string) string {
+	if direction == "ASC" {
+		return "DESC"
+	}
+
+	return "ASC"
+}
+
 // CRUD OPERATIONS for the MockMovieModel
 
 // Mock Movie Model for testing
@@ -262,11 +1044,41 @@ func (m MockMovieModel) Insert(movie *Movie) error {
 	return nil
 }
 
+// Insert a batch of movie records within a single transaction
+func (m MockMovieModel) InsertBatch(movies []*Movie, atomic bool) ([]error, error) {
+	return make([]error, len(movies)), nil
+}
+
+// Stream every movie matching the filters to fn
+func (m MockMovieModel) Export(ctx context.Context, title string, genres []string, fuzzy bool, releases ReleaseFilter, filters Filters, fn func(*Movie) error) error {
+	return nil
+}
+
+// List the movies in the trash
+func (m MockMovieModel) GetDeleted(filters Filters) ([]*Movie, Metadata, error) {
+	return nil, Metadata{}, nil
+}
+
+// Restore a movie from the trash based on its id
+func (m MockMovieModel) Restore(id int64) (*Movie, error) {
+	return nil, nil
+}
+
+// Permanently delete the movies which have been in the trash for longer than the retention period
+func (m MockMovieModel) PurgeDeleted(retention time.Duration) (int64, []string, error) {
+	return 0, nil, nil
+}
+
 // Get a specific movie based on its id
 func (m MockMovieModel) Get(id int64) (*Movie, error) {
 	return nil, nil
 }
 
+// Lookup the movie which has the given id in the given provider
+func (m MockMovieModel) Lookup(provider, externalID string) (*Movie, error) {
+	return nil, nil
+}
+
 // Update a specific movie based on its id
 func (m MockMovieModel) Update(movie *Movie) error {
 	return nil
@@ -278,6 +1090,16 @@ func (m MockMovieModel) Delete(id int64) error {
 }
 
 // List all movies in the database
-func (m MockMovieModel) GetAll(title string, genres []string, filters Filters) ([]*Movie, Metadata, error) {
+func (m MockMovieModel) GetAll(title string, genres []string, fuzzy bool, releases ReleaseFilter, filters Filters) ([]*Movie, Metadata, error) {
 	return nil, Metadata{}, nil
 }
+
+// Find the movies whose title best completes the given prefix
+func (m MockMovieModel) Autocomplete(prefix string, limit int) ([]*MovieSuggestion, error) {
+	return nil, nil
+}
+
+// Count the movies matching the filters, grouped by each of the requested facets
+func (m MockMovieModel) GetFacets(title string, genres []string, fuzzy bool, releases ReleaseFilter, facets []string) (Facets, error) {
+	return Facets{}, nil
+}
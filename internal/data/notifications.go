@@ -0,0 +1,333 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"moviego.madhav.net/internal/validator"
+)
+
+// Define the kinds of notification, each of them has an email template of the same name in the mail package
+const (
+	NotificationSubmissionReviewed = "submission_reviewed"
+	NotificationCommentReplied     = "comment_replied"
+	NotificationUserFollowed       = "user_followed"
+)
+
+// NotificationKinds lists every kind of notification, in the order the preferences are listed
+var NotificationKinds = []string{
+	NotificationSubmissionReviewed,
+	NotificationCommentReplied,
+	NotificationUserFollowed,
+}
+
+// Notification struct which holds something a user is told about in the app
+type Notification struct {
+	ID        int64          `json:"id"`
+	CreatedAt time.Time      `json:"created_at"`
+	UserID    int64          `json:"-"`
+	Kind      string         `json:"kind"`
+	Data      map[string]any `json:"data,omitempty"` // Details of the notification, also used for the email
+	ReadAt    *time.Time     `json:"read_at,omitempty"`
+}
+
+// NotificationPreference struct which holds the channels a user is told about a kind of notification through
+type NotificationPreference struct {
+	Kind  string `json:"kind"`
+	InApp bool   `json:"in_app"`
+	Email bool   `json:"email"`
+}
+
+// Channels used for a kind of notification, until the user sets their own preference
+// Reviews of submissions used to be emailed, so they still are by default
+var notificationDefaults = map[string]NotificationPreference{
+	NotificationSubmissionReviewed: {Kind: NotificationSubmissionReviewed, InApp: true, Email: true},
+	NotificationCommentReplied:     {Kind: NotificationCommentReplied, InApp: true, Email: false},
+	NotificationUserFollowed:       {Kind: NotificationUserFollowed, InApp: true, Email: false},
+}
+
+// Validate the preferences a user sets, each kind only once
+func ValidateNotificationPreferences(v *validator.Validator, preferences []*NotificationPreference) {
+	v.Check(len(preferences) > 0, "preferences", "must contain at least 1 preference")
+
+	kinds := make([]string, 0, len(preferences))
+	for _, preference := range preferences {
+		v.Check(validator.In(preference.Kind, NotificationKinds...), "kind", "must be a known kind of notification")
+		kinds = append(kinds, preference.Kind)
+	}
+	v.Check(validator.Unique(kinds), "kind", "must not contain duplicate kinds")
+}
+
+// Defining the NotificationModel struct to hold the database connection pool
+type NotificationModel struct {
+	DB *sql.DB
+}
+
+// Insert a new notification into the notifications table
+func (m NotificationModel) Insert(notification *Notification) error {
+	// Encoding the details to be stored as JSON
+	js, err := json.Marshal(notification.Data)
+	if err != nil {
+		return err
+	}
+
+	// Defining the SQL query for inserting a new record
+	query := `
+		INSERT INTO notifications (user_id, kind, data)
+		VALUES ($1, $2, $3)
+		RETURNING id, created_at`
+
+	// Creating a new context with a 3 second timeout
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	// Executing the query using the DB connection pool
+	return m.DB.QueryRowContext(ctx, query, notification.UserID, notification.Kind, js).Scan(&notification.ID, &notification.CreatedAt)
+}
+
+// List the notifications of a user, most recent first, only the unread ones when unread is true
+func (m NotificationModel) GetForUser(userID int64, unread bool, filters Filters) ([]*Notification, Metadata, error) {
+	// Defining the SQL query for retrieving the notification records
+	query := `
+		SELECT count(*) OVER(), id, created_at, user_id, kind, data, read_at
+		FROM notifications
+		WHERE user_id = $1
+		AND (read_at IS NULL OR NOT $2)
+		ORDER BY id DESC
+		LIMIT $3 OFFSET $4`
+
+	// Creating a new context with a 3 second timeout
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	// Executing the query using the DB connection pool
+	rows, err := m.DB.QueryContext(ctx, query, userID, unread, filters.limit(), filters.offset())
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+	defer rows.Close()
+
+	// Looping through the rows in the result set
+	totalRecords := 0
+	notifications := []*Notification{}
+	for rows.Next() {
+		var notification Notification
+		var js []byte
+
+		err := rows.Scan(
+			&totalRecords,
+			&notification.ID,
+			&notification.CreatedAt,
+			&notification.UserID,
+			&notification.Kind,
+			&js,
+			&notification.ReadAt,
+		)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+
+		err = json.Unmarshal(js, &notification.Data)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+
+		notifications = append(notifications, &notification)
+	}
+
+	// Handling the errors encountered during the rows.Next() loop
+	if err = rows.Err(); err != nil {
+		return nil, Metadata{}, err
+	}
+
+	return notifications, calculateMetadata(totalRecords, filters.Page, filters.PageSize), nil
+}
+
+// Count the unread notifications of a user
+func (m NotificationModel) CountUnread(userID int64) (int, error) {
+	// Defining the SQL query for counting the unread notifications
+	query := `
+		SELECT count(*)
+		FROM notifications
+		WHERE user_id = $1 AND read_at IS NULL`
+
+	// Creating a new context with a 3 second timeout
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	// Executing the query using the DB connection pool
+	var count int
+	err := m.DB.QueryRowContext(ctx, query, userID).Scan(&count)
+	return count, err
+}
+
+// Mark a notification of a user as read, which does nothing when it already is
+func (m NotificationModel) MarkRead(id, userID int64) error {
+	// Validating the id parameter
+	if id < 1 {
+		return ErrRecordNotFound
+	}
+
+	// Defining the SQL query for marking the notification as read, keeping the time it was first read
+	query := `
+		UPDATE notifications
+		SET read_at = coalesce(read_at, now())
+		WHERE id = $1 AND user_id = $2`
+
+	// Creating a new context with a 3 second timeout
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	// Executing the query using the DB connection pool
+	result, err := m.DB.ExecContext(ctx, query, id, userID)
+	if err != nil {
+		return err
+	}
+
+	// Checking if the notification record was found
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+
+	return nil
+}
+
+// Mark every unread notification of a user as read, returning how many were marked
+func (m NotificationModel) MarkAllRead(userID int64) (int64, error) {
+	// Defining the SQL query for marking the notifications as read
+	query := `
+		UPDATE notifications
+		SET read_at = now()
+		WHERE user_id = $1 AND read_at IS NULL`
+
+	// Creating a new context with a 3 second timeout
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	// Executing the query using the DB connection pool
+	result, err := m.DB.ExecContext(ctx, query, userID)
+	if err != nil {
+		return 0, err
+	}
+
+	return result.RowsAffected()
+}
+
+// Defining the NotificationPreferenceModel struct to hold the database connection pool
+type NotificationPreferenceModel struct {
+	DB *sql.DB
+}
+
+// Get the preferences of a user for every kind of notification, falling back to the defaults
+func (m NotificationPreferenceModel) GetForUser(userID int64) ([]*NotificationPreference, error) {
+	// Defining the SQL query for retrieving the preferences the user has set
+	query := `
+		SELECT kind, in_app, email
+		FROM notification_preferences
+		WHERE user_id = $1`
+
+	// Creating a new context with a 3 second timeout
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	// Executing the query using the DB connection pool
+	rows, err := m.DB.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	// Looping through the rows, starting from the defaults
+	set := make(map[string]NotificationPreference)
+	for rows.Next() {
+		var preference NotificationPreference
+
+		err := rows.Scan(&preference.Kind, &preference.InApp, &preference.Email)
+		if err != nil {
+			return nil, err
+		}
+
+		set[preference.Kind] = preference
+	}
+
+	// Handling the errors encountered during the rows.Next() loop
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	// Listing every kind, so that the defaults show up as well
+	preferences := make([]*NotificationPreference, 0, len(NotificationKinds))
+	for _, kind := range NotificationKinds {
+		preference, ok := set[kind]
+		if !ok {
+			preference = notificationDefaults[kind]
+		}
+		preferences = append(preferences, &preference)
+	}
+
+	return preferences, nil
+}
+
+// Get the preference of a user for a single kind of notification, falling back to the default
+func (m NotificationPreferenceModel) Get(userID int64, kind string) (*NotificationPreference, error) {
+	// Defining the SQL query for retrieving the preference
+	query := `
+		SELECT kind, in_app, email
+		FROM notification_preferences
+		WHERE user_id = $1 AND kind = $2`
+
+	// Creating a new context with a 3 second timeout
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	// Executing the query using the DB connection pool
+	var preference NotificationPreference
+	err := m.DB.QueryRowContext(ctx, query, userID, kind).Scan(&preference.Kind, &preference.InApp, &preference.Email)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			preference = notificationDefaults[kind]
+		default:
+			return nil, err
+		}
+	}
+
+	return &preference, nil
+}
+
+// Set the preferences of a user, leaving the kinds which aren't given unchanged
+func (m NotificationPreferenceModel) Upsert(userID int64, preferences []*NotificationPreference) error {
+	// Creating a new context with a 3 second timeout
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	// Starting a transaction, so that either every preference is set or none is
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// Defining the SQL query for setting a preference
+	query := `
+		INSERT INTO notification_preferences (user_id, kind, in_app, email)
+		VALUES ($1, $2, $3, $4)
+		ON CONFLICT (user_id, kind) DO UPDATE
+		SET in_app = EXCLUDED.in_app, email = EXCLUDED.email`
+
+	for _, preference := range preferences {
+		_, err = tx.ExecContext(ctx, query, userID, preference.Kind, preference.InApp, preference.Email)
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
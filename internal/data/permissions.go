@@ -73,16 +73,22 @@ func (m PermissionModel) GetAllForUser(userID int64) (Permissions, error) {
 
 // Method for granting permissions to a user
 func (m PermissionModel) AddForUser(userID int64, codes ...string) error {
+	// Defining a context with a 3 second timeout
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	// Executing the query using the DB connection pool
+	return addPermissionsForUser(ctx, m.DB, userID, codes...)
+}
+
+// Add the permissions for a specific user using the given connection pool or transaction
+func addPermissionsForUser(ctx context.Context, db dbtx, userID int64, codes ...string) error {
 	// Defining the SQL query for inserting the permissions for a specific user
 	query := `
 		INSERT INTO users_permissions
 		SELECT $1, permissions.id FROM permissions WHERE permissions.code = ANY($2)`
 
-	// Defining a context with a 3 second timeout
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
-	defer cancel()
-
 	// Executing the query and returning the result set or an error
-	_, err := m.DB.ExecContext(ctx, query, userID, pq.Array(codes))
+	_, err := db.ExecContext(ctx, query, userID, pq.Array(codes))
 	return err
 }
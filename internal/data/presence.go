@@ -0,0 +1,30 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+// Channel the editors of movies are sent on between the API instances through Postgres NOTIFY
+const PresenceChannel = "movie_presence"
+
+// Defining the PresenceModel struct to hold the database connection pool
+type PresenceModel struct {
+	DB *sql.DB
+}
+
+// Notify every API instance listening on the presence channel with the payload
+// Nothing is stored, an instance which isn't listening at the time misses it. Postgres limits the payload to 8000 bytes
+func (m PresenceModel) Notify(payload []byte) error {
+	// Defining the SQL query for sending the notification
+	query := `SELECT pg_notify($1, $2)`
+
+	// Creating a context with a 3 second timeout
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	// Executing the query using the DB connection pool
+	_, err := m.DB.ExecContext(ctx, query, PresenceChannel, string(payload))
+	return err
+}
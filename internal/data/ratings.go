@@ -0,0 +1,121 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"moviego.madhav.net/internal/validator"
+)
+
+// Rating struct which holds the rating a user gave to a movie
+type Rating struct {
+	UserID    int64     `json:"-"`
+	MovieID   int64     `json:"movie_id"`
+	Rating    int32     `json:"rating"` // Rating from 1 to 10
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// Validate method which validates the rating struct
+func ValidateRating(v *validator.Validator, rating *Rating) {
+	v.Check(rating.Rating >= 1, "rating", "must be at least 1")
+	v.Check(rating.Rating <= 10, "rating", "must not be more than 10")
+}
+
+// Defining the RatingModel struct to hold the database connection pool
+type RatingModel struct {
+	DB *sql.DB
+}
+
+// Insert or replace the rating of a user for a movie, which fails for movies in the trash
+// The rating is recorded in the activity of the user with the given visibility, in the same transaction
+func (m RatingModel) Upsert(rating *Rating, visibility string) error {
+	// Defining the SQL query for upserting the record
+	query := `
+		INSERT INTO movie_ratings (user_id, movie_id, rating)
+		SELECT $1, id, $3
+		FROM movies
+		WHERE id = $2 AND deleted_at IS NULL
+		ON CONFLICT (user_id, movie_id) DO UPDATE
+		SET rating = EXCLUDED.rating, updated_at = now()
+		RETURNING updated_at`
+
+	// Creating a new context with a 3 second timeout
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	// Starting the transaction, which is rolled back unless it is committed below
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// Executing the query within the transaction
+	err = tx.QueryRowContext(ctx, query, rating.UserID, rating.MovieID, rating.Rating).Scan(&rating.UpdatedAt)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrRecordNotFound
+		default:
+			return err
+		}
+	}
+
+	// Recording the rating in the activity of the user
+	err = upsertRatingActivity(ctx, tx, rating, visibility)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// Delete the rating of a user for a movie
+// The rating is removed from the activity of the user in the same transaction, so that it leaves the feeds too
+func (m RatingModel) Delete(userID, movieID int64) error {
+	// Validating the id parameter
+	if movieID < 1 {
+		return ErrRecordNotFound
+	}
+
+	// Defining the SQL query for deleting the rating record
+	query := `
+		DELETE FROM movie_ratings
+		WHERE user_id = $1 AND movie_id = $2`
+
+	// Creating a new context with a 3 second timeout
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	// Starting the transaction, which is rolled back unless it is committed below
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// Executing the query within the transaction
+	result, err := tx.ExecContext(ctx, query, userID, movieID)
+	if err != nil {
+		return err
+	}
+
+	// Checking if the rating record was found
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+
+	// Removing the rating from the activity of the user
+	err = deleteRatingActivity(ctx, tx, userID, movieID)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
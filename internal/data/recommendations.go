@@ -0,0 +1,139 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// Recommendation struct which holds a movie recommended to a user, along with how well it fits their taste
+type Recommendation struct {
+	Movie *Movie  `json:"movie"`
+	Score float64 `json:"score"`
+}
+
+// Rating which counts as neither liking nor disliking a movie, on the 1 to 10 scale
+const neutralRating = 5.5
+
+// Defining the RecommendationModel struct to hold the database connection pool
+type RecommendationModel struct {
+	DB *sql.DB
+}
+
+// Rebuild the taste profile of a user from their ratings
+// Watchlists and explicit genre preferences aren't modelled yet, so ratings are the only input of the profile
+// Each genre is weighted by the average distance of the user's ratings from a neutral rating,
+// so genres of movies rated highly weigh positively, and genres of movies rated poorly negatively
+// Only the profile of the given user is recomputed, so it is cheap enough to run after every rating
+// Rebuilds of the same profile are serialized by locking its row, and each reads the ratings once it holds the lock,
+// so that a rebuild which read older ratings can't commit after one which read newer ones
+func (m RecommendationModel) RebuildProfile(userID int64) error {
+	// Defining the SQL query for upserting the profile
+	query := `
+		INSERT INTO user_taste_profiles (user_id, genre_weights, updated_at)
+		SELECT $1, coalesce(jsonb_object_agg(genre, weight), '{}'), now()
+		FROM (
+			SELECT genre, avg(r.rating - $2::numeric) AS weight
+			FROM movie_ratings r
+			INNER JOIN movies m ON m.id = r.movie_id, unnest(m.genres) AS genre
+			WHERE r.user_id = $1 AND m.deleted_at IS NULL
+			GROUP BY genre
+		) AS weights
+		ON CONFLICT (user_id) DO UPDATE
+		SET genre_weights = EXCLUDED.genre_weights, updated_at = EXCLUDED.updated_at`
+
+	// Creating a new context with a 3 second timeout
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	// Starting the transaction, which is rolled back unless it is committed below
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// Locking the profile, creating it first if the user has none yet
+	_, err = tx.ExecContext(ctx, `INSERT INTO user_taste_profiles (user_id) VALUES ($1) ON CONFLICT DO NOTHING`, userID)
+	if err != nil {
+		return err
+	}
+	_, err = tx.ExecContext(ctx, `SELECT 1 FROM user_taste_profiles WHERE user_id = $1 FOR UPDATE`, userID)
+	if err != nil {
+		return err
+	}
+
+	// Executing the query within the transaction, in a statement of its own so that it sees the ratings committed
+	// while it was waiting for the lock
+	_, err = tx.ExecContext(ctx, query, userID, neutralRating)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// List the movies recommended to a user, best fitting first
+// Movies are scored by the average weight of their genres in the user's taste profile,
+// and the movies the user already rated are left out
+// Users without a taste profile yet get no recommendations
+func (m RecommendationModel) GetForUser(userID int64, filters Filters) ([]*Recommendation, Metadata, error) {
+	// Defining the SQL query for scoring the movies against the profile
+	query := `
+		SELECT count(*) OVER(), m.id, m.created_at, m.title, m.year, m.runtime, m.genres, m.version, s.score
+		FROM user_taste_profiles p
+		CROSS JOIN movies m
+		CROSS JOIN LATERAL (
+			SELECT sum((p.genre_weights ->> genre)::float) / cardinality(m.genres) AS score
+			FROM unnest(m.genres) AS genre
+		) AS s
+		WHERE p.user_id = $1 AND m.deleted_at IS NULL AND s.score > 0
+		AND NOT EXISTS (SELECT 1 FROM movie_ratings r WHERE r.user_id = $1 AND r.movie_id = m.id)
+		ORDER BY s.score DESC, m.id ASC
+		LIMIT $2 OFFSET $3`
+
+	// Creating a new context with a 3 second timeout
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	// Executing the query using the DB connection pool
+	rows, err := m.DB.QueryContext(ctx, query, userID, filters.limit(), filters.offset())
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+	defer rows.Close()
+
+	// Looping through the rows in the result set
+	totalRecords := 0
+	recommendations := []*Recommendation{}
+	for rows.Next() {
+		var recommendation Recommendation
+		recommendation.Movie = &Movie{}
+
+		err := rows.Scan(
+			&totalRecords,
+			&recommendation.Movie.ID,
+			&recommendation.Movie.CreatedAt,
+			&recommendation.Movie.Title,
+			&recommendation.Movie.Year,
+			&recommendation.Movie.Runtime,
+			pq.Array(&recommendation.Movie.Genres),
+			&recommendation.Movie.Version,
+			&recommendation.Score,
+		)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+
+		recommendations = append(recommendations, &recommendation)
+	}
+
+	// Handling the errors encountered during the rows.Next() loop
+	if err = rows.Err(); err != nil {
+		return nil, Metadata{}, err
+	}
+
+	return recommendations, calculateMetadata(totalRecords, filters.Page, filters.PageSize), nil
+}
@@ -0,0 +1,338 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/lib/pq"
+	"moviego.madhav.net/internal/validator"
+)
+
+// Define the different types of release a movie can have
+const (
+	ReleaseTheatrical = "theatrical"
+	ReleaseDigital    = "digital"
+	ReleasePhysical   = "physical"
+)
+
+// Defining a custom error for a second release of the same type in the same country
+var ErrDuplicateRelease = errors.New("duplicate release")
+
+// Certifications known for each country, ordered from the least to the most restrictive
+var Certifications = map[string][]string{
+	"US": {"G", "PG", "PG-13", "R", "NC-17"},
+	"GB": {"U", "PG", "12A", "12", "15", "18", "R18"},
+	"DE": {"FSK 0", "FSK 6", "FSK 12", "FSK 16", "FSK 18"},
+	"FR": {"U", "10", "12", "16", "18"},
+	"IN": {"U", "UA", "A", "S"},
+	"AU": {"G", "PG", "M", "MA15+", "R18+", "X18+"},
+	"CA": {"G", "PG", "14A", "18A", "R", "A"},
+	"JP": {"G", "PG12", "R15+", "R18+"},
+	"BR": {"L", "10", "12", "14", "16", "18"},
+}
+
+// MovieRelease struct which holds the release of a movie in one country
+type MovieRelease struct {
+	ID            int64  `json:"id"`
+	MovieID       int64  `json:"-"`
+	Country       string `json:"country"`       // ISO 3166-1 alpha-2 country code, such as "US"
+	Type          string `json:"type"`          // Release type, one of theatrical, digital or physical
+	Date          string `json:"date"`          // Release date in the form "2006-01-02"
+	Certification string `json:"certification"` // Age certification in the country, may be empty
+	Version       int32  `json:"version"`
+}
+
+// Validate method which validates the release struct
+func ValidateRelease(v *validator.Validator, release *MovieRelease) {
+	v.Check(validator.Matches(release.Country, validator.CountryRX), "country", "must be a two letter country code")
+
+	v.Check(validator.In(release.Type, ReleaseTheatrical, ReleaseDigital, ReleasePhysical), "type", "must be theatrical, digital or physical")
+
+	_, err := time.Parse("2006-01-02", release.Date)
+	v.Check(err == nil, "date", "must be a date in the form YYYY-MM-DD")
+
+	if release.Certification != "" {
+		certifications, ok := Certifications[release.Country]
+		v.Check(ok, "certification", "is not supported for this country")
+		v.Check(!ok || validator.In(release.Certification, certifications...), "certification", "is not a known certification for this country")
+	}
+}
+
+// ReleaseFilter struct which narrows movie listings down to the movies released in a country
+type ReleaseFilter struct {
+	Country          string // Only movies released in the country, when set
+	CertificationMax string // Only movies certified at most this restrictive in the country, when set
+}
+
+// Validate method which validates the release filter
+func ValidateReleaseFilter(v *validator.Validator, filter ReleaseFilter) {
+	if filter.Country != "" {
+		v.Check(validator.Matches(filter.Country, validator.CountryRX), "released_in", "must be a two letter country code")
+	}
+
+	if filter.CertificationMax != "" {
+		certifications, ok := Certifications[filter.Country]
+		v.Check(filter.Country != "", "certification_max", "requires released_in")
+		v.Check(filter.Country == "" || ok, "certification_max", "is not supported for this country")
+		v.Check(!ok || validator.In(filter.CertificationMax, certifications...), "certification_max", "is not a known certification for this country")
+	}
+}
+
+// Return the values of the $3 and $4 placeholders of movieFilterClause
+// The certification cap is passed as the list of certifications up to and including it
+func (filter ReleaseFilter) args() []any {
+	allowed := []string{}
+	for _, certification := range Certifications[filter.Country] {
+		if filter.CertificationMax == "" {
+			break
+		}
+
+		allowed = append(allowed, certification)
+		if certification == filter.CertificationMax {
+			break
+		}
+	}
+
+	return []any{filter.Country, pq.Array(allowed)}
+}
+
+// Defining the ReleaseModel struct to hold the database connection pool
+type ReleaseModel struct {
+	DB *sql.DB
+}
+
+// Insert a new release record into the movie_releases table, which fails for movies in the trash
+// The movie is published as updated in the same transaction
+func (m ReleaseModel) Insert(release *MovieRelease) error {
+	// Defining the SQL query for inserting a new record
+	query := `
+		INSERT INTO movie_releases (movie_id, country, type, release_date, certification)
+		SELECT id, $2, $3, $4::date, $5
+		FROM movies
+		WHERE id = $1 AND deleted_at IS NULL
+		RETURNING id, version`
+
+	// Creating an args slice to store the values for the placeholder parameters
+	args := []any{release.MovieID, release.Country, release.Type, release.Date, release.Certification}
+
+	// Creating a new context with a 3 second timeout
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	// Starting a transaction, so that the movie is published along with the change
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// Executing the query within the transaction
+	err = tx.QueryRowContext(ctx, query, args...).Scan(&release.ID, &release.Version)
+	if err != nil {
+		switch {
+		case err.Error() == `pq: duplicate key value violates unique constraint "movie_releases_movie_id_country_type_key"`:
+			return ErrDuplicateRelease
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrRecordNotFound
+		default:
+			return err
+		}
+	}
+
+	// Publishing the movie, whose releases are part of it
+	err = touchMovie(ctx, tx, release.MovieID)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// Get a specific release of a movie
+func (m ReleaseModel) Get(movieID, id int64) (*MovieRelease, error) {
+	// Validating the id parameters
+	if movieID < 1 || id < 1 {
+		return nil, ErrRecordNotFound
+	}
+
+	// Defining the SQL query for retrieving the release record
+	query := `
+		SELECT id, movie_id, country, type, to_char(release_date, 'YYYY-MM-DD'), certification, version
+		FROM movie_releases
+		WHERE id = $1 AND movie_id = $2`
+
+	// Creating a new context with a 3 second timeout
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	// Executing the query using the DB connection pool
+	release, err := scanRelease(m.DB.QueryRowContext(ctx, query, id, movieID))
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return release, nil
+}
+
+// Update a specific release, as long as it didn't change since it was read
+// The movie is published as updated in the same transaction
+func (m ReleaseModel) Update(release *MovieRelease) error {
+	// Defining the SQL query for updating the release record
+	query := `
+		UPDATE movie_releases
+		SET country = $1, type = $2, release_date = $3::date, certification = $4, version = version + 1
+		WHERE id = $5 AND movie_id = $6 AND version = $7
+		RETURNING version`
+
+	// Creating an args slice to store the values for the placeholder parameters
+	args := []any{release.Country, release.Type, release.Date, release.Certification, release.ID, release.MovieID, release.Version}
+
+	// Creating a new context with a 3 second timeout
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	// Starting a transaction, so that the movie is published along with the change
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// Executing the query within the transaction
+	err = tx.QueryRowContext(ctx, query, args...).Scan(&release.Version)
+	if err != nil {
+		switch {
+		case err.Error() == `pq: duplicate key value violates unique constraint "movie_releases_movie_id_country_type_key"`:
+			return ErrDuplicateRelease
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrEditConflict
+		default:
+			return err
+		}
+	}
+
+	// Publishing the movie, whose releases are part of it
+	err = touchMovie(ctx, tx, release.MovieID)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// Delete a specific release of a movie
+// The movie is published as updated in the same transaction
+func (m ReleaseModel) Delete(movieID, id int64) error {
+	// Validating the id parameters
+	if movieID < 1 || id < 1 {
+		return ErrRecordNotFound
+	}
+
+	// Defining the SQL query for deleting the release record
+	query := `
+		DELETE FROM movie_releases
+		WHERE id = $1 AND movie_id = $2`
+
+	// Creating a new context with a 3 second timeout
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	// Starting a transaction, so that the movie is published along with the change
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// Executing the query within the transaction
+	result, err := tx.ExecContext(ctx, query, id, movieID)
+	if err != nil {
+		return err
+	}
+
+	// Checking if the release record was found
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+
+	// Publishing the movie, whose releases are part of it
+	err = touchMovie(ctx, tx, movieID)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// Attach the releases of each of the given movies, ordered by country and date
+func attachReleases(ctx context.Context, db dbtx, movies ...*Movie) error {
+	if len(movies) == 0 {
+		return nil
+	}
+
+	// Indexing the movies by id
+	ids := make([]int64, len(movies))
+	byID := make(map[int64]*Movie, len(movies))
+	for i, movie := range movies {
+		ids[i] = movie.ID
+		byID[movie.ID] = movie
+		movie.Releases = []*MovieRelease{}
+	}
+
+	// Defining the SQL query for retrieving the releases of all the movies at once
+	query := `
+		SELECT id, movie_id, country, type, to_char(release_date, 'YYYY-MM-DD'), certification, version
+		FROM movie_releases
+		WHERE movie_id = ANY($1)
+		ORDER BY country ASC, release_date ASC, id ASC`
+
+	rows, err := db.QueryContext(ctx, query, pq.Array(ids))
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	// Looping through the rows and adding each release to its movie
+	for rows.Next() {
+		release, err := scanRelease(rows)
+		if err != nil {
+			return err
+		}
+
+		movie := byID[release.MovieID]
+		movie.Releases = append(movie.Releases, release)
+	}
+
+	return rows.Err()
+}
+
+// Scan a release record from a row holding its columns in the order used by the queries above
+func scanRelease(row interface{ Scan(dest ...any) error }) (*MovieRelease, error) {
+	var release MovieRelease
+
+	err := row.Scan(
+		&release.ID,
+		&release.MovieID,
+		&release.Country,
+		&release.Type,
+		&release.Date,
+		&release.Certification,
+		&release.Version,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return &release, nil
+}
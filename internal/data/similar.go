@@ -0,0 +1,121 @@
+package data
+
+import (
+	"context"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// SimilarMovie struct which holds a movie similar to another one, along with how similar it is
+type SimilarMovie struct {
+	Movie *Movie  `json:"movie"`
+	Score float64 `json:"score"`
+}
+
+// Weights of the signals making up the similarity score, which add up to 1
+// Credits, lists and reviews aren't modelled yet, their signals can be added here once they are
+const (
+	similarGenreWeight    = 0.5
+	similarYearWeight     = 0.2
+	similarCoRatingWeight = 0.3
+)
+
+// Number of years apart at which two movies no longer count as close in time
+const similarYearWindow = 20
+
+// Lowest rating at which a user counts as liking a movie
+const similarLikedRating = 7
+
+// List the movies most similar to the given movie, most similar first
+// Movies are scored by the Jaccard index of their genres, by how close their release years are, and by how many
+// of the users who liked the movie also liked them, as the cosine of the sets of users who liked either movie
+// Only movies sharing at least one genre or liked by one of the same users are considered
+func (m MovieModel) GetSimilar(id int64, limit int) ([]*SimilarMovie, error) {
+	// Retrieving the movie the others are compared against, which also checks that it exists
+	movie, err := m.Get(id)
+	if err != nil {
+		return nil, err
+	}
+
+	// Defining the SQL query for scoring the candidate movies
+	// The users who liked the movie are looked up through the primary key of movie_ratings for the co-ratings
+	query := `
+		WITH fans AS (
+			SELECT user_id
+			FROM movie_ratings
+			WHERE movie_id = $1 AND rating >= $8
+		), co_ratings AS (
+			SELECT r.movie_id,
+				count(*)::float / sqrt((SELECT count(*) FROM fans) * (
+					SELECT count(*) FROM movie_ratings l WHERE l.movie_id = r.movie_id AND l.rating >= $8
+				)) AS score
+			FROM movie_ratings r
+			INNER JOIN fans ON fans.user_id = r.user_id
+			WHERE r.movie_id <> $1 AND r.rating >= $8
+			GROUP BY r.movie_id
+		)
+		SELECT m.id, m.created_at, m.title, m.year, m.runtime, m.genres, m.version,
+			$3 * cardinality(ARRAY(SELECT unnest(m.genres) INTERSECT SELECT unnest($2::text[])))::float
+				/ cardinality(ARRAY(SELECT unnest(m.genres) UNION SELECT unnest($2::text[])))
+			+ $4 * (1 - least(abs(m.year - $5), $6)::float / $6)
+			+ $9 * coalesce(co_ratings.score, 0) AS score
+		FROM movies m
+		LEFT JOIN co_ratings ON co_ratings.movie_id = m.id
+		WHERE m.id <> $1 AND m.deleted_at IS NULL
+		AND (m.genres && $2 OR co_ratings.movie_id IS NOT NULL)
+		ORDER BY score DESC, m.id ASC
+		LIMIT $7`
+
+	// Creating an args slice to store the values for the placeholder parameters
+	args := []any{
+		id, pq.Array(movie.Genres), similarGenreWeight, similarYearWeight, *movie.Year, similarYearWindow, limit,
+		similarLikedRating, similarCoRatingWeight,
+	}
+
+	// Creating a new context with a 3 second timeout
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	// Executing the query using the DB connection pool
+	rows, err := m.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	// Looping through the rows in the result set
+	similar := []*SimilarMovie{}
+	for rows.Next() {
+		var s SimilarMovie
+		s.Movie = &Movie{}
+
+		err := rows.Scan(
+			&s.Movie.ID,
+			&s.Movie.CreatedAt,
+			&s.Movie.Title,
+			&s.Movie.Year,
+			&s.Movie.Runtime,
+			pq.Array(&s.Movie.Genres),
+			&s.Movie.Version,
+			&s.Score,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		similar = append(similar, &s)
+	}
+
+	// Handling the errors encountered during the rows.Next() loop
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return similar, nil
+}
+
+// List the movies most similar to the given movie
+func (m MockMovieModel) GetSimilar(id int64, limit int) ([]*SimilarMovie, error) {
+	return nil, nil
+}
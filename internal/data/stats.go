@@ -0,0 +1,125 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+// MovieStats struct which holds the aggregate statistics of the movie catalogue
+type MovieStats struct {
+	TotalMovies     int          `json:"total_movies"`
+	AverageRuntime  float64      `json:"average_runtime"`
+	ByGenre         []FacetCount `json:"by_genre"`
+	ByYear          []FacetCount `json:"by_year"`
+	ByDecade        []FacetCount `json:"by_decade"`
+	RecentAdditions []FacetCount `json:"recent_additions"`
+}
+
+// Aggregate the statistics of the whole movie catalogue
+// Recent additions are counted by month of creation over the last year
+func (m MovieModel) GetStats() (*MovieStats, error) {
+	// Creating a new context with a 3 second timeout
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	// Running the aggregations in a read only transaction, so that they all see the same snapshot
+	tx, err := m.DB.BeginTx(ctx, &sql.TxOptions{Isolation: sql.LevelRepeatableRead, ReadOnly: true})
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	var stats MovieStats
+
+	// Retrieving the totals for the catalogue
+	query := `
+		SELECT count(*), COALESCE(avg(runtime), 0)
+		FROM movies
+		WHERE deleted_at IS NULL`
+
+	err = tx.QueryRowContext(ctx, query).Scan(&stats.TotalMovies, &stats.AverageRuntime)
+	if err != nil {
+		return nil, err
+	}
+
+	// Counting the movies grouped by each of the dimensions
+	groupings := []struct {
+		dst   *[]FacetCount
+		query string
+	}{
+		{&stats.ByGenre, `
+			SELECT genre, count(*)
+			FROM movies, unnest(genres) AS genre
+			WHERE deleted_at IS NULL
+			GROUP BY genre
+			ORDER BY count(*) DESC, genre ASC`},
+		{&stats.ByYear, `
+			SELECT year::text, count(*)
+			FROM movies
+			WHERE deleted_at IS NULL
+			GROUP BY year
+			ORDER BY year ASC`},
+		{&stats.ByDecade, `
+			SELECT ((year / 10) * 10)::text || 's', count(*)
+			FROM movies
+			WHERE deleted_at IS NULL
+			GROUP BY year / 10
+			ORDER BY year / 10 ASC`},
+		{&stats.RecentAdditions, `
+			SELECT to_char(date_trunc('month', created_at), 'YYYY-MM'), count(*)
+			FROM movies
+			WHERE created_at >= date_trunc('month', now()) - INTERVAL '11 months' AND deleted_at IS NULL
+			GROUP BY date_trunc('month', created_at)
+			ORDER BY date_trunc('month', created_at) ASC`},
+	}
+
+	for _, grouping := range groupings {
+		*grouping.dst, err = countRows(ctx, tx, grouping.query)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return &stats, nil
+}
+
+// Scan the value and count pairs returned by a grouped count query
+func countRows(ctx context.Context, tx *sql.Tx, query string) ([]FacetCount, error) {
+	// Executing the query within the transaction
+	rows, err := tx.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	// Looping through the rows and scanning each count
+	counts := []FacetCount{}
+	for rows.Next() {
+		var count FacetCount
+
+		err := rows.Scan(&count.Value, &count.Count)
+		if err != nil {
+			return nil, err
+		}
+
+		counts = append(counts, count)
+	}
+
+	// Handling the errors encountered during the rows.Next() loop
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return counts, nil
+}
+
+// Aggregate the statistics of the whole movie catalogue
+func (m MockMovieModel) GetStats() (*MovieStats, error) {
+	return &MovieStats{
+		ByGenre:         []FacetCount{},
+		ByYear:          []FacetCount{},
+		ByDecade:        []FacetCount{},
+		RecentAdditions: []FacetCount{},
+	}, nil
+}
@@ -0,0 +1,308 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/lib/pq"
+	"moviego.madhav.net/internal/validator"
+)
+
+// Define the kinds of submission, a new movie or an edit of an existing one
+const (
+	SubmissionCreate = "create"
+	SubmissionEdit   = "edit"
+)
+
+// Define the statuses a submission goes through
+const (
+	SubmissionPending  = "pending"
+	SubmissionApproved = "approved"
+	SubmissionRejected = "rejected"
+)
+
+// Submission struct which holds a movie suggested by a user, waiting for a moderator
+// Edits only carry the fields which the user proposed to change
+type Submission struct {
+	ID           int64      `json:"id"`
+	CreatedAt    time.Time  `json:"created_at"`
+	UserID       int64      `json:"user_id"`
+	Kind         string     `json:"kind"`
+	MovieID      *int64     `json:"movie_id,omitempty"`      // Movie which is edited, or which was created on approval
+	MovieVersion *int32     `json:"movie_version,omitempty"` // Version of the movie the edit was proposed against
+	Title        *string    `json:"title,omitempty"`
+	Year         *int32     `json:"year,omitempty"`
+	Runtime      *int32     `json:"runtime,omitempty"`
+	Genres       []string   `json:"genres,omitempty"`
+	Status       string     `json:"status"`
+	Reason       string     `json:"reason,omitempty"` // Reason given by the moderator
+	ReviewedBy   *int64     `json:"reviewed_by,omitempty"`
+	ReviewedAt   *time.Time `json:"reviewed_at,omitempty"`
+	Version      int32      `json:"version"`
+}
+
+// Apply the proposed fields of the submission onto the movie
+func (s *Submission) Apply(movie *Movie) {
+	if s.Title != nil {
+		movie.Title = s.Title
+	}
+	if s.Year != nil {
+		movie.Year = s.Year
+	}
+	if s.Runtime != nil {
+		movie.Runtime = s.Runtime
+	}
+	if s.Genres != nil {
+		movie.Genres = s.Genres
+	}
+}
+
+// Validate the reason a moderator gives for reviewing a submission
+func ValidateReviewReason(v *validator.Validator, reason string, required bool) {
+	v.Check(!required || reason != "", "reason", "must be provided")
+	v.Check(len(reason) <= 1000, "reason", "must not be more than 1000 bytes long")
+}
+
+// Defining the SubmissionModel struct to hold the database connection pool
+type SubmissionModel struct {
+	DB *sql.DB
+}
+
+// Insert a new pending submission into the movie_submissions table
+func (m SubmissionModel) Insert(submission *Submission) error {
+	// Defining the SQL query for inserting a new record
+	query := `
+		INSERT INTO movie_submissions (user_id, kind, movie_id, movie_version, title, year, runtime, genres)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+		RETURNING id, created_at, status, version`
+
+	// Creating an args slice to store the values for the placeholder parameters
+	args := []any{
+		submission.UserID,
+		submission.Kind,
+		submission.MovieID,
+		submission.MovieVersion,
+		submission.Title,
+		submission.Year,
+		submission.Runtime,
+		pq.Array(submission.Genres),
+	}
+
+	// Creating a new context with a 3 second timeout
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	// Executing the query using the DB connection pool
+	return m.DB.QueryRowContext(ctx, query, args...).Scan(&submission.ID, &submission.CreatedAt, &submission.Status, &submission.Version)
+}
+
+// Get a specific submission based on its id
+func (m SubmissionModel) Get(id int64) (*Submission, error) {
+	// Validating the id parameter
+	if id < 1 {
+		return nil, ErrRecordNotFound
+	}
+
+	// Defining the SQL query for retrieving the submission record
+	query := `
+		SELECT id, created_at, user_id, kind, movie_id, movie_version, title, year, runtime, genres,
+			status, reason, reviewed_by, reviewed_at, version
+		FROM movie_submissions
+		WHERE id = $1`
+
+	// Creating a new context with a 3 second timeout
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	// Executing the query using the DB connection pool
+	submission, err := scanSubmission(m.DB.QueryRowContext(ctx, query, id))
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return submission, nil
+}
+
+// List the submissions with the given status, or every submission when the status is empty
+// The submissions of the given user only, when userID isn't zero
+// The oldest submissions come first, so that the queue is worked through in order
+func (m SubmissionModel) GetAll(status string, userID int64, filters Filters) ([]*Submission, Metadata, error) {
+	// Defining the SQL query for retrieving the submission records
+	query := `
+		SELECT count(*) OVER(), id, created_at, user_id, kind, movie_id, movie_version, title, year, runtime, genres,
+			status, reason, reviewed_by, reviewed_at, version
+		FROM movie_submissions
+		WHERE (status = $1 OR $1 = '')
+		AND (user_id = $2 OR $2 = 0)
+		ORDER BY id ASC
+		LIMIT $3 OFFSET $4`
+
+	// Creating a new context with a 3 second timeout
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	// Executing the query using the DB connection pool
+	rows, err := m.DB.QueryContext(ctx, query, status, userID, filters.limit(), filters.offset())
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+	defer rows.Close()
+
+	// Looping through the rows in the result set
+	totalRecords := 0
+	submissions := []*Submission{}
+	for rows.Next() {
+		var count int
+		submission, err := scanSubmission(rows, &count)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+
+		totalRecords = count
+		submissions = append(submissions, submission)
+	}
+
+	// Handling the errors encountered during the rows.Next() loop
+	if err = rows.Err(); err != nil {
+		return nil, Metadata{}, err
+	}
+
+	return submissions, calculateMetadata(totalRecords, filters.Page, filters.PageSize), nil
+}
+
+// Record the review of a pending submission, as long as it didn't change since it was read
+func (m SubmissionModel) Review(submission *Submission) error {
+	// Creating a new context with a 3 second timeout
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	// Executing the query using the DB connection pool
+	return reviewSubmission(ctx, m.DB, submission)
+}
+
+// Approve a pending submission, creating or updating the movie along with recording the review
+// Both happen in one transaction, which locks the submission first, so that two moderators approving it at
+// once can't both apply it, and the movie is never changed while the submission stays pending
+func (m SubmissionModel) Approve(submission *Submission, movie *Movie) error {
+	// Creating a new context with a 3 second timeout
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	// Starting the transaction, which is rolled back unless it is committed below
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// Locking the submission, and checking that it is still pending and unchanged since it was read
+	var status string
+	var version int32
+	err = tx.QueryRowContext(ctx, `
+		SELECT status, version
+		FROM movie_submissions
+		WHERE id = $1
+		FOR UPDATE`, submission.ID).Scan(&status, &version)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrRecordNotFound
+		default:
+			return err
+		}
+	}
+	if status != SubmissionPending || version != submission.Version {
+		return ErrEditConflict
+	}
+
+	// Applying the submission to the movie
+	if submission.Kind == SubmissionEdit {
+		err = updateMovie(ctx, tx, movie)
+	} else {
+		err = insertMovie(ctx, tx, movie)
+	}
+	if err != nil {
+		return err
+	}
+
+	// Recording the approval
+	submission.Status = SubmissionApproved
+	submission.MovieID = &movie.ID
+	err = reviewSubmission(ctx, tx, submission)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// Record the review of a pending submission using the given connection pool or transaction
+func reviewSubmission(ctx context.Context, db dbtx, submission *Submission) error {
+	// Defining the SQL query for updating the submission record
+	query := `
+		UPDATE movie_submissions
+		SET status = $1, reason = $2, reviewed_by = $3, reviewed_at = now(), movie_id = $4, version = version + 1
+		WHERE id = $5 AND version = $6 AND status = 'pending'
+		RETURNING reviewed_at, version`
+
+	// Creating an args slice to store the values for the placeholder parameters
+	args := []any{
+		submission.Status,
+		submission.Reason,
+		submission.ReviewedBy,
+		submission.MovieID,
+		submission.ID,
+		submission.Version,
+	}
+
+	// Executing the query
+	err := db.QueryRowContext(ctx, query, args...).Scan(&submission.ReviewedAt, &submission.Version)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrEditConflict
+		default:
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Scan a submission record from a row holding its columns in the order used by the queries above
+// Any leading columns, such as the total count, are scanned into prefix
+func scanSubmission(row interface{ Scan(dest ...any) error }, prefix ...any) (*Submission, error) {
+	var submission Submission
+
+	dest := append(prefix,
+		&submission.ID,
+		&submission.CreatedAt,
+		&submission.UserID,
+		&submission.Kind,
+		&submission.MovieID,
+		&submission.MovieVersion,
+		&submission.Title,
+		&submission.Year,
+		&submission.Runtime,
+		pq.Array(&submission.Genres),
+		&submission.Status,
+		&submission.Reason,
+		&submission.ReviewedBy,
+		&submission.ReviewedAt,
+		&submission.Version,
+	)
+
+	err := row.Scan(dest...)
+	if err != nil {
+		return nil, err
+	}
+
+	return &submission, nil
+}
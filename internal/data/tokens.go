@@ -12,9 +12,11 @@ import (
 )
 
 // Define the different scopes of the token (what it can access)
+// WebSocket tickets are short lived and single use, see UserModel.ConsumeToken
 const (
 	ScopeActivation     = "activation"
 	ScopeAuthentication = "authentication"
+	ScopeWebSocket      = "websocket"
 )
 
 // Defining the token struct to hold the details of the token
@@ -81,6 +83,51 @@ func (m TokenModel) New(userID int64, ttl time.Duration, scope string) (*Token,
 	return token, err
 }
 
+// Method for replacing the tokens of a user with a specific scope by a new token
+// The earlier tokens are revoked in the same transaction, so that only the latest one sent to the user is valid
+func (m TokenModel) Replace(ctx context.Context, userID int64, ttl time.Duration, scope string) (*Token, error) {
+	// Generating a new token for the user
+	token, err := generateToken(userID, ttl, scope)
+	if err != nil {
+		return nil, err
+	}
+
+	// Creating a context with a 3 second timeout, within the given one
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	// Starting the transaction, which is rolled back unless it is committed below
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	// Deleting the earlier tokens of the user with the scope
+	_, err = tx.ExecContext(ctx, `
+	DELETE FROM tokens
+	WHERE scope = $1 AND user_id = $2`, scope, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	// Inserting the new token
+	_, err = tx.ExecContext(ctx, `
+	INSERT INTO tokens (hash, user_id, expiry, scope)
+	VALUES ($1, $2, $3, $4)`, token.Hash, token.UserID, token.Expiry, token.Scope)
+	if err != nil {
+		return nil, err
+	}
+
+	// Committing the transaction
+	err = tx.Commit()
+	if err != nil {
+		return nil, err
+	}
+
+	return token, nil
+}
+
 // Method for inserting a token into the database
 func (m TokenModel) Insert(token *Token) error {
 	// Defining the SQL query for inserting a new token
@@ -115,3 +162,24 @@ func (m TokenModel) DeleteAllForUser(scope string, userID int64) error {
 	_, err := m.DB.ExecContext(ctx, query, scope, userID)
 	return err
 }
+
+// Delete the tokens of every scope which have expired, returning how many were deleted
+// Most tokens are deleted once used, this catches the ones which never were, like unused presence tickets
+func (m TokenModel) DeleteExpired() (int64, error) {
+	// Defining the SQL query for deleting the expired tokens
+	query := `
+	DELETE FROM tokens
+	WHERE expiry < $1`
+
+	// Creating a context with a 3 second timeout
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	// Executing the query using the DB connection pool
+	result, err := m.DB.ExecContext(ctx, query, time.Now())
+	if err != nil {
+		return 0, err
+	}
+
+	return result.RowsAffected()
+}
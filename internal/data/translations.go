@@ -0,0 +1,207 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+	"moviego.madhav.net/internal/validator"
+)
+
+// MovieTranslation struct which holds the localized title and synopsis of a movie in one language
+type MovieTranslation struct {
+	MovieID  int64  `json:"-"`
+	Language string `json:"language"`
+	Title    string `json:"title"`
+	Synopsis string `json:"synopsis,omitempty"`
+}
+
+// Normalize a language tag to the form it is stored in, such as "pt-BR"
+func NormalizeLanguage(tag string) string {
+	language, region, found := strings.Cut(strings.TrimSpace(tag), "-")
+	if !found {
+		return strings.ToLower(language)
+	}
+	return strings.ToLower(language) + "-" + strings.ToUpper(region)
+}
+
+// Validate method which validates the translation struct
+func ValidateTranslation(v *validator.Validator, translation *MovieTranslation) {
+	v.Check(validator.Matches(translation.Language, validator.LanguageRX), "language", "must be a valid language tag")
+
+	v.Check(translation.Title != "", "title", "must be provided")
+	v.Check(len(translation.Title) <= 500, "title", "must not be more than 500 bytes long")
+
+	v.Check(len(translation.Synopsis) <= 5000, "synopsis", "must not be more than 5000 bytes long")
+}
+
+// Localize the title and synopsis of the movie to the first of the given languages it has a translation for
+// A language also matches the translation of its base language, so "pt-BR" falls back to "pt"
+// The original title is kept when none of the languages match
+func (movie *Movie) Localize(languages []string) {
+	for _, language := range languages {
+		candidates := []string{language}
+		if base, _, found := strings.Cut(language, "-"); found {
+			candidates = append(candidates, base)
+		}
+
+		for _, candidate := range candidates {
+			translation, ok := movie.Translations[candidate]
+			if !ok {
+				continue
+			}
+
+			movie.Language = translation.Language
+			movie.Title = &translation.Title
+			if translation.Synopsis != "" {
+				movie.Synopsis = &translation.Synopsis
+			}
+			return
+		}
+	}
+}
+
+// Defining the TranslationModel struct to hold the database connection pool
+type TranslationModel struct {
+	DB *sql.DB
+}
+
+// Insert or replace the translation of a movie in the language of the translation
+// The movie is published as updated in the same transaction
+func (m TranslationModel) Upsert(translation *MovieTranslation) error {
+	// Defining the SQL query for upserting the record, which only inserts for movies outside the trash
+	query := `
+		INSERT INTO movie_translations (movie_id, language, title, synopsis)
+		SELECT id, $2, $3, $4
+		FROM movies
+		WHERE id = $1 AND deleted_at IS NULL
+		ON CONFLICT (movie_id, language) DO UPDATE
+		SET title = EXCLUDED.title, synopsis = EXCLUDED.synopsis
+		RETURNING movie_id`
+
+	// Creating an args slice to store the values for the placeholder parameters
+	args := []any{translation.MovieID, translation.Language, translation.Title, translation.Synopsis}
+
+	// Creating a new context with a 3 second timeout
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	// Starting a transaction, so that the movie is published along with the change
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// Executing the query within the transaction
+	err = tx.QueryRowContext(ctx, query, args...).Scan(&translation.MovieID)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrRecordNotFound
+		default:
+			return err
+		}
+	}
+
+	// Publishing the movie, whose translations are part of it
+	err = touchMovie(ctx, tx, translation.MovieID)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// Delete the translation of a movie in the given language
+// The movie is published as updated in the same transaction
+func (m TranslationModel) Delete(movieID int64, language string) error {
+	// Validating the id parameter
+	if movieID < 1 {
+		return ErrRecordNotFound
+	}
+
+	// Defining the SQL query for deleting the translation record
+	query := `
+		DELETE FROM movie_translations
+		WHERE movie_id = $1 AND language = $2`
+
+	// Creating a new context with a 3 second timeout
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	// Starting a transaction, so that the movie is published along with the change
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// Executing the query within the transaction
+	result, err := tx.ExecContext(ctx, query, movieID, language)
+	if err != nil {
+		return err
+	}
+
+	// Checking if the translation record was found
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+
+	// Publishing the movie, whose translations are part of it
+	err = touchMovie(ctx, tx, movieID)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// Attach the translations of each of the given movies, keyed by language
+func attachTranslations(ctx context.Context, db dbtx, movies ...*Movie) error {
+	if len(movies) == 0 {
+		return nil
+	}
+
+	// Indexing the movies by id
+	ids := make([]int64, len(movies))
+	byID := make(map[int64]*Movie, len(movies))
+	for i, movie := range movies {
+		ids[i] = movie.ID
+		byID[movie.ID] = movie
+		movie.Translations = map[string]*MovieTranslation{}
+	}
+
+	// Defining the SQL query for retrieving the translations of all the movies at once
+	query := `
+		SELECT movie_id, language, title, synopsis
+		FROM movie_translations
+		WHERE movie_id = ANY($1)`
+
+	rows, err := db.QueryContext(ctx, query, pq.Array(ids))
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	// Looping through the rows and adding each translation to its movie
+	for rows.Next() {
+		var translation MovieTranslation
+
+		err := rows.Scan(&translation.MovieID, &translation.Language, &translation.Title, &translation.Synopsis)
+		if err != nil {
+			return err
+		}
+
+		byID[translation.MovieID].Translations[translation.Language] = &translation
+	}
+
+	return rows.Err()
+}
@@ -110,21 +110,66 @@ type UserModel struct {
 
 // Insert a new user record into the users table
 func (m UserModel) Insert(user *User) error {
+	// Creating a new context with a 3 second timeout
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	// Executing the query using the DB connection pool
+	return insertUser(ctx, m.DB, user)
+}
+
+// Register a new user, adding their permissions and queuing the jobs which follow a registration
+// Everything happens in one transaction, so that a user is never left behind without their jobs
+// The jobs are built by the given function, once the user has its id
+func (m UserModel) Register(user *User, permissions []string, jobs func(user *User) ([]*Job, error)) error {
+	// Creating a new context with a 3 second timeout
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	// Starting the transaction, which is rolled back unless it is committed below
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	err = insertUser(ctx, tx, user)
+	if err != nil {
+		return err
+	}
+
+	err = addPermissionsForUser(ctx, tx, user.ID, permissions...)
+	if err != nil {
+		return err
+	}
+
+	queued, err := jobs(user)
+	if err != nil {
+		return err
+	}
+	for _, job := range queued {
+		_, err = insertJob(ctx, tx, job)
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// Insert a new user record using the given connection pool or transaction
+func insertUser(ctx context.Context, db dbtx, user *User) error {
 	// Defining the SQL query for inserting a new record
 	query := `
 	INSERT INTO users (name, email, password_hash, activated)
 	VALUES ($1, $2, $3, $4)
 	RETURNING id, created_at, version`
 
-	// Creating a new context with a 3 second timeout
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
-	defer cancel()
-
 	// Creating an args slice to hold the values for the placeholder parameters
 	args := []any{user.Name, user.Email, user.Password.hash, user.Activated}
 
 	// Executing the query and storing the result in a new row
-	err := m.DB.QueryRowContext(ctx, query, args...).Scan(&user.ID, &user.CreatedAt, &user.Version)
+	err := db.QueryRowContext(ctx, query, args...).Scan(&user.ID, &user.CreatedAt, &user.Version)
 	if err != nil {
 		switch {
 		// If there is a duplicate key error, return the ErrDuplicateEmail custom error
@@ -174,6 +219,47 @@ func (m UserModel) GetByEmail(email string) (*User, error) {
 	return &user, nil
 }
 
+// Get a specific user record based on the user id
+func (m UserModel) Get(id int64) (*User, error) {
+	return m.GetContext(context.Background(), id)
+}
+
+// Retrieve a specific user record based on the user id, giving up once the given context is done
+func (m UserModel) GetContext(ctx context.Context, id int64) (*User, error) {
+	// Defining the SQL query for retrieving the user record
+	query := `
+	SELECT id, created_at, name, email, password_hash, activated, version
+	FROM users
+	WHERE id = $1`
+
+	// Creating a new context with a 3 second timeout
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	// Executing the query and storing the result in a new user struct
+	var user User
+	err := m.DB.QueryRowContext(ctx, query, id).Scan(
+		&user.ID,
+		&user.CreatedAt,
+		&user.Name,
+		&user.Email,
+		&user.Password.hash,
+		&user.Activated,
+		&user.Version,
+	)
+	if err != nil {
+		switch {
+		// If there is no matching record, return the ErrRecordNotFound custom error
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return &user, nil
+}
+
 // Update an existing user record in the users table
 func (m UserModel) Update(user *User) error {
 	// Defining the SQL query for updating the user record
@@ -214,6 +300,54 @@ func (m UserModel) Update(user *User) error {
 	return nil
 }
 
+// Activate the user, as long as it didn't change since it was read
+// The activation tokens of the user are deleted and the user.activated event is published in the same transaction
+func (m UserModel) Activate(user *User) error {
+	// Defining the SQL query for activating the user record
+	query := `
+	UPDATE users
+	SET activated = true, version = version + 1
+	WHERE id = $1 AND version = $2
+	RETURNING version`
+
+	// Creating a new context with a 3 second timeout
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	// Starting the transaction, which is rolled back unless it is committed below
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// Executing the query within the transaction
+	err = tx.QueryRowContext(ctx, query, user.ID, user.Version).Scan(&user.Version)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrEditConflict
+		default:
+			return err
+		}
+	}
+	user.Activated = true
+
+	// Deleting all the activation tokens of the user, which are of no use anymore
+	_, err = tx.ExecContext(ctx, `DELETE FROM tokens WHERE scope = $1 AND user_id = $2`, ScopeActivation, user.ID)
+	if err != nil {
+		return err
+	}
+
+	// Telling the webhooks about the activation
+	err = publishEvent(ctx, tx, EventUserActivated, map[string]any{"user": user})
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
 // Retrieving a user record based on the token hash and scope from the tokens table
 func (m UserModel) GetForToken(tokenScope, tokenPlaintext string) (*User, error) {
 	// Calculating the hashed version of the plaintext token
@@ -258,3 +392,53 @@ func (m UserModel) GetForToken(tokenScope, tokenPlaintext string) (*User, error)
 	// Returning the user struct
 	return &user, nil
 }
+
+// Retrieve the user of a single use token based on the token and the scope, deleting the token
+// The token is consumed by the same statement, so that it can't be used twice even by concurrent requests
+func (m UserModel) ConsumeToken(tokenScope, tokenPlaintext string) (*User, error) {
+	// Calculating the hashed version of the plaintext token
+	tokenHash := sha256.Sum256([]byte(tokenPlaintext))
+
+	// Defining the SQL query for deleting the token and retrieving the user record it belonged to
+	query := `
+	WITH consumed AS (
+		DELETE FROM tokens
+		WHERE hash = $1 AND scope = $2 AND expiry > $3
+		RETURNING user_id
+	)
+	SELECT users.id, users.created_at, users.name, users.email, users.password_hash, users.activated, users.version
+	FROM users
+	INNER JOIN consumed
+	ON users.id = consumed.user_id`
+
+	// Creating an args slice to hold the values for the placeholder parameters
+	args := []any{tokenHash[:], tokenScope, time.Now()}
+
+	// Creating a new context with a 3 second timeout
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	// Executing the query and storing the result in a new user struct
+	var user User
+	err := m.DB.QueryRowContext(ctx, query, args...).Scan(
+		&user.ID,
+		&user.CreatedAt,
+		&user.Name,
+		&user.Email,
+		&user.Password.hash,
+		&user.Activated,
+		&user.Version,
+	)
+	if err != nil {
+		switch {
+		// If there is no matching record, return the ErrRecordNotFound custom error
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	// Returning the user struct
+	return &user, nil
+}
@@ -0,0 +1,209 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/lib/pq"
+	"moviego.madhav.net/internal/validator"
+)
+
+// WatchEvent struct which holds a viewing of a movie by a user
+type WatchEvent struct {
+	ID        int64     `json:"id"`
+	UserID    int64     `json:"-"`
+	MovieID   int64     `json:"movie_id"`
+	Movie     *Movie    `json:"movie,omitempty"` // Movie which was watched, set when listing the history
+	WatchedAt time.Time `json:"watched_at"`
+	Progress  int32     `json:"progress"` // Minutes of the movie which were watched
+	Completed bool      `json:"completed"`
+}
+
+// Validate method which validates the watch event against the runtime of the movie
+func ValidateWatchEvent(v *validator.Validator, event *WatchEvent, movie *Movie) {
+	v.Check(event.Progress >= 0, "progress", "must not be negative")
+	v.Check(event.Progress <= *movie.Runtime, "progress", "must not be more than the runtime of the movie")
+
+	v.Check(!event.WatchedAt.After(time.Now()), "watched_at", "must not be in the future")
+}
+
+// WatchSummary struct which holds the viewing statistics of a user for one year
+type WatchSummary struct {
+	Year          int          `json:"year"`
+	TotalMinutes  int64        `json:"total_minutes"`
+	Events        int64        `json:"events"`
+	MoviesWatched int64        `json:"movies_watched"`
+	Completed     int64        `json:"completed"`
+	TopGenres     []GenreCount `json:"top_genres"`
+}
+
+// GenreCount struct which holds the minutes watched of a genre
+type GenreCount struct {
+	Genre   string `json:"genre"`
+	Minutes int64  `json:"minutes"`
+}
+
+// Defining the WatchEventModel struct to hold the database connection pool
+type WatchEventModel struct {
+	DB *sql.DB
+}
+
+// Insert a new watch event into the watch_events table, which fails for movies in the trash
+// The event counts as completed when the whole runtime of the movie was watched
+func (m WatchEventModel) Insert(event *WatchEvent) error {
+	// Defining the SQL query for inserting a new record
+	query := `
+		INSERT INTO watch_events (user_id, movie_id, watched_at, progress, completed)
+		SELECT $1, id, $3, $4, $4 >= runtime
+		FROM movies
+		WHERE id = $2 AND deleted_at IS NULL
+		RETURNING id, completed`
+
+	// Creating an args slice to store the values for the placeholder parameters
+	args := []any{event.UserID, event.MovieID, event.WatchedAt, event.Progress}
+
+	// Creating a new context with a 3 second timeout
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	// Executing the query using the DB connection pool
+	err := m.DB.QueryRowContext(ctx, query, args...).Scan(&event.ID, &event.Completed)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrRecordNotFound
+		default:
+			return err
+		}
+	}
+
+	return nil
+}
+
+// List the watch events of a user, most recent first
+// The from and to bounds are inclusive, and are ignored when they are nil
+func (m WatchEventModel) GetForUser(userID int64, from, to *time.Time, filters Filters) ([]*WatchEvent, Metadata, error) {
+	// Defining the SQL query for retrieving the watch events along with their movies
+	query := `
+		SELECT count(*) OVER(), e.id, e.movie_id, e.watched_at, e.progress, e.completed,
+			m.id, m.created_at, m.title, m.year, m.runtime, m.genres, m.version
+		FROM watch_events e
+		INNER JOIN movies m ON m.id = e.movie_id
+		WHERE e.user_id = $1
+		AND ($2::timestamptz IS NULL OR e.watched_at >= $2)
+		AND ($3::timestamptz IS NULL OR e.watched_at <= $3)
+		ORDER BY e.watched_at DESC, e.id DESC
+		LIMIT $4 OFFSET $5`
+
+	// Creating a new context with a 3 second timeout
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	// Executing the query using the DB connection pool
+	rows, err := m.DB.QueryContext(ctx, query, userID, from, to, filters.limit(), filters.offset())
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+	defer rows.Close()
+
+	// Looping through the rows in the result set
+	totalRecords := 0
+	events := []*WatchEvent{}
+	for rows.Next() {
+		var event WatchEvent
+		event.Movie = &Movie{}
+
+		err := rows.Scan(
+			&totalRecords,
+			&event.ID,
+			&event.MovieID,
+			&event.WatchedAt,
+			&event.Progress,
+			&event.Completed,
+			&event.Movie.ID,
+			&event.Movie.CreatedAt,
+			&event.Movie.Title,
+			&event.Movie.Year,
+			&event.Movie.Runtime,
+			pq.Array(&event.Movie.Genres),
+			&event.Movie.Version,
+		)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+
+		events = append(events, &event)
+	}
+
+	// Handling the errors encountered during the rows.Next() loop
+	if err = rows.Err(); err != nil {
+		return nil, Metadata{}, err
+	}
+
+	return events, calculateMetadata(totalRecords, filters.Page, filters.PageSize), nil
+}
+
+// Summarize the viewing of a user in the given calendar year, in UTC
+// The top genres are the five genres with the most minutes watched
+func (m WatchEventModel) GetSummary(userID int64, year int) (*WatchSummary, error) {
+	summary := &WatchSummary{Year: year, TopGenres: []GenreCount{}}
+
+	from := time.Date(year, time.January, 1, 0, 0, 0, 0, time.UTC)
+	to := from.AddDate(1, 0, 0)
+
+	// Creating a new context with a 3 second timeout
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	// Defining the SQL query for the totals of the year
+	query := `
+		SELECT coalesce(sum(progress), 0), count(*), count(DISTINCT movie_id), count(*) FILTER (WHERE completed)
+		FROM watch_events
+		WHERE user_id = $1 AND watched_at >= $2 AND watched_at < $3`
+
+	err := m.DB.QueryRowContext(ctx, query, userID, from, to).Scan(
+		&summary.TotalMinutes,
+		&summary.Events,
+		&summary.MoviesWatched,
+		&summary.Completed,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	// Defining the SQL query for the minutes watched of each genre
+	query = `
+		SELECT genre, sum(e.progress) AS minutes
+		FROM watch_events e
+		INNER JOIN movies m ON m.id = e.movie_id, unnest(m.genres) AS genre
+		WHERE e.user_id = $1 AND e.watched_at >= $2 AND e.watched_at < $3
+		GROUP BY genre
+		ORDER BY minutes DESC, genre ASC
+		LIMIT 5`
+
+	rows, err := m.DB.QueryContext(ctx, query, userID, from, to)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var count GenreCount
+
+		err := rows.Scan(&count.Genre, &count.Minutes)
+		if err != nil {
+			return nil, err
+		}
+
+		summary.TopGenres = append(summary.TopGenres, count)
+	}
+
+	// Handling the errors encountered during the rows.Next() loop
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return summary, nil
+}
@@ -0,0 +1,511 @@
+package data
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+	"moviego.madhav.net/internal/validator"
+)
+
+// Define the events webhooks can subscribe to
+const (
+	EventMovieCreated  = "movie.created"
+	EventMovieUpdated  = "movie.updated"
+	EventMovieDeleted  = "movie.deleted"
+	EventMovieRestored = "movie.restored"
+	EventUserActivated = "user.activated"
+)
+
+// WebhookEvents lists every event webhooks can subscribe to
+var WebhookEvents = []string{
+	EventMovieCreated,
+	EventMovieUpdated,
+	EventMovieDeleted,
+	EventMovieRestored,
+	EventUserActivated,
+}
+
+// Define the statuses a delivery goes through
+// A delivery stays pending while it is retried, and fails once it runs out of attempts
+const (
+	DeliveryPending   = "pending"
+	DeliverySucceeded = "succeeded"
+	DeliveryFailed    = "failed"
+)
+
+// Webhook struct which holds a subscription of a receiver to some of the events
+// The secret is only shown when the webhook is created
+type Webhook struct {
+	ID        int64     `json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+	URL       string    `json:"url"`
+	Events    []string  `json:"events"`
+	Secret    string    `json:"secret,omitempty"`
+	Active    bool      `json:"active"`
+	Version   int32     `json:"version"`
+}
+
+// WebhookDelivery struct which holds an event queued for, or sent to, the receiver of a webhook
+type WebhookDelivery struct {
+	ID             int64           `json:"id"`
+	CreatedAt      time.Time       `json:"created_at"`
+	WebhookID      int64           `json:"webhook_id"`
+	Event          string          `json:"event"`
+	Payload        json.RawMessage `json:"payload"`
+	Status         string          `json:"status"`
+	Attempts       int             `json:"attempts"`
+	NextAttemptAt  *time.Time      `json:"next_attempt_at,omitempty"`
+	ResponseStatus *int            `json:"response_status,omitempty"` // Status code of the last response, if one was received
+	LastError      string          `json:"last_error,omitempty"`
+	DeliveredAt    *time.Time      `json:"delivered_at,omitempty"`
+	URL            string          `json:"-"` // Target and secret of the webhook, set when the delivery is claimed
+	Secret         string          `json:"-"`
+}
+
+// Validate method which validates the webhook struct
+func ValidateWebhook(v *validator.Validator, webhook *Webhook) {
+	u, err := url.Parse(webhook.URL)
+	v.Check(webhook.URL != "", "url", "must be provided")
+	v.Check(err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != "", "url", "must be an absolute http or https URL")
+	v.Check(len(webhook.URL) <= 2000, "url", "must not be more than 2000 bytes long")
+
+	v.Check(len(webhook.Events) > 0, "events", "must contain at least 1 event")
+	v.Check(validator.Unique(webhook.Events), "events", "must not contain duplicate values")
+	for _, event := range webhook.Events {
+		v.Check(validator.In(event, WebhookEvents...), "events", "must only contain known events")
+	}
+
+	// The secret is left empty on updates which keep the current one
+	if webhook.Secret != "" {
+		v.Check(len(webhook.Secret) >= 16, "secret", "must be at least 16 bytes long")
+		v.Check(len(webhook.Secret) <= 256, "secret", "must not be more than 256 bytes long")
+	}
+}
+
+// Generate a random secret for a webhook created without one
+func GenerateWebhookSecret() (string, error) {
+	b := make([]byte, 32)
+	_, err := rand.Read(b)
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// Defining the WebhookModel struct to hold the database connection pool
+type WebhookModel struct {
+	DB *sql.DB
+}
+
+// Insert a new webhook into the webhooks table
+func (m WebhookModel) Insert(webhook *Webhook) error {
+	// Defining the SQL query for inserting a new record
+	query := `
+		INSERT INTO webhooks (url, events, secret, active)
+		VALUES ($1, $2, $3, $4)
+		RETURNING id, created_at, version`
+
+	// Creating an args slice to store the values for the placeholder parameters
+	args := []any{webhook.URL, pq.Array(webhook.Events), webhook.Secret, webhook.Active}
+
+	// Creating a new context with a 3 second timeout
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	// Executing the query using the DB connection pool
+	return m.DB.QueryRowContext(ctx, query, args...).Scan(&webhook.ID, &webhook.CreatedAt, &webhook.Version)
+}
+
+// Get a specific webhook based on its id, without its secret
+func (m WebhookModel) Get(id int64) (*Webhook, error) {
+	// Validating the id parameter
+	if id < 1 {
+		return nil, ErrRecordNotFound
+	}
+
+	// Defining the SQL query for retrieving the webhook record
+	query := `
+		SELECT id, created_at, url, events, active, version
+		FROM webhooks
+		WHERE id = $1`
+
+	// Creating a new context with a 3 second timeout
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	// Executing the query using the DB connection pool
+	var webhook Webhook
+	err := m.DB.QueryRowContext(ctx, query, id).Scan(
+		&webhook.ID,
+		&webhook.CreatedAt,
+		&webhook.URL,
+		pq.Array(&webhook.Events),
+		&webhook.Active,
+		&webhook.Version,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return &webhook, nil
+}
+
+// List every webhook, without their secrets
+func (m WebhookModel) GetAll(filters Filters) ([]*Webhook, Metadata, error) {
+	// Defining the SQL query for retrieving the webhook records
+	query := `
+		SELECT count(*) OVER(), id, created_at, url, events, active, version
+		FROM webhooks
+		ORDER BY id ASC
+		LIMIT $1 OFFSET $2`
+
+	// Creating a new context with a 3 second timeout
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	// Executing the query using the DB connection pool
+	rows, err := m.DB.QueryContext(ctx, query, filters.limit(), filters.offset())
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+	defer rows.Close()
+
+	// Looping through the rows in the result set
+	totalRecords := 0
+	webhooks := []*Webhook{}
+	for rows.Next() {
+		var webhook Webhook
+
+		err := rows.Scan(
+			&totalRecords,
+			&webhook.ID,
+			&webhook.CreatedAt,
+			&webhook.URL,
+			pq.Array(&webhook.Events),
+			&webhook.Active,
+			&webhook.Version,
+		)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+
+		webhooks = append(webhooks, &webhook)
+	}
+
+	// Handling the errors encountered during the rows.Next() loop
+	if err = rows.Err(); err != nil {
+		return nil, Metadata{}, err
+	}
+
+	return webhooks, calculateMetadata(totalRecords, filters.Page, filters.PageSize), nil
+}
+
+// Update a webhook, as long as it didn't change since it was read
+// The secret is only replaced when a new one is given
+func (m WebhookModel) Update(webhook *Webhook) error {
+	// Defining the SQL query for updating the webhook record
+	query := `
+		UPDATE webhooks
+		SET url = $1, events = $2, active = $3, secret = coalesce(nullif($4, ''), secret), version = version + 1
+		WHERE id = $5 AND version = $6
+		RETURNING version`
+
+	// Creating an args slice to store the values for the placeholder parameters
+	args := []any{
+		webhook.URL,
+		pq.Array(webhook.Events),
+		webhook.Active,
+		webhook.Secret,
+		webhook.ID,
+		webhook.Version,
+	}
+
+	// Creating a new context with a 3 second timeout
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	// Executing the query using the DB connection pool
+	err := m.DB.QueryRowContext(ctx, query, args...).Scan(&webhook.Version)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrEditConflict
+		default:
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Delete a webhook along with its deliveries
+func (m WebhookModel) Delete(id int64) error {
+	// Validating the id parameter
+	if id < 1 {
+		return ErrRecordNotFound
+	}
+
+	// Defining the SQL query for deleting the webhook record
+	query := `
+		DELETE FROM webhooks
+		WHERE id = $1`
+
+	// Creating a new context with a 3 second timeout
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	// Executing the query using the DB connection pool
+	result, err := m.DB.ExecContext(ctx, query, id)
+	if err != nil {
+		return err
+	}
+
+	// Checking if the webhook record was found
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+
+	return nil
+}
+
+// Defining the WebhookDeliveryModel struct to hold the database connection pool
+type WebhookDeliveryModel struct {
+	DB *sql.DB
+}
+
+// Publish an event using the given transaction
+// The event is queued for every webhook subscribed to it, and changes to movies are added to the movie event log
+// Every write publishes its events in its own transaction, so that an event is queued if and only if
+// the change it describes commits (an outbox), rather than being lost when the process dies in between
+func publishEvent(ctx context.Context, db dbtx, event string, details map[string]any) error {
+	payload, err := json.Marshal(map[string]any{
+		"event":       event,
+		"occurred_at": time.Now().UTC(),
+		"data":        details,
+	})
+	if err != nil {
+		return err
+	}
+
+	// Defining the SQL query for inserting a delivery for each subscribed webhook
+	query := `
+		INSERT INTO webhook_deliveries (webhook_id, event, payload)
+		SELECT id, $1, $2
+		FROM webhooks
+		WHERE active AND $1 = ANY(events)`
+
+	// Executing the query
+	_, err = db.ExecContext(ctx, query, event, payload)
+	if err != nil {
+		return err
+	}
+
+	if strings.HasPrefix(event, "movie.") {
+		return insertMovieEvent(ctx, db, &MovieEvent{Event: event, Payload: payload})
+	}
+
+	return nil
+}
+
+// Claim up to limit pending deliveries which are due, along with the URL and secret of their webhook
+// The attempt is counted and the next one is pushed back by the lease, so that a delivery claimed by a
+// worker which crashed is retried once the lease runs out, and other workers skip the claimed rows
+// Deliveries of inactive webhooks wait until their webhook is active again
+func (m WebhookDeliveryModel) Claim(limit int, lease time.Duration) ([]*WebhookDelivery, error) {
+	// Defining the SQL query for claiming the deliveries
+	query := `
+		UPDATE webhook_deliveries d
+		SET attempts = d.attempts + 1, next_attempt_at = now() + make_interval(secs => $2)
+		FROM webhooks w
+		WHERE w.id = d.webhook_id
+		AND d.id IN (
+			SELECT id FROM webhook_deliveries
+			WHERE status = 'pending' AND next_attempt_at <= now()
+			AND webhook_id IN (SELECT id FROM webhooks WHERE active)
+			ORDER BY next_attempt_at ASC
+			LIMIT $1
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING d.id, d.created_at, d.webhook_id, d.event, d.payload, d.status, d.attempts, w.url, w.secret`
+
+	// Creating a new context with a 3 second timeout
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	// Executing the query using the DB connection pool
+	rows, err := m.DB.QueryContext(ctx, query, limit, lease.Seconds())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	// Looping through the rows in the result set
+	deliveries := []*WebhookDelivery{}
+	for rows.Next() {
+		var delivery WebhookDelivery
+
+		err := rows.Scan(
+			&delivery.ID,
+			&delivery.CreatedAt,
+			&delivery.WebhookID,
+			&delivery.Event,
+			&delivery.Payload,
+			&delivery.Status,
+			&delivery.Attempts,
+			&delivery.URL,
+			&delivery.Secret,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		deliveries = append(deliveries, &delivery)
+	}
+
+	// Handling the errors encountered during the rows.Next() loop
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return deliveries, nil
+}
+
+// Record the outcome of an attempt, as set on the delivery by the caller
+func (m WebhookDeliveryModel) RecordAttempt(delivery *WebhookDelivery) error {
+	// Defining the SQL query for updating the delivery record
+	query := `
+		UPDATE webhook_deliveries
+		SET status = $1, next_attempt_at = $2, response_status = $3, last_error = $4, delivered_at = $5
+		WHERE id = $6`
+
+	// Creating an args slice to store the values for the placeholder parameters
+	args := []any{
+		delivery.Status,
+		delivery.NextAttemptAt,
+		delivery.ResponseStatus,
+		delivery.LastError,
+		delivery.DeliveredAt,
+		delivery.ID,
+	}
+
+	// Creating a new context with a 3 second timeout
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	// Executing the query using the DB connection pool
+	_, err := m.DB.ExecContext(ctx, query, args...)
+	return err
+}
+
+// List the deliveries of a webhook, most recent first, only the ones with the given status when it isn't empty
+func (m WebhookDeliveryModel) GetForWebhook(webhookID int64, status string, filters Filters) ([]*WebhookDelivery, Metadata, error) {
+	// Defining the SQL query for retrieving the delivery records
+	query := `
+		SELECT count(*) OVER(), id, created_at, webhook_id, event, payload, status, attempts,
+			CASE WHEN status = 'pending' THEN next_attempt_at END, response_status, last_error, delivered_at
+		FROM webhook_deliveries
+		WHERE webhook_id = $1
+		AND (status = $2 OR $2 = '')
+		ORDER BY id DESC
+		LIMIT $3 OFFSET $4`
+
+	// Creating a new context with a 3 second timeout
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	// Executing the query using the DB connection pool
+	rows, err := m.DB.QueryContext(ctx, query, webhookID, status, filters.limit(), filters.offset())
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+	defer rows.Close()
+
+	// Looping through the rows in the result set
+	totalRecords := 0
+	deliveries := []*WebhookDelivery{}
+	for rows.Next() {
+		var delivery WebhookDelivery
+
+		err := rows.Scan(
+			&totalRecords,
+			&delivery.ID,
+			&delivery.CreatedAt,
+			&delivery.WebhookID,
+			&delivery.Event,
+			&delivery.Payload,
+			&delivery.Status,
+			&delivery.Attempts,
+			&delivery.NextAttemptAt,
+			&delivery.ResponseStatus,
+			&delivery.LastError,
+			&delivery.DeliveredAt,
+		)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+
+		deliveries = append(deliveries, &delivery)
+	}
+
+	// Handling the errors encountered during the rows.Next() loop
+	if err = rows.Err(); err != nil {
+		return nil, Metadata{}, err
+	}
+
+	return deliveries, calculateMetadata(totalRecords, filters.Page, filters.PageSize), nil
+}
+
+// Queue a delivery of webhook again, as a new delivery carrying the same event and payload
+func (m WebhookDeliveryModel) Redeliver(webhookID, deliveryID int64) (*WebhookDelivery, error) {
+	// Defining the SQL query for copying the delivery
+	query := `
+		INSERT INTO webhook_deliveries (webhook_id, event, payload)
+		SELECT webhook_id, event, payload
+		FROM webhook_deliveries
+		WHERE id = $1 AND webhook_id = $2
+		RETURNING id, created_at, webhook_id, event, payload, status, attempts, next_attempt_at`
+
+	// Creating a new context with a 3 second timeout
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	// Executing the query using the DB connection pool
+	var delivery WebhookDelivery
+	err := m.DB.QueryRowContext(ctx, query, deliveryID, webhookID).Scan(
+		&delivery.ID,
+		&delivery.CreatedAt,
+		&delivery.WebhookID,
+		&delivery.Event,
+		&delivery.Payload,
+		&delivery.Status,
+		&delivery.Attempts,
+		&delivery.NextAttemptAt,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return &delivery, nil
+}
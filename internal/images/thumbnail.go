@@ -0,0 +1,147 @@
+package images
+
+import (
+	"image"
+	"image/color"
+)
+
+// Thumbnail scales the image down to the given width, keeping its aspect ratio
+// Every destination pixel is the area weighted average of the source pixels it covers (a box filter),
+// which keeps downscaled images smooth without any dependencies outside the standard library
+// Images which are already narrower than the width are returned unchanged
+func Thumbnail(src image.Image, width int) image.Image {
+	bounds := src.Bounds()
+	srcW, srcH := bounds.Dx(), bounds.Dy()
+	if width <= 0 || width >= srcW || srcH == 0 {
+		return src
+	}
+
+	// Calculating the height which keeps the aspect ratio, with at least one row
+	height := (srcH*width + srcW/2) / srcW
+	if height < 1 {
+		height = 1
+	}
+
+	dst := image.NewNRGBA(image.Rect(0, 0, width, height))
+	pixel := pixelReader(src)
+
+	// Size of the source area covered by each destination pixel
+	scaleX := float64(srcW) / float64(width)
+	scaleY := float64(srcH) / float64(height)
+
+	for y := 0; y < height; y++ {
+		y0 := float64(y) * scaleY
+		y1 := y0 + scaleY
+
+		for x := 0; x < width; x++ {
+			x0 := float64(x) * scaleX
+			x1 := x0 + scaleX
+
+			var r, g, b, a, total float64
+
+			// Accumulating every source pixel overlapping the area, weighted by the overlap
+			for sy := int(y0); float64(sy) < y1 && sy < srcH; sy++ {
+				wy := overlap(float64(sy), y0, y1)
+
+				for sx := int(x0); float64(sx) < x1 && sx < srcW; sx++ {
+					weight := wy * overlap(float64(sx), x0, x1)
+
+					// The channels are alpha premultiplied, which average correctly
+					pr, pg, pb, pa := pixel(bounds.Min.X+sx, bounds.Min.Y+sy)
+					r += float64(pr) * weight
+					g += float64(pg) * weight
+					b += float64(pb) * weight
+					a += float64(pa) * weight
+					total += weight
+				}
+			}
+
+			dst.SetNRGBA(x, y, toNRGBA(r/total, g/total, b/total, a/total))
+		}
+	}
+
+	return dst
+}
+
+// Return a function reading the alpha premultiplied 16 bit channels of a source pixel, like At().RGBA()
+// The image types the standard decoders produce are read straight from their pixel buffers, which avoids
+// going through the color.Color interface, and an allocation, for every pixel
+func pixelReader(src image.Image) func(x, y int) (r, g, b, a uint32) {
+	switch src := src.(type) {
+	case *image.RGBA:
+		return func(x, y int) (uint32, uint32, uint32, uint32) {
+			p := src.Pix[src.PixOffset(x, y):]
+			return uint32(p[0]) * 0x101, uint32(p[1]) * 0x101, uint32(p[2]) * 0x101, uint32(p[3]) * 0x101
+		}
+
+	case *image.NRGBA:
+		return func(x, y int) (uint32, uint32, uint32, uint32) {
+			p := src.Pix[src.PixOffset(x, y):]
+			return color.NRGBA{R: p[0], G: p[1], B: p[2], A: p[3]}.RGBA()
+		}
+
+	case *image.YCbCr:
+		return func(x, y int) (uint32, uint32, uint32, uint32) {
+			ci := src.COffset(x, y)
+			return color.YCbCr{Y: src.Y[src.YOffset(x, y)], Cb: src.Cb[ci], Cr: src.Cr[ci]}.RGBA()
+		}
+
+	case *image.Gray:
+		return func(x, y int) (uint32, uint32, uint32, uint32) {
+			v := uint32(src.Pix[src.PixOffset(x, y)]) * 0x101
+			return v, v, v, 0xffff
+		}
+
+	case *image.Paletted:
+		// Converting the palette once, rather than for every pixel
+		palette := make([][4]uint32, len(src.Palette))
+		for i, c := range src.Palette {
+			r, g, b, a := c.RGBA()
+			palette[i] = [4]uint32{r, g, b, a}
+		}
+
+		return func(x, y int) (uint32, uint32, uint32, uint32) {
+			i := int(src.Pix[src.PixOffset(x, y)])
+			if i >= len(palette) {
+				return 0, 0, 0, 0
+			}
+			c := palette[i]
+			return c[0], c[1], c[2], c[3]
+		}
+
+	default:
+		return func(x, y int) (uint32, uint32, uint32, uint32) {
+			return src.At(x, y).RGBA()
+		}
+	}
+}
+
+// Return how much of the unit pixel starting at p lies within [lo, hi)
+func overlap(p, lo, hi float64) float64 {
+	start, end := p, p+1
+	if lo > start {
+		start = lo
+	}
+	if hi < end {
+		end = hi
+	}
+	if end <= start {
+		return 0
+	}
+
+	return end - start
+}
+
+// Convert averaged 16 bit alpha premultiplied channels into a non premultiplied 8 bit color
+func toNRGBA(r, g, b, a float64) color.NRGBA {
+	if a == 0 {
+		return color.NRGBA{}
+	}
+
+	return color.NRGBA{
+		R: uint8(r / a * 255),
+		G: uint8(g / a * 255),
+		B: uint8(b / a * 255),
+		A: uint8(a / 257),
+	}
+}
@@ -0,0 +1,146 @@
+package images
+
+import (
+	"image"
+	"image/color"
+	"testing"
+)
+
+func TestThumbnailSize(t *testing.T) {
+	tests := []struct {
+		name       string
+		src        image.Rectangle
+		width      int
+		wantWidth  int
+		wantHeight int
+	}{
+		{name: "Halved", src: image.Rect(0, 0, 200, 100), width: 100, wantWidth: 100, wantHeight: 50},
+		{name: "Rounded height", src: image.Rect(0, 0, 300, 100), width: 200, wantWidth: 200, wantHeight: 67},
+		{name: "Portrait", src: image.Rect(0, 0, 100, 400), width: 25, wantWidth: 25, wantHeight: 100},
+		{name: "At least one row", src: image.Rect(0, 0, 1000, 1), width: 10, wantWidth: 10, wantHeight: 1},
+		{name: "Offset bounds", src: image.Rect(10, 20, 210, 120), width: 100, wantWidth: 100, wantHeight: 50},
+		{name: "Already narrower", src: image.Rect(0, 0, 50, 50), width: 100, wantWidth: 50, wantHeight: 50},
+		{name: "Same width", src: image.Rect(0, 0, 100, 50), width: 100, wantWidth: 100, wantHeight: 50},
+		{name: "Zero width", src: image.Rect(0, 0, 100, 50), width: 0, wantWidth: 100, wantHeight: 50},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := Thumbnail(image.NewRGBA(tt.src), tt.width).Bounds()
+			if got.Dx() != tt.wantWidth || got.Dy() != tt.wantHeight {
+				t.Errorf("got %dx%d; want %dx%d", got.Dx(), got.Dy(), tt.wantWidth, tt.wantHeight)
+			}
+		})
+	}
+}
+
+func TestThumbnailColors(t *testing.T) {
+	// Every kind of source image holds the same two columns, red on the left and blue on the right
+	red := color.NRGBA{R: 255, A: 255}
+	blue := color.NRGBA{B: 255, A: 255}
+	fill := func(set func(x, y int, c color.Color)) {
+		for y := 0; y < 4; y++ {
+			for x := 0; x < 4; x++ {
+				if x < 2 {
+					set(x, y, red)
+				} else {
+					set(x, y, blue)
+				}
+			}
+		}
+	}
+
+	rect := image.Rect(0, 0, 4, 4)
+	rgba := image.NewRGBA(rect)
+	fill(rgba.Set)
+	nrgba := image.NewNRGBA(rect)
+	fill(nrgba.Set)
+	paletted := image.NewPaletted(rect, color.Palette{red, blue})
+	fill(paletted.Set)
+
+	tests := []struct {
+		name string
+		src  image.Image
+		want []color.NRGBA // Colors of the thumbnail, left to right
+	}{
+		{name: "RGBA", src: rgba, want: []color.NRGBA{red, blue}},
+		{name: "NRGBA", src: nrgba, want: []color.NRGBA{red, blue}},
+		{name: "Paletted", src: paletted, want: []color.NRGBA{red, blue}},
+		{name: "Averaged", src: rgba, want: []color.NRGBA{{R: 127, B: 127, A: 255}}},
+		{name: "Gray", src: grayImage(rect, 200), want: []color.NRGBA{{R: 200, G: 200, B: 200, A: 255}, {R: 200, G: 200, B: 200, A: 255}}},
+		{name: "Transparent", src: image.NewNRGBA(rect), want: []color.NRGBA{{}, {}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dst := Thumbnail(tt.src, len(tt.want))
+
+			for x, want := range tt.want {
+				got := color.NRGBAModel.Convert(dst.At(x, 0)).(color.NRGBA)
+				if got != want {
+					t.Errorf("got %+v at column %d; want %+v", got, x, want)
+				}
+			}
+		})
+	}
+}
+
+func TestPixelReader(t *testing.T) {
+	// The fast paths must read the same values as At().RGBA() does
+	rect := image.Rect(1, 2, 9, 7)
+	rgba := image.NewRGBA(rect)
+	nrgba := image.NewNRGBA(rect)
+	gray := image.NewGray(rect)
+	ycbcr := image.NewYCbCr(rect, image.YCbCrSubsampleRatio420)
+	paletted := image.NewPaletted(rect, color.Palette{color.Black, color.NRGBA{R: 10, G: 200, B: 30, A: 128}})
+
+	for y := rect.Min.Y; y < rect.Max.Y; y++ {
+		for x := rect.Min.X; x < rect.Max.X; x++ {
+			c := color.NRGBA{R: uint8(x * 25), G: uint8(y * 30), B: uint8(x * y), A: uint8(100 + x*10)}
+			rgba.Set(x, y, c)
+			nrgba.Set(x, y, c)
+			gray.Set(x, y, c)
+			ycbcr.Y[ycbcr.YOffset(x, y)] = uint8(x * y * 5)
+			ycbcr.Cb[ycbcr.COffset(x, y)] = uint8(x * 20)
+			ycbcr.Cr[ycbcr.COffset(x, y)] = uint8(y * 20)
+			paletted.SetColorIndex(x, y, uint8((x+y)%2))
+		}
+	}
+
+	tests := []struct {
+		name string
+		src  image.Image
+	}{
+		{name: "RGBA", src: rgba},
+		{name: "NRGBA", src: nrgba},
+		{name: "Gray", src: gray},
+		{name: "YCbCr", src: ycbcr},
+		{name: "Paletted", src: paletted},
+		{name: "Other", src: image.NewUniform(color.NRGBA{R: 1, G: 2, B: 3, A: 4})},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pixel := pixelReader(tt.src)
+
+			for y := rect.Min.Y; y < rect.Max.Y; y++ {
+				for x := rect.Min.X; x < rect.Max.X; x++ {
+					r, g, b, a := pixel(x, y)
+					wr, wg, wb, wa := tt.src.At(x, y).RGBA()
+					if r != wr || g != wg || b != wb || a != wa {
+						t.Fatalf("got %d, %d, %d, %d at (%d, %d); want %d, %d, %d, %d", r, g, b, a, x, y, wr, wg, wb, wa)
+					}
+				}
+			}
+		})
+	}
+}
+
+// Return a gray image of the given level
+func grayImage(rect image.Rectangle, level uint8) *image.Gray {
+	img := image.NewGray(rect)
+	for i := range img.Pix {
+		img.Pix[i] = level
+	}
+	return img
+}
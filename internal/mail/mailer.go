@@ -2,6 +2,7 @@ package mail
 
 import (
 	"bytes"
+	"context"
 	"embed"
 	"html/template"
 	"time"
@@ -80,3 +81,25 @@ func (m Mailer) Send(recipient, templateFile string, data any) error {
 	// Returning nil if no error occurred
 	return nil
 }
+
+// Declaring a method to send a mail, returning early once the given context is done
+// The SMTP client can't be cancelled, so the send carries on in the background, bounded by the dialer timeout
+func (m Mailer) SendContext(ctx context.Context, recipient, templateFile string, data any) error {
+	// Giving up straight away when the context is already done
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	// Sending the mail in a goroutine, with a buffered channel so that it never blocks once abandoned
+	done := make(chan error, 1)
+	go func() {
+		done <- m.Send(recipient, templateFile, data)
+	}()
+
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,377 @@
+package presence
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Define the types of message sent to the clients
+const (
+	TypePresence = "presence" // Editors of a movie changed, carries the full list
+	TypeVersion  = "version"  // Movie was saved, carries its new version
+	TypeDeleted  = "deleted"  // Movie was deleted
+	TypeError    = "error"    // Message from the client was rejected
+)
+
+// Editor identifies a user editing a movie
+type Editor struct {
+	UserID int64  `json:"user_id"`
+	Name   string `json:"name"`
+}
+
+// Message sent to the clients
+type Message struct {
+	Type    string   `json:"type"`
+	MovieID int64    `json:"movie_id,omitempty"`
+	Editors []Editor `json:"editors,omitempty"`
+	Version int32    `json:"version,omitempty"`
+	Error   string   `json:"error,omitempty"`
+}
+
+// Client is a connection of an editor, which can be editing several movies at once
+// Messages are queued on a buffered channel, and a client which falls behind is closed
+type Client struct {
+	editor Editor
+	send   chan Message
+	movies map[int64]struct{}
+	closed bool
+}
+
+// Messages returns the channel the messages for the client are queued on, closed once the client is
+func (c *Client) Messages() <-chan Message {
+	return c.send
+}
+
+// Announcement carries the editors of a movie connected to one API instance to the other instances
+// Seq orders the announcements of an instance, which may arrive out of order since they are sent concurrently
+// An announcement with Sync set carries no editors, it asks the other instances to announce all of theirs
+type Announcement struct {
+	Instance string   `json:"instance"`
+	Seq      uint64   `json:"seq"`
+	MovieID  int64    `json:"movie_id,omitempty"`
+	Editors  []Editor `json:"editors,omitempty"`
+	Sync     bool     `json:"sync,omitempty"`
+}
+
+// Editors of a movie connected to another API instance, as last announced by it
+// They are forgotten once they expire, so that the editors of an instance which stopped don't linger
+type remoteEditors struct {
+	seq     uint64
+	editors []Editor
+	expires time.Time
+}
+
+// Hub keeps track of who is editing which movie, for the clients connected to this API instance,
+// along with the editors connected to the other instances as they announce them
+type Hub struct {
+	mu       sync.Mutex
+	buffer   int
+	instance string
+	seq      uint64
+	rooms    map[int64]map[*Client]struct{}
+	clients  map[*Client]struct{}
+	remote   map[int64]map[string]*remoteEditors
+	closed   bool
+}
+
+// Factory function for creating a new hub, giving each client a queue of the given buffer size
+// The hub is given a random instance id, which tells its announcements apart from those of the other instances
+func NewHub(buffer int) *Hub {
+	id := make([]byte, 8)
+	rand.Read(id)
+
+	return &Hub{
+		buffer:   buffer,
+		instance: hex.EncodeToString(id),
+		rooms:    make(map[int64]map[*Client]struct{}),
+		clients:  make(map[*Client]struct{}),
+		remote:   make(map[int64]map[string]*remoteEditors),
+	}
+}
+
+// Register a new client for the editor
+// The client is already closed when the hub is
+func (h *Hub) Register(editor Editor) *Client {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	c := &Client{
+		editor: editor,
+		send:   make(chan Message, h.buffer),
+		movies: make(map[int64]struct{}),
+	}
+
+	if h.closed {
+		c.closed = true
+		close(c.send)
+		return c
+	}
+	h.clients[c] = struct{}{}
+
+	return c
+}
+
+// Unregister a client once its connection is gone, telling the other editors of its movies
+// Returns the movies the client was editing, whose editors changed
+func (h *Hub) Unregister(c *Client) []int64 {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	movies := make([]int64, 0, len(c.movies))
+	for movieID := range c.movies {
+		h.leave(c, movieID)
+		movies = append(movies, movieID)
+	}
+	delete(h.clients, c)
+	h.close(c)
+
+	return movies
+}
+
+// Join makes the client an editor of the movie, sending the editors to everyone editing it
+func (h *Hub) Join(c *Client, movieID int64) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if c.closed {
+		return
+	}
+
+	room, ok := h.rooms[movieID]
+	if !ok {
+		room = make(map[*Client]struct{})
+		h.rooms[movieID] = room
+	}
+	room[c] = struct{}{}
+	c.movies[movieID] = struct{}{}
+
+	h.broadcast(movieID, Message{Type: TypePresence, MovieID: movieID, Editors: h.editors(movieID)})
+}
+
+// Leave stops the client editing the movie, sending the editors to everyone still editing it
+// Returns whether the client was editing the movie
+func (h *Hub) Leave(c *Client, movieID int64) bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	return h.leave(c, movieID)
+}
+
+// Broadcast sends the message to every client editing the movie
+func (h *Hub) Broadcast(movieID int64, msg Message) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.broadcast(movieID, msg)
+}
+
+// Send queues the message for a single client
+func (h *Hub) Send(c *Client, msg Message) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.send(c, msg)
+}
+
+// Announce the editors of the movie connected to this instance, for sending to the other instances
+func (h *Hub) Announce(movieID int64) Announcement {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.seq++
+	return Announcement{Instance: h.instance, Seq: h.seq, MovieID: movieID, Editors: h.localEditors(movieID)}
+}
+
+// AnnounceAll announces the editors of every movie being edited on this instance
+// Sent periodically, so that the other instances keep them, and whenever an instance asks for them
+func (h *Hub) AnnounceAll() []Announcement {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	announcements := make([]Announcement, 0, len(h.rooms))
+	for movieID := range h.rooms {
+		h.seq++
+		announcements = append(announcements, Announcement{Instance: h.instance, Seq: h.seq, MovieID: movieID, Editors: h.localEditors(movieID)})
+	}
+
+	return announcements
+}
+
+// SyncRequest returns the announcement asking the other instances to announce all their editors
+func (h *Hub) SyncRequest() Announcement {
+	return Announcement{Instance: h.instance, Sync: true}
+}
+
+// Receive the announcement of another instance, keeping its editors until the given expiry time
+// Everyone editing the movie here is sent the editors when they changed. Announcements of this instance and
+// announcements older than the last one of their instance for the movie are ignored
+// Returns whether the announcement is a sync request of another instance, to be answered with AnnounceAll
+func (h *Hub) Receive(a Announcement, expires time.Time) bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if a.Instance == h.instance {
+		return false
+	}
+	if a.Sync {
+		return true
+	}
+
+	instances, ok := h.remote[a.MovieID]
+	if !ok {
+		instances = make(map[string]*remoteEditors)
+		h.remote[a.MovieID] = instances
+	}
+	if last, ok := instances[a.Instance]; ok && a.Seq <= last.seq {
+		return false
+	}
+
+	// Keeping an empty list too until it expires, so that an older announcement arriving late is still ignored
+	before := h.editors(a.MovieID)
+	instances[a.Instance] = &remoteEditors{seq: a.Seq, editors: a.Editors, expires: expires}
+	h.broadcastEditors(a.MovieID, before)
+
+	return false
+}
+
+// Expire forgets the editors of the other instances which weren't announced again in time
+func (h *Hub) Expire(now time.Time) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for movieID, instances := range h.remote {
+		before := h.editors(movieID)
+		for instance, remote := range instances {
+			if remote.expires.Before(now) {
+				delete(instances, instance)
+			}
+		}
+		if len(instances) == 0 {
+			delete(h.remote, movieID)
+		}
+		h.broadcastEditors(movieID, before)
+	}
+}
+
+// Close closes every client, and the ones registering afterwards
+func (h *Hub) Close() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for c := range h.clients {
+		h.close(c)
+	}
+	h.closed = true
+}
+
+// Remove the client from the room of the movie, returning whether it was in it, the mutex must be held
+func (h *Hub) leave(c *Client, movieID int64) bool {
+	room, ok := h.rooms[movieID]
+	if !ok {
+		return false
+	}
+	if _, ok := room[c]; !ok {
+		return false
+	}
+
+	delete(room, c)
+	delete(c.movies, movieID)
+	if len(room) == 0 {
+		delete(h.rooms, movieID)
+		return true
+	}
+
+	h.broadcast(movieID, Message{Type: TypePresence, MovieID: movieID, Editors: h.editors(movieID)})
+	return true
+}
+
+// Send the message to every client in the room of the movie, the mutex must be held
+func (h *Hub) broadcast(movieID int64, msg Message) {
+	for c := range h.rooms[movieID] {
+		h.send(c, msg)
+	}
+}
+
+// Send the editors of the movie to everyone editing it, unless they are the same as before, the mutex must be held
+func (h *Hub) broadcastEditors(movieID int64, before []Editor) {
+	editors := h.editors(movieID)
+	if len(editors) == len(before) {
+		same := true
+		for i := range editors {
+			if editors[i] != before[i] {
+				same = false
+				break
+			}
+		}
+		if same {
+			return
+		}
+	}
+
+	h.broadcast(movieID, Message{Type: TypePresence, MovieID: movieID, Editors: editors})
+}
+
+// Queue the message for the client without blocking, closing the client when its queue is full
+// A closed client stays in its rooms until it is unregistered, the mutex must be held
+func (h *Hub) send(c *Client, msg Message) {
+	if c.closed {
+		return
+	}
+
+	select {
+	case c.send <- msg:
+	default:
+		h.close(c)
+	}
+}
+
+// Close the queue of the client once, the mutex must be held
+func (h *Hub) close(c *Client) {
+	if !c.closed {
+		c.closed = true
+		close(c.send)
+	}
+}
+
+// List the editors of the movie on every instance, once per user even when they have several connections,
+// the mutex must be held
+func (h *Hub) editors(movieID int64) []Editor {
+	editors := h.localEditors(movieID)
+	for _, remote := range h.remote[movieID] {
+		editors = append(editors, remote.editors...)
+	}
+
+	return uniqueEditors(editors)
+}
+
+// List the editors of the movie connected to this instance, the mutex must be held
+func (h *Hub) localEditors(movieID int64) []Editor {
+	editors := []Editor{}
+	for c := range h.rooms[movieID] {
+		editors = append(editors, c.editor)
+	}
+
+	return uniqueEditors(editors)
+}
+
+// Keep each user once in the editors, ordered by user id
+func uniqueEditors(all []Editor) []Editor {
+	seen := make(map[int64]bool)
+	editors := []Editor{}
+	for _, editor := range all {
+		if !seen[editor.UserID] {
+			seen[editor.UserID] = true
+			editors = append(editors, editor)
+		}
+	}
+
+	// Ordering the editors, so that clients get a stable list
+	sort.Slice(editors, func(i, j int) bool {
+		return editors[i].UserID < editors[j].UserID
+	})
+
+	return editors
+}
@@ -0,0 +1,333 @@
+package presence
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+// Receive every message queued for the client without blocking, and whether it is still open
+func drain(c *Client) ([]Message, bool) {
+	var messages []Message
+	for {
+		select {
+		case msg, ok := <-c.Messages():
+			if !ok {
+				return messages, false
+			}
+			messages = append(messages, msg)
+		default:
+			return messages, true
+		}
+	}
+}
+
+var (
+	alice = Editor{UserID: 1, Name: "Alice"}
+	bob   = Editor{UserID: 2, Name: "Bob"}
+)
+
+func TestHubPresence(t *testing.T) {
+	tests := []struct {
+		name string
+		run  func(h *Hub, a, b, a2 *Client)
+		want map[string][]Message // Messages expected by each client, keyed by "a", "b" and "a2"
+	}{
+		{
+			name: "Join",
+			run: func(h *Hub, a, b, a2 *Client) {
+				h.Join(a, 7)
+			},
+			want: map[string][]Message{
+				"a": {{Type: TypePresence, MovieID: 7, Editors: []Editor{alice}}},
+			},
+		},
+		{
+			name: "Second editor",
+			run: func(h *Hub, a, b, a2 *Client) {
+				h.Join(a, 7)
+				h.Join(b, 7)
+			},
+			want: map[string][]Message{
+				"a": {
+					{Type: TypePresence, MovieID: 7, Editors: []Editor{alice}},
+					{Type: TypePresence, MovieID: 7, Editors: []Editor{alice, bob}},
+				},
+				"b": {{Type: TypePresence, MovieID: 7, Editors: []Editor{alice, bob}}},
+			},
+		},
+		{
+			name: "Same user twice",
+			run: func(h *Hub, a, b, a2 *Client) {
+				h.Join(a, 7)
+				h.Join(a2, 7)
+			},
+			want: map[string][]Message{
+				"a": {
+					{Type: TypePresence, MovieID: 7, Editors: []Editor{alice}},
+					{Type: TypePresence, MovieID: 7, Editors: []Editor{alice}},
+				},
+				"a2": {{Type: TypePresence, MovieID: 7, Editors: []Editor{alice}}},
+			},
+		},
+		{
+			name: "Other movie",
+			run: func(h *Hub, a, b, a2 *Client) {
+				h.Join(a, 7)
+				h.Join(b, 8)
+			},
+			want: map[string][]Message{
+				"a": {{Type: TypePresence, MovieID: 7, Editors: []Editor{alice}}},
+				"b": {{Type: TypePresence, MovieID: 8, Editors: []Editor{bob}}},
+			},
+		},
+		{
+			name: "Leave",
+			run: func(h *Hub, a, b, a2 *Client) {
+				h.Join(a, 7)
+				h.Join(b, 7)
+				drain(a)
+				drain(b)
+				h.Leave(b, 7)
+				h.Leave(b, 7)
+			},
+			want: map[string][]Message{
+				"a": {{Type: TypePresence, MovieID: 7, Editors: []Editor{alice}}},
+			},
+		},
+		{
+			name: "Unregister",
+			run: func(h *Hub, a, b, a2 *Client) {
+				h.Join(a, 7)
+				h.Join(b, 7)
+				h.Join(b, 8)
+				drain(a)
+				drain(b)
+				h.Unregister(b)
+			},
+			want: map[string][]Message{
+				"a": {{Type: TypePresence, MovieID: 7, Editors: []Editor{alice}}},
+			},
+		},
+		{
+			name: "Broadcast",
+			run: func(h *Hub, a, b, a2 *Client) {
+				h.Join(a, 7)
+				h.Join(b, 8)
+				drain(a)
+				drain(b)
+				h.Broadcast(7, Message{Type: TypeVersion, MovieID: 7, Version: 3})
+			},
+			want: map[string][]Message{
+				"a": {{Type: TypeVersion, MovieID: 7, Version: 3}},
+			},
+		},
+		{
+			name: "Send",
+			run: func(h *Hub, a, b, a2 *Client) {
+				h.Send(b, Message{Type: TypeError, Error: "unknown message type"})
+			},
+			want: map[string][]Message{
+				"b": {{Type: TypeError, Error: "unknown message type"}},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := NewHub(8)
+			clients := map[string]*Client{
+				"a":  h.Register(alice),
+				"b":  h.Register(bob),
+				"a2": h.Register(alice),
+			}
+
+			tt.run(h, clients["a"], clients["b"], clients["a2"])
+
+			for name, c := range clients {
+				got, _ := drain(c)
+				if !reflect.DeepEqual(got, tt.want[name]) {
+					t.Errorf("got %+v for client %s; want %+v", got, name, tt.want[name])
+				}
+			}
+		})
+	}
+}
+
+func TestHubSlowClient(t *testing.T) {
+	h := NewHub(1)
+	a := h.Register(alice)
+	b := h.Register(bob)
+
+	// The second message doesn't fit in the queue of a, which is closed rather than blocking the hub
+	h.Join(a, 7)
+	h.Join(b, 7)
+
+	got, open := drain(a)
+	if open {
+		t.Error("got an open client after its queue overflowed; want closed")
+	}
+	if len(got) != 1 {
+		t.Errorf("got %d messages; want 1", len(got))
+	}
+
+	// A closed client can't join any more, and doesn't hold up the others
+	drain(b)
+	h.Join(a, 8)
+	h.Broadcast(7, Message{Type: TypeVersion, MovieID: 7, Version: 2})
+	if got, open := drain(b); len(got) != 1 || !open {
+		t.Errorf("got %d messages, open %t for the other client; want 1, open", len(got), open)
+	}
+}
+
+func TestHubClose(t *testing.T) {
+	h := NewHub(4)
+	before := h.Register(alice)
+
+	h.Close()
+
+	if _, open := drain(before); open {
+		t.Error("got an open client after closing the hub; want closed")
+	}
+	if _, open := drain(h.Register(bob)); open {
+		t.Error("got an open client registered after closing the hub; want closed")
+	}
+
+	// Unregistering a client of a closed hub is harmless
+	h.Unregister(before)
+}
+
+func TestHubRemoteEditors(t *testing.T) {
+	now := time.Now()
+	later := now.Add(time.Minute)
+
+	tests := []struct {
+		name string
+		run  func(h *Hub, a *Client)
+		want []Message // Messages expected by the local client, after it joined movie 7
+	}{
+		{
+			name: "Remote editor joins",
+			run: func(h *Hub, a *Client) {
+				h.Receive(Announcement{Instance: "other", Seq: 1, MovieID: 7, Editors: []Editor{bob}}, later)
+			},
+			want: []Message{{Type: TypePresence, MovieID: 7, Editors: []Editor{alice, bob}}},
+		},
+		{
+			name: "Remote editor leaves",
+			run: func(h *Hub, a *Client) {
+				h.Receive(Announcement{Instance: "other", Seq: 1, MovieID: 7, Editors: []Editor{bob}}, later)
+				h.Receive(Announcement{Instance: "other", Seq: 2, MovieID: 7}, later)
+			},
+			want: []Message{
+				{Type: TypePresence, MovieID: 7, Editors: []Editor{alice, bob}},
+				{Type: TypePresence, MovieID: 7, Editors: []Editor{alice}},
+			},
+		},
+		{
+			name: "Older announcement",
+			run: func(h *Hub, a *Client) {
+				h.Receive(Announcement{Instance: "other", Seq: 2, MovieID: 7}, later)
+				h.Receive(Announcement{Instance: "other", Seq: 1, MovieID: 7, Editors: []Editor{bob}}, later)
+			},
+		},
+		{
+			name: "Same user on another instance",
+			run: func(h *Hub, a *Client) {
+				h.Receive(Announcement{Instance: "other", Seq: 1, MovieID: 7, Editors: []Editor{alice}}, later)
+			},
+		},
+		{
+			name: "Other movie",
+			run: func(h *Hub, a *Client) {
+				h.Receive(Announcement{Instance: "other", Seq: 1, MovieID: 8, Editors: []Editor{bob}}, later)
+			},
+		},
+		{
+			name: "Own announcement",
+			run: func(h *Hub, a *Client) {
+				own := h.Announce(7)
+				own.Seq++
+				own.Editors = []Editor{bob}
+				h.Receive(own, later)
+			},
+		},
+		{
+			name: "Expired",
+			run: func(h *Hub, a *Client) {
+				h.Receive(Announcement{Instance: "other", Seq: 1, MovieID: 7, Editors: []Editor{bob}}, later)
+				h.Receive(Announcement{Instance: "third", Seq: 1, MovieID: 7, Editors: []Editor{bob}}, later.Add(time.Minute))
+				h.Expire(later.Add(time.Second))
+				h.Expire(later.Add(2 * time.Minute))
+			},
+			want: []Message{
+				{Type: TypePresence, MovieID: 7, Editors: []Editor{alice, bob}},
+				{Type: TypePresence, MovieID: 7, Editors: []Editor{alice}},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := NewHub(8)
+			a := h.Register(alice)
+			h.Join(a, 7)
+			drain(a)
+
+			tt.run(h, a)
+
+			got, _ := drain(a)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %+v; want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestHubAnnounce(t *testing.T) {
+	h := NewHub(8)
+	a := h.Register(alice)
+	b := h.Register(bob)
+	h.Join(a, 7)
+	h.Join(b, 7)
+	h.Join(b, 8)
+
+	// Editors of the other instances are never announced again
+	h.Receive(Announcement{Instance: "other", Seq: 1, MovieID: 7, Editors: []Editor{{UserID: 3, Name: "Carol"}}}, time.Now().Add(time.Minute))
+
+	first := h.Announce(7)
+	if !reflect.DeepEqual(first.Editors, []Editor{alice, bob}) || first.MovieID != 7 {
+		t.Errorf("got %+v; want the local editors of movie 7", first)
+	}
+
+	all := h.AnnounceAll()
+	if len(all) != 2 {
+		t.Fatalf("got %d announcements; want 2", len(all))
+	}
+	for _, announcement := range all {
+		if announcement.Instance != first.Instance || announcement.Seq <= first.Seq {
+			t.Errorf("got instance %s, seq %d; want instance %s, seq after %d", announcement.Instance, announcement.Seq, first.Instance, first.Seq)
+		}
+	}
+
+	// Once everyone left the movie an empty list is announced, after which it is no longer announced periodically
+	h.Unregister(a)
+	movies := h.Unregister(b)
+	if len(movies) != 2 {
+		t.Errorf("got %d movies left; want 2", len(movies))
+	}
+	if last := h.Announce(8); len(last.Editors) != 0 {
+		t.Errorf("got editors %+v after everyone left; want none", last.Editors)
+	}
+	if all := h.AnnounceAll(); len(all) != 0 {
+		t.Errorf("got %d announcements after everyone left; want 0", len(all))
+	}
+
+	// Sync requests of other instances are to be answered, those of this one aren't
+	if !h.Receive(Announcement{Instance: "other", Sync: true}, time.Now()) {
+		t.Error("got false for the sync request of another instance; want true")
+	}
+	if h.Receive(h.SyncRequest(), time.Now()) {
+		t.Error("got true for the own sync request; want false")
+	}
+}
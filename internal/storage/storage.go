@@ -0,0 +1,140 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// Defining a custom error for keys which would escape the storage root
+var ErrInvalidKey = errors.New("invalid storage key")
+
+// Storage is the interface for storing uploaded files under slash separated keys
+// Implementations can keep the files anywhere, as long as they can be served from the returned URL
+type Storage interface {
+	Put(ctx context.Context, key string, r io.Reader, contentType string) error
+	Delete(ctx context.Context, key string) error
+	URL(key string) string
+}
+
+// Local is a Storage which keeps files in a directory on the local filesystem
+type Local struct {
+	root    string
+	baseURL string
+}
+
+// Factory function for creating a new local filesystem storage
+// The files are expected to be served from the base URL, by the API or a web server in front of it
+func NewLocal(root, baseURL string) *Local {
+	return &Local{
+		root:    root,
+		baseURL: strings.TrimSuffix(baseURL, "/"),
+	}
+}
+
+// Put writes the contents of r to the file for the given key, creating its directories as needed
+// The file is written under a temporary name first, so that readers never see a partial file
+func (s *Local) Put(ctx context.Context, key string, r io.Reader, contentType string) error {
+	filename, err := s.path(key)
+	if err != nil {
+		return err
+	}
+
+	// Creating the directories for the file
+	err = os.MkdirAll(filepath.Dir(filename), 0o755)
+	if err != nil {
+		return err
+	}
+
+	// Writing to a temporary file in the same directory
+	tmp, err := os.CreateTemp(filepath.Dir(filename), ".upload-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	_, err = io.Copy(tmp, r)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+
+	// Checking the context before moving the file into place
+	if err = ctx.Err(); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), filename)
+}
+
+// Delete removes the file for the given key, ignoring files which don't exist
+func (s *Local) Delete(ctx context.Context, key string) error {
+	filename, err := s.path(key)
+	if err != nil {
+		return err
+	}
+
+	err = os.Remove(filename)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+
+	return nil
+}
+
+// URL returns the public URL of the file for the given key
+func (s *Local) URL(key string) string {
+	segments := strings.Split(key, "/")
+	for i := range segments {
+		segments[i] = url.PathEscape(segments[i])
+	}
+
+	return s.baseURL + "/" + strings.Join(segments, "/")
+}
+
+// Return the path on disk for a key, refusing keys which would escape the root directory
+func (s *Local) path(key string) (string, error) {
+	cleaned := path.Clean("/" + key)
+	if cleaned == "/" || cleaned != "/"+key {
+		return "", ErrInvalidKey
+	}
+
+	return filepath.Join(s.root, filepath.FromSlash(cleaned)), nil
+}
+
+// FilesOnly wraps a filesystem so that it refuses to open directories, which are reported as not existing
+// Serving the stored files through it keeps the file servers from listing the keys of a directory
+func FilesOnly(fs http.FileSystem) http.FileSystem {
+	return filesOnly{fs: fs}
+}
+
+type filesOnly struct {
+	fs http.FileSystem
+}
+
+func (f filesOnly) Open(name string) (http.File, error) {
+	file, err := f.fs.Open(name)
+	if err != nil {
+		return nil, err
+	}
+
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	if info.IsDir() {
+		file.Close()
+		return nil, os.ErrNotExist
+	}
+
+	return file, nil
+}
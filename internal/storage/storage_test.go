@@ -0,0 +1,57 @@
+package storage
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestFilesOnly(t *testing.T) {
+	// Storing a single file, two directories down
+	root := t.TempDir()
+	err := os.MkdirAll(filepath.Join(root, "movies", "1"), 0o755)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = os.WriteFile(filepath.Join(root, "movies", "1", "poster.jpg"), []byte("jpeg"), 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		path     string
+		wantBody string
+		wantErr  error
+	}{
+		{name: "File", path: "/movies/1/poster.jpg", wantBody: "jpeg"},
+		{name: "Directory", path: "/movies/1", wantErr: os.ErrNotExist},
+		{name: "Root", path: "/", wantErr: os.ErrNotExist},
+		{name: "Missing file", path: "/movies/2/poster.jpg", wantErr: os.ErrNotExist},
+	}
+
+	fs := FilesOnly(http.Dir(root))
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			file, err := fs.Open(tt.path)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("got error %v; want %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			defer file.Close()
+
+			body, err := io.ReadAll(file)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(body) != tt.wantBody {
+				t.Errorf("got body %q; want %q", body, tt.wantBody)
+			}
+		})
+	}
+}
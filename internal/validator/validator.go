@@ -2,11 +2,19 @@ package validator
 
 import (
 	"regexp"
+	"strings"
+	"unicode"
 )
 
 var (
 	// Define a regex which can be used to match against valid email addresses
 	EmailRX = regexp.MustCompile("^[a-zA-Z0-9.!#$%&'*+\\/=?^_`{|}~-]+@[a-zA-Z0-9](?:[a-zA-Z0-9-]{0,61}[a-zA-Z0-9])?(?:\\.[a-zA-Z0-9](?:[a-zA-Z0-9-]{0,61}[a-zA-Z0-9])?)*$")
+
+	// Define a regex which can be used to match against language tags, such as "en" or "pt-BR"
+	LanguageRX = regexp.MustCompile("^[a-z]{2,3}(-[A-Z]{2})?$")
+
+	// Define a regex which can be used to match against ISO 3166-1 alpha-2 country codes, such as "US"
+	CountryRX = regexp.MustCompile("^[A-Z]{2}$")
 )
 
 // Map of validation errors
@@ -61,3 +69,35 @@ func Unique(values []string) bool {
 	}
 	return len(values) == len(uniqueValues)
 }
+
+// Blocklist of words which are not allowed in user generated text, such as comments
+// Words are matched case insensitively against whole words, so that "class" doesn't match "ass"
+var Blocklist = map[string]bool{
+	"asshole":      true,
+	"bastard":      true,
+	"bitch":        true,
+	"bullshit":     true,
+	"cunt":         true,
+	"dickhead":     true,
+	"fuck":         true,
+	"fucker":       true,
+	"fucking":      true,
+	"motherfucker": true,
+	"shit":         true,
+	"slut":         true,
+	"whore":        true,
+}
+
+// NotBlocked method which checks that a string value contains none of the words in the blocklist
+func NotBlocked(value string) bool {
+	words := strings.FieldsFunc(strings.ToLower(value), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+
+	for _, word := range words {
+		if Blocklist[word] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,32 @@
+package validator
+
+import (
+	"testing"
+)
+
+func TestNotBlocked(t *testing.T) {
+	tests := []struct {
+		name  string
+		value string
+		want  bool
+	}{
+		{name: "Empty", value: "", want: true},
+		{name: "Clean", value: "A classic, with a great cast", want: true},
+		{name: "Blocked word", value: "what a bastard", want: false},
+		{name: "Upper case", value: "What a BASTARD", want: false},
+		{name: "Punctuation", value: "shit!", want: false},
+		{name: "Between punctuation", value: "(bullshit)", want: false},
+		{name: "Inside a word", value: "classy assassin", want: true},
+		{name: "Prefix of a word", value: "Shitake mushrooms", want: true},
+		{name: "Joined by digits", value: "shit2", want: true},
+		{name: "Unicode letters", value: "élan déjà vu", want: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := NotBlocked(tt.value); got != tt.want {
+				t.Errorf("got NotBlocked(%q) = %t; want %t", tt.value, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,146 @@
+package webhook
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestSign(t *testing.T) {
+	tests := []struct {
+		name      string
+		secret    string
+		timestamp int64
+		body      string
+		want      string
+	}{
+		{
+			name:      "Event body",
+			secret:    "secret",
+			timestamp: 1700000000,
+			body:      `{"event":"movie.created"}`,
+			want:      "sha256=c526911c58f9b2a0a78c7040993c6b2122aeee9ec7d9fa820914e60ca55194a8",
+		},
+		{
+			name:      "Other secret",
+			secret:    "other",
+			timestamp: 1700000000,
+			body:      `{"event":"movie.created"}`,
+			want:      "sha256=8b14c7a4177df7aea6347d2f66cd287afcef2ec6f4040a36fa0ddcb0eb32faf6",
+		},
+		{
+			name:      "Empty body",
+			secret:    "secret",
+			timestamp: 0,
+			body:      "",
+			want:      "sha256=3445798a051818ef95def46c2eb62b43d377ce6e3c29b4d0aec3da0e59577f79",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := Sign(tt.secret, tt.timestamp, []byte(tt.body))
+			if got != tt.want {
+				t.Errorf("got %q; want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSenderSend(t *testing.T) {
+	tests := []struct {
+		name    string
+		status  int
+		wantErr bool
+	}{
+		{name: "OK", status: http.StatusOK},
+		{name: "No content", status: http.StatusNoContent},
+		{name: "Redirect", status: http.StatusFound, wantErr: true},
+		{name: "Client error", status: http.StatusGone, wantErr: true},
+		{name: "Server error", status: http.StatusInternalServerError, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			delivery := Delivery{
+				ID:      42,
+				Event:   "movie.created",
+				Secret:  "secret",
+				Payload: []byte(`{"event":"movie.created"}`),
+			}
+
+			// Recording the request the receiver got
+			var got *http.Request
+			var body []byte
+			ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				got = r
+				body, _ = io.ReadAll(r.Body)
+				if tt.status == http.StatusFound {
+					w.Header().Set("Location", "/elsewhere")
+				}
+				w.WriteHeader(tt.status)
+			}))
+			defer ts.Close()
+			delivery.URL = ts.URL
+
+			status, err := NewSender(5*time.Second).Send(context.Background(), delivery)
+			if status != tt.status {
+				t.Errorf("got status %d; want %d", status, tt.status)
+			}
+			if (err != nil) != tt.wantErr {
+				t.Errorf("got error %v; want error %t", err, tt.wantErr)
+			}
+
+			if got == nil {
+				t.Fatal("the receiver got no request")
+			}
+			if got.Method != http.MethodPost {
+				t.Errorf("got method %q; want %q", got.Method, http.MethodPost)
+			}
+			if string(body) != string(delivery.Payload) {
+				t.Errorf("got body %q; want %q", body, delivery.Payload)
+			}
+
+			headers := map[string]string{
+				"Content-Type": "application/json",
+				HeaderEvent:    delivery.Event,
+				HeaderDelivery: "42",
+			}
+			for name, want := range headers {
+				if value := got.Header.Get(name); value != want {
+					t.Errorf("got %s header %q; want %q", name, value, want)
+				}
+			}
+
+			// The signature must match the body and the timestamp sent along with it
+			timestamp, err := strconv.ParseInt(got.Header.Get(HeaderTimestamp), 10, 64)
+			if err != nil {
+				t.Fatalf("got invalid %s header: %v", HeaderTimestamp, err)
+			}
+			if d := time.Since(time.Unix(timestamp, 0)); d < -time.Minute || d > time.Minute {
+				t.Errorf("got %s header %d seconds away from now", HeaderTimestamp, int64(d.Seconds()))
+			}
+			if signature, want := got.Header.Get(HeaderSignature), Sign(delivery.Secret, timestamp, body); signature != want {
+				t.Errorf("got %s header %q; want %q", HeaderSignature, signature, want)
+			}
+		})
+	}
+}
+
+func TestSenderSendUnreachable(t *testing.T) {
+	// Closing the receiver straight away, so that nothing is listening on its URL
+	ts := httptest.NewServer(http.NotFoundHandler())
+	ts.Close()
+
+	status, err := NewSender(time.Second).Send(context.Background(), Delivery{URL: ts.URL, Payload: []byte("{}")})
+	if err == nil {
+		t.Error("got no error; want one")
+	}
+	if status != 0 {
+		t.Errorf("got status %d; want 0", status)
+	}
+}
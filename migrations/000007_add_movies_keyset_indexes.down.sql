@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS movie_title_id_idx;
+DROP INDEX IF EXISTS movie_year_id_idx;
+DROP INDEX IF EXISTS movie_runtime_id_idx;
\ No newline at end of file
@@ -0,0 +1,3 @@
+CREATE INDEX IF NOT EXISTS movie_title_id_idx ON movies (title, id);
+CREATE INDEX IF NOT EXISTS movie_year_id_idx ON movies (year, id);
+CREATE INDEX IF NOT EXISTS movie_runtime_id_idx ON movies (runtime, id);
\ No newline at end of file
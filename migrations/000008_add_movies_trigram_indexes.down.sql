@@ -0,0 +1 @@
+DROP INDEX IF EXISTS movie_title_trgm_idx;
\ No newline at end of file
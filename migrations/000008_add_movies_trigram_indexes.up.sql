@@ -0,0 +1,3 @@
+CREATE EXTENSION IF NOT EXISTS pg_trgm;
+
+CREATE INDEX IF NOT EXISTS movie_title_trgm_idx ON movies USING GIN (title gin_trgm_ops);
\ No newline at end of file
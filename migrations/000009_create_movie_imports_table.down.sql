@@ -0,0 +1 @@
+DROP TABLE IF EXISTS movie_imports;
\ No newline at end of file
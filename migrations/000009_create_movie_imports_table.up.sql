@@ -0,0 +1,11 @@
+CREATE TABLE IF NOT EXISTS movie_imports (
+  id bigserial PRIMARY KEY,
+  created_at timestamp(0) with time zone NOT NULL DEFAULT now(),
+  user_id bigint NOT NULL REFERENCES users ON DELETE CASCADE,
+  status text NOT NULL,
+  format text NOT NULL,
+  dry_run boolean NOT NULL,
+  atomic boolean NOT NULL,
+  report jsonb,
+  finished_at timestamp(0) with time zone
+);
\ No newline at end of file
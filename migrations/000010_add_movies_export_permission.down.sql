@@ -0,0 +1 @@
+DELETE FROM permissions WHERE code = 'movies:export';
\ No newline at end of file
@@ -0,0 +1,2 @@
+INSERT INTO permissions (code)
+VALUES ('movies:export');
\ No newline at end of file
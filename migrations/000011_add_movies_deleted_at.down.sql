@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS movie_deleted_at_idx;
+
+ALTER TABLE movies DROP COLUMN IF EXISTS deleted_at;
\ No newline at end of file
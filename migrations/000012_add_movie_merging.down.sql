@@ -0,0 +1,4 @@
+DELETE FROM permissions WHERE code = 'movies:admin';
+DROP INDEX IF EXISTS movie_normalized_title_trgm_idx;
+DROP TABLE IF EXISTS movie_revisions;
+DROP TABLE IF EXISTS movie_aliases;
\ No newline at end of file
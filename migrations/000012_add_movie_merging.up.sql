@@ -0,0 +1,27 @@
+CREATE TABLE IF NOT EXISTS movie_aliases (
+  old_id bigint PRIMARY KEY,
+  movie_id bigint NOT NULL REFERENCES movies ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS movie_aliases_movie_id_idx ON movie_aliases (movie_id);
+
+
+CREATE TABLE IF NOT EXISTS movie_revisions (
+  id bigserial PRIMARY KEY,
+  created_at timestamp(0) with time zone NOT NULL DEFAULT now(),
+  movie_id bigint NOT NULL REFERENCES movies ON DELETE CASCADE,
+  user_id bigint REFERENCES users ON DELETE SET NULL,
+  action text NOT NULL,
+  details jsonb NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS movie_revisions_movie_id_idx ON movie_revisions (movie_id);
+
+
+-- Indexing the normalized titles, which duplicate candidates are matched on
+CREATE INDEX IF NOT EXISTS movie_normalized_title_trgm_idx ON movies USING GIN ((trim(regexp_replace(lower(title), '[[:punct:][:space:]]+', ' ', 'g'))) gin_trgm_ops) WHERE deleted_at IS NULL;
+
+
+-- Adding the admin permission, which is required for merging movies
+INSERT INTO permissions (code)
+VALUES ('movies:admin');
\ No newline at end of file
@@ -0,0 +1,13 @@
+CREATE TABLE IF NOT EXISTS movie_images (
+  id bigserial PRIMARY KEY,
+  created_at timestamp(0) with time zone NOT NULL DEFAULT now(),
+  movie_id bigint NOT NULL REFERENCES movies ON DELETE CASCADE,
+  kind text NOT NULL CHECK (kind IN ('poster', 'backdrop')),
+  content_type text NOT NULL,
+  width integer NOT NULL,
+  height integer NOT NULL,
+  urls jsonb NOT NULL,
+  keys text[] NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS movie_images_movie_id_idx ON movie_images (movie_id);
\ No newline at end of file
@@ -0,0 +1,12 @@
+CREATE TABLE IF NOT EXISTS movie_releases (
+  id bigserial PRIMARY KEY,
+  movie_id bigint NOT NULL REFERENCES movies ON DELETE CASCADE,
+  country char(2) NOT NULL,
+  type text NOT NULL CHECK (type IN ('theatrical', 'digital', 'physical')),
+  release_date date NOT NULL,
+  certification text NOT NULL DEFAULT '',
+  version integer NOT NULL DEFAULT 1,
+  UNIQUE (movie_id, country, type)
+);
+
+CREATE INDEX IF NOT EXISTS movie_releases_country_idx ON movie_releases (country, certification);
\ No newline at end of file
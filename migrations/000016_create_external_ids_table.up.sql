@@ -0,0 +1,7 @@
+CREATE TABLE IF NOT EXISTS external_ids (
+  movie_id bigint NOT NULL REFERENCES movies ON DELETE CASCADE,
+  provider text NOT NULL CHECK (provider IN ('imdb', 'tmdb', 'wikidata')),
+  external_id text NOT NULL,
+  PRIMARY KEY (movie_id, provider),
+  UNIQUE (provider, external_id)
+);
\ No newline at end of file
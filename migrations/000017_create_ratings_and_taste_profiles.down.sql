@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS user_taste_profiles;
+DROP TABLE IF EXISTS movie_ratings;
\ No newline at end of file
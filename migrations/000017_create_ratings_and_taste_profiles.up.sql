@@ -0,0 +1,16 @@
+CREATE TABLE IF NOT EXISTS movie_ratings (
+  user_id bigint NOT NULL REFERENCES users ON DELETE CASCADE,
+  movie_id bigint NOT NULL REFERENCES movies ON DELETE CASCADE,
+  rating smallint NOT NULL CHECK (rating BETWEEN 1 AND 10),
+  created_at timestamp(0) with time zone NOT NULL DEFAULT now(),
+  updated_at timestamp(0) with time zone NOT NULL DEFAULT now(),
+  PRIMARY KEY (user_id, movie_id)
+);
+
+CREATE INDEX IF NOT EXISTS movie_ratings_movie_id_idx ON movie_ratings (movie_id);
+
+CREATE TABLE IF NOT EXISTS user_taste_profiles (
+  user_id bigint PRIMARY KEY REFERENCES users ON DELETE CASCADE,
+  genre_weights jsonb NOT NULL DEFAULT '{}',
+  updated_at timestamp(0) with time zone NOT NULL DEFAULT now()
+);
\ No newline at end of file
@@ -0,0 +1 @@
+DROP TABLE IF EXISTS watch_events;
\ No newline at end of file
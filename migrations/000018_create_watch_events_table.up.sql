@@ -0,0 +1,11 @@
+CREATE TABLE IF NOT EXISTS watch_events (
+  id bigserial PRIMARY KEY,
+  user_id bigint NOT NULL REFERENCES users ON DELETE CASCADE,
+  movie_id bigint NOT NULL REFERENCES movies ON DELETE CASCADE,
+  watched_at timestamp(0) with time zone NOT NULL DEFAULT now(),
+  progress integer NOT NULL CHECK (progress >= 0),
+  completed boolean NOT NULL DEFAULT false
+);
+
+CREATE INDEX IF NOT EXISTS watch_events_user_id_watched_at_idx ON watch_events (user_id, watched_at DESC);
+CREATE INDEX IF NOT EXISTS watch_events_movie_id_idx ON watch_events (movie_id);
\ No newline at end of file
@@ -0,0 +1,24 @@
+CREATE TABLE IF NOT EXISTS follows (
+  follower_id bigint NOT NULL REFERENCES users ON DELETE CASCADE,
+  followed_id bigint NOT NULL REFERENCES users ON DELETE CASCADE,
+  created_at timestamp(0) with time zone NOT NULL DEFAULT now(),
+  PRIMARY KEY (follower_id, followed_id),
+  CHECK (follower_id <> followed_id)
+);
+
+CREATE INDEX IF NOT EXISTS follows_followed_id_idx ON follows (followed_id);
+
+CREATE TABLE IF NOT EXISTS activity_events (
+  id bigserial PRIMARY KEY,
+  created_at timestamp(0) with time zone NOT NULL DEFAULT now(),
+  user_id bigint NOT NULL REFERENCES users ON DELETE CASCADE,
+  kind text NOT NULL,
+  movie_id bigint REFERENCES movies ON DELETE CASCADE,
+  data jsonb NOT NULL DEFAULT '{}',
+  visibility text NOT NULL CHECK (visibility IN ('public', 'followers', 'private'))
+);
+
+CREATE INDEX IF NOT EXISTS activity_events_user_id_idx ON activity_events (user_id, id DESC);
+
+-- A user has a single movie_rated event for each movie, which their new ratings replace
+CREATE UNIQUE INDEX IF NOT EXISTS activity_events_movie_rated_idx ON activity_events (user_id, kind, movie_id) WHERE kind = 'movie_rated';
\ No newline at end of file
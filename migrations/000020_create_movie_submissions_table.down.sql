@@ -0,0 +1,2 @@
+DELETE FROM permissions WHERE code IN ('movies:suggest', 'movies:moderate');
+DROP TABLE IF EXISTS movie_submissions;
\ No newline at end of file
@@ -0,0 +1,33 @@
+CREATE TABLE IF NOT EXISTS movie_submissions (
+  id bigserial PRIMARY KEY,
+  created_at timestamp(0) with time zone NOT NULL DEFAULT now(),
+  user_id bigint NOT NULL REFERENCES users ON DELETE CASCADE,
+  kind text NOT NULL CHECK (kind IN ('create', 'edit')),
+  movie_id bigint REFERENCES movies ON DELETE CASCADE,
+  movie_version integer,
+  title text,
+  year integer,
+  runtime integer,
+  genres text[],
+  status text NOT NULL DEFAULT 'pending' CHECK (status IN ('pending', 'approved', 'rejected')),
+  reason text NOT NULL DEFAULT '',
+  reviewed_by bigint REFERENCES users ON DELETE SET NULL,
+  reviewed_at timestamp(0) with time zone,
+  version integer NOT NULL DEFAULT 1
+);
+
+CREATE INDEX IF NOT EXISTS movie_submissions_status_idx ON movie_submissions (status, id);
+CREATE INDEX IF NOT EXISTS movie_submissions_user_id_idx ON movie_submissions (user_id, id);
+
+-- Adding the permissions for suggesting movies and for moderating the suggestions
+INSERT INTO permissions (code)
+VALUES ('movies:suggest'), ('movies:moderate');
+
+-- Giving the existing users the movies:suggest permission, which new users get along with movies:read at registration
+INSERT INTO users_permissions (user_id, permission_id)
+SELECT up.user_id, suggest.id
+FROM users_permissions up
+INNER JOIN permissions p ON p.id = up.permission_id AND p.code = 'movies:read'
+CROSS JOIN permissions suggest
+WHERE suggest.code = 'movies:suggest'
+ON CONFLICT DO NOTHING;
\ No newline at end of file
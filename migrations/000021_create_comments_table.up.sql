@@ -0,0 +1,25 @@
+CREATE TABLE IF NOT EXISTS comments (
+  id bigserial PRIMARY KEY,
+  created_at timestamp(0) with time zone NOT NULL DEFAULT now(),
+  edited_at timestamp(0) with time zone,
+  movie_id bigint NOT NULL REFERENCES movies ON DELETE CASCADE,
+  user_id bigint NOT NULL REFERENCES users ON DELETE CASCADE,
+  parent_id bigint REFERENCES comments ON DELETE CASCADE,
+  body text NOT NULL,
+  deleted_at timestamp(0) with time zone,
+  hidden_at timestamp(0) with time zone,
+  hidden_by bigint REFERENCES users ON DELETE SET NULL,
+  hidden_reason text NOT NULL DEFAULT '',
+  version integer NOT NULL DEFAULT 1
+);
+
+CREATE INDEX IF NOT EXISTS comments_movie_id_idx ON comments (movie_id, id) WHERE parent_id IS NULL;
+CREATE INDEX IF NOT EXISTS comments_parent_id_idx ON comments (parent_id);
+
+CREATE TABLE IF NOT EXISTS comment_reports (
+  comment_id bigint NOT NULL REFERENCES comments ON DELETE CASCADE,
+  user_id bigint NOT NULL REFERENCES users ON DELETE CASCADE,
+  created_at timestamp(0) with time zone NOT NULL DEFAULT now(),
+  reason text NOT NULL,
+  PRIMARY KEY (comment_id, user_id)
+);
\ No newline at end of file
@@ -0,0 +1 @@
+DROP TABLE IF EXISTS movie_events;
\ No newline at end of file
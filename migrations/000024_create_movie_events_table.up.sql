@@ -0,0 +1,10 @@
+CREATE TABLE IF NOT EXISTS movie_events (
+  id bigserial PRIMARY KEY,
+  created_at timestamp(0) with time zone NOT NULL DEFAULT now(),
+  tx_id xid8 NOT NULL DEFAULT pg_current_xact_id(),
+  event text NOT NULL,
+  payload jsonb NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS movie_events_created_at_idx ON movie_events (created_at);
+CREATE INDEX IF NOT EXISTS movie_events_position_idx ON movie_events (tx_id, id);
\ No newline at end of file
@@ -0,0 +1,16 @@
+CREATE TABLE IF NOT EXISTS jobs (
+  id bigserial PRIMARY KEY,
+  created_at timestamp(0) with time zone NOT NULL DEFAULT now(),
+  kind text NOT NULL,
+  payload jsonb NOT NULL DEFAULT '{}',
+  unique_key text,
+  status text NOT NULL DEFAULT 'pending' CHECK (status IN ('pending', 'succeeded', 'dead')),
+  attempts integer NOT NULL DEFAULT 0,
+  max_attempts integer NOT NULL CHECK (max_attempts > 0),
+  run_at timestamp with time zone NOT NULL DEFAULT now(),
+  last_error text NOT NULL DEFAULT '',
+  finished_at timestamp(0) with time zone
+);
+
+CREATE INDEX IF NOT EXISTS jobs_due_idx ON jobs (run_at) WHERE status = 'pending';
+CREATE UNIQUE INDEX IF NOT EXISTS jobs_unique_key_idx ON jobs (unique_key) WHERE status = 'pending';
\ No newline at end of file